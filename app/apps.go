@@ -0,0 +1,211 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// AppsConfig is the config file listing the apps to scrape in one run, see run-all
+// The file is YAML or TOML by its extension, .yaml, .yml or .toml
+//
+// Example:
+//
+//	schedule: "@every 6h"
+//	jitter: 5m
+//	apps:
+//	  - name: candy-crush
+//	    schedule: "0 */2 * * *"
+//	    stores:
+//	      ios:
+//	        url: https://apps.apple.com/us/app/candy-crush-saga/id553834731?see-all=reviews
+//	        countries: [us, jp]
+//	      android:
+//	        url: https://play.google.com/store/apps/details?id=com.king.candycrushsaga&hl=en&gl=US
+//	        languages: [en, ja]
+//	    notify:
+//	      ms_teams_hook_url: https://example.webhook.office.com/...
+type AppsConfig struct {
+	// Schedule is the default schedule of the apps in serve, a cron expression or an interval
+	Schedule string `yaml:"schedule" toml:"schedule"`
+	// Jitter is the maximum random delay added to the scheduled runs in serve, eg. 5m
+	Jitter string     `yaml:"jitter" toml:"jitter"`
+	Apps   []AppEntry `yaml:"apps" toml:"apps"`
+}
+
+// AppEntry is an app in the config file, with the stores it is scraped from
+// Name is the same as -app-name, and is unique in the file
+// Stores are keyed by the store name of a registered scraper, eg. ios, android
+type AppEntry struct {
+	Name   string                 `yaml:"name" toml:"name"`
+	Stores map[string]*StoreEntry `yaml:"stores" toml:"stores"`
+	Notify NotifyEntry            `yaml:"notify" toml:"notify"`
+	// Schedule of the app in serve, default is the Schedule of the config
+	Schedule string `yaml:"schedule" toml:"schedule"`
+}
+
+// StoreEntry is the reviews page of an app on a store
+// The options are checked by the scraper of the store, which can reject the ones it doesn't have
+type StoreEntry struct {
+	// URL is the same as -reviews-url
+	URL string `yaml:"url" toml:"url"`
+	// Countries are the App Store countries to scrape, as the reviews differ per country
+	// Default is the country of the URL
+	Countries []string `yaml:"countries" toml:"countries"`
+	// Languages are the Play Store languages to scrape, as the reviews differ per language
+	// Default is the language of the URL
+	Languages []string `yaml:"languages" toml:"languages"`
+	// Backend is the same as -apple-backend, for the App Store only
+	Backend string `yaml:"backend" toml:"backend"`
+}
+
+// StoreNames returns the names of the stores of the app, sorted
+func (a AppEntry) StoreNames() []string {
+	names := []string{}
+	for name := range a.Stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NotifyEntry is where the notifications of an app are sent
+// Empty fields are the same as the env
+type NotifyEntry struct {
+	MSTeamsHookURL  string `yaml:"ms_teams_hook_url" toml:"ms_teams_hook_url"`
+	SlackWebhookURL string `yaml:"slack_webhook_url" toml:"slack_webhook_url"`
+	SlackBotToken   string `yaml:"slack_bot_token" toml:"slack_bot_token"`
+	SlackChannel    string `yaml:"slack_channel" toml:"slack_channel"`
+	// EmailTo are the recipients of the emails of the app, sent with the SMTP server of the env
+	EmailTo []string `yaml:"email_to" toml:"email_to"`
+	// EmailDigest sends the new reviews of a run in one email
+	EmailDigest bool `yaml:"email_digest" toml:"email_digest"`
+	// WebhookURLs are sent the signed payload of every notification of the app
+	WebhookURLs          []string `yaml:"webhook_urls" toml:"webhook_urls"`
+	WebhookSecret        string   `yaml:"webhook_secret" toml:"webhook_secret"`
+	DiscordWebhookURL    string   `yaml:"discord_webhook_url" toml:"discord_webhook_url"`
+	TelegramBotToken     string   `yaml:"telegram_bot_token" toml:"telegram_bot_token"`
+	TelegramChatID       string   `yaml:"telegram_chat_id" toml:"telegram_chat_id"`
+	MattermostWebhookURL string   `yaml:"mattermost_webhook_url" toml:"mattermost_webhook_url"`
+	GoogleChatWebhookURL string   `yaml:"google_chat_webhook_url" toml:"google_chat_webhook_url"`
+	// Channels are the only channels the app is notified on, eg. [slack, discord]
+	// Empty is all the channels that are configured
+	Channels []string `yaml:"channels" toml:"channels"`
+	// Rules select the reviews that are notified, default is all of them, see @NotifyRule
+	Rules []NotifyRule `yaml:"rules" toml:"rules"`
+	// Lookback is how long ago a new review can be first scraped, and how long before that it can be rated, and still be notified, eg. 72h
+	Lookback string `yaml:"lookback" toml:"lookback"`
+	// Digest is daily or weekly, to send a digest of the reviews instead of a notification for each of them
+	// DigestSchedule is when serve sends it, default is 9:00 every day, or on Monday for weekly
+	Digest         string `yaml:"digest" toml:"digest"`
+	DigestSchedule string `yaml:"digest_schedule" toml:"digest_schedule"`
+	// Templates is the dir of the templates of the notifications of the app
+	// Timezone is the time zone of the dates in them, eg. Asia/Tokyo
+	Templates string `yaml:"templates" toml:"templates"`
+	Timezone  string `yaml:"timezone" toml:"timezone"`
+}
+
+// NotifyRule selects the new and the updated reviews that are notified, eg. only the negative ones
+// A review matches the rule when it matches all the fields that are set
+// A channel with rules is notified of the reviews that match any of them, and a channel without of all the reviews
+// The rating summary and the errors are always notified
+type NotifyRule struct {
+	// Name is shown by rules-dry-run, default is rule {n}
+	Name string `yaml:"name" toml:"name"`
+	// Channels the rule is for, default is all the channels
+	Channels  []string `yaml:"channels" toml:"channels"`
+	MinRating int      `yaml:"min_rating" toml:"min_rating"`
+	MaxRating int      `yaml:"max_rating" toml:"max_rating"`
+	// Keywords match when any of them is in the title or the body, case insensitively
+	Keywords []string `yaml:"keywords" toml:"keywords"`
+	// Regex matches the title or the body, eg. (?i)crash(es|ed)?
+	Regex     string   `yaml:"regex" toml:"regex"`
+	Stores    []string `yaml:"stores" toml:"stores"`
+	Countries []string `yaml:"countries" toml:"countries"`
+	// Languages are only matched on the stores with a language, the reviews of the App Store have none and skip them
+	Languages []string `yaml:"languages" toml:"languages"`
+	// MinLength is the minimum number of characters of the body
+	MinLength int `yaml:"min_length" toml:"min_length"`
+}
+
+// LoadAppsConfig reads the config file of the apps
+// and returns an error when it is not valid, see @AppsConfig.Validate
+func LoadAppsConfig(path string) (*AppsConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &AppsConfig{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, config)
+	case ".toml":
+		_, err = toml.Decode(string(b), config)
+	default:
+		return nil, fmt.Errorf("[error] unknown config file extension %s, use .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[error] unable to parse %s: %w", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks that every app has a unique name and at least one store URL
+// The store names and their options are checked by their scrapers, when the apps are scraped
+func (c *AppsConfig) Validate() error {
+	if len(c.Apps) == 0 {
+		return fmt.Errorf("[error] no apps in the config")
+	}
+	if _, err := c.JitterDuration(); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for i, a := range c.Apps {
+		if a.Name == "" {
+			return fmt.Errorf("[error] app %d has no name", i+1)
+		}
+		if names[a.Name] {
+			return fmt.Errorf("[error] app %s is listed more than once", a.Name)
+		}
+		names[a.Name] = true
+
+		if len(a.Stores) == 0 {
+			return fmt.Errorf("[error] app %s has no stores", a.Name)
+		}
+		for _, store := range a.StoreNames() {
+			if a.Stores[store] == nil || a.Stores[store].URL == "" {
+				return fmt.Errorf("[error] app %s has no %s url", a.Name, store)
+			}
+		}
+	}
+	return nil
+}
+
+// JitterDuration returns the Jitter of the config, 0 when it isn't set
+func (c *AppsConfig) JitterDuration() (time.Duration, error) {
+	if c.Jitter == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(c.Jitter)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("[error] jitter %s is not a duration, eg. 5m", c.Jitter)
+	}
+	return d, nil
+}
+
+// ScheduleOf returns the schedule of the app, or the default Schedule of the config
+func (c *AppsConfig) ScheduleOf(a AppEntry) string {
+	if a.Schedule != "" {
+		return a.Schedule
+	}
+	return c.Schedule
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadAppsConfig(t *testing.T) {
+	yamlPath := writeConfig(t, "apps.yaml", `
+schedule: "@every 6h"
+jitter: 5m
+apps:
+  - name: candy-crush
+    schedule: "0 */2 * * *"
+    stores:
+      ios:
+        url: https://apps.apple.com/us/app/candy-crush-saga/id553834731?see-all=reviews
+        countries: [us, jp]
+        backend: feed
+      android:
+        url: https://play.google.com/store/apps/details?id=com.king.candycrushsaga&hl=en&gl=US
+        languages: [en, ja]
+    notify:
+      ms_teams_hook_url: https://example.com/candy
+  - name: farm-heroes
+    stores:
+      android:
+        url: https://play.google.com/store/apps/details?id=com.king.farmheroessaga
+`)
+	tomlPath := writeConfig(t, "apps.toml", `
+schedule = "@every 6h"
+jitter = "5m"
+
+[[apps]]
+name = "candy-crush"
+schedule = "0 */2 * * *"
+notify = { ms_teams_hook_url = "https://example.com/candy" }
+
+[apps.stores.ios]
+url = "https://apps.apple.com/us/app/candy-crush-saga/id553834731?see-all=reviews"
+countries = ["us", "jp"]
+backend = "feed"
+
+[apps.stores.android]
+url = "https://play.google.com/store/apps/details?id=com.king.candycrushsaga&hl=en&gl=US"
+languages = ["en", "ja"]
+
+[[apps]]
+name = "farm-heroes"
+
+[apps.stores.android]
+url = "https://play.google.com/store/apps/details?id=com.king.farmheroessaga"
+`)
+
+	for _, path := range []string{yamlPath, tomlPath} {
+		config, err := LoadAppsConfig(path)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(config.Apps))
+		jitter, err := config.JitterDuration()
+		assert.Nil(t, err)
+		assert.Equal(t, 5*time.Minute, jitter)
+
+		candy := config.Apps[0]
+		assert.Equal(t, "candy-crush", candy.Name)
+		assert.Equal(t, "https://apps.apple.com/us/app/candy-crush-saga/id553834731?see-all=reviews", candy.Stores["ios"].URL)
+		assert.Equal(t, []string{"us", "jp"}, candy.Stores["ios"].Countries)
+		assert.Equal(t, "feed", candy.Stores["ios"].Backend)
+		assert.Equal(t, []string{"en", "ja"}, candy.Stores["android"].Languages)
+		assert.Equal(t, []string{"android", "ios"}, candy.StoreNames())
+		assert.Equal(t, "https://example.com/candy", candy.Notify.MSTeamsHookURL)
+		assert.Equal(t, "0 */2 * * *", config.ScheduleOf(candy))
+
+		farm := config.Apps[1]
+		assert.Equal(t, "farm-heroes", farm.Name)
+		assert.Equal(t, []string{"android"}, farm.StoreNames())
+		assert.Equal(t, "https://play.google.com/store/apps/details?id=com.king.farmheroessaga", farm.Stores["android"].URL)
+		assert.Equal(t, "", farm.Notify.MSTeamsHookURL)
+		assert.Equal(t, "@every 6h", config.ScheduleOf(farm))
+	}
+}
+
+func TestLoadAppsConfigError(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "apps.json", content: `{"apps":[{"name":"a","stores":{"ios":{"url":"https://apps.apple.com/us/app/a/id1"}}}]}`},
+		{name: "apps.yaml", content: `apps: [`},
+		{name: "apps.yaml", content: `apps: []`},
+		{name: "apps.yaml", content: `apps: [{stores: {ios: {url: "https://apps.apple.com/us/app/a/id1"}}}]`},
+		{name: "apps.yaml", content: `apps: [{name: a}]`},
+		{name: "apps.yaml", content: `apps: [{name: a, stores: {}}]`},
+		{name: "apps.yaml", content: `apps: [{name: a, stores: {ios: {url: ""}}}]`},
+		{name: "apps.yaml", content: `apps: [{name: a, stores: {ios: }}]`},
+		{name: "apps.yaml", content: `apps: [{name: a, stores: {ios: {url: "https://apps.apple.com/us/app/a/id1"}}}, {name: a, stores: {ios: {url: "https://apps.apple.com/us/app/a/id1"}}}]`},
+		{name: "apps.yaml", content: `{jitter: soon, apps: [{name: a, stores: {ios: {url: "https://apps.apple.com/us/app/a/id1"}}}]}`},
+		{name: "apps.toml", content: `apps = "a"`},
+	}
+	for _, test := range tests {
+		t.Run("config error test", func(t *testing.T) {
+			_, err := LoadAppsConfig(writeConfig(t, test.name, test.content))
+			assert.NotNil(t, err)
+		})
+	}
+
+	_, err := LoadAppsConfig("apps.not_exist.yaml")
+	assert.NotNil(t, err)
+}
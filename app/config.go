@@ -3,6 +3,7 @@ package app
 import (
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -20,13 +21,118 @@ type DBConfig struct {
 // AppConfig is the configuration for the DB client.
 type AppConfig struct {
 	MSTeamsHookURL string
+
+	// Slack is notified with the incoming webhook, or with the bot token on the channel
+	// The bot token threads the new reviews of a run under its rating summary
+	SlackWebhookURL string
+	SlackBotToken   string
+	SlackChannel    string
+
+	// SMTP server the emails are sent with
+	// SMTPTLS is starttls (default), tls for implicit TLS, or none for a local server
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	SMTPTLS      string
+	// EmailTo are the recipients of the emails, comma separated in the env
+	EmailTo []string
+	// EmailDigest sends the new reviews of a run in one email, instead of one email each
+	EmailDigest bool
+
+	// WebhookURLs are sent the signed payload of every notification, comma separated in the env
+	// WebhookSecret is the key of the HMAC signature
+	WebhookURLs   []string
+	WebhookSecret string
+
+	DiscordWebhookURL string
+	// Telegram is notified with the bot token on the chat, its id or @channelusername
+	TelegramBotToken     string
+	TelegramChatID       string
+	MattermostWebhookURL string
+	GoogleChatWebhookURL string
+	// NotifyChannels are the only channels that are notified, comma separated in the env
+	// Empty is all the channels that are configured
+	NotifyChannels []string
+	// NotifyLookback is how long ago a new review can be first scraped, and how long before that it can be rated, and still be notified
+	// eg. 72h, default is 24h. The reviews are notified once on each channel, so it can be longer than the schedule to cover downtime
+	NotifyLookback string
+	// NotifyDigest is daily or weekly, to send a digest instead of a notification for each review
+	// NotifyDigestSchedule is when serve sends it, a cron expression or an interval
+	NotifyDigest         string
+	NotifyDigestSchedule string
+	// NotifyTemplates is the dir of the templates of the notifications, default is the current layout
+	// NotifyTimezone is the time zone of the dates in the templates, eg. Asia/Tokyo
+	NotifyTemplates string
+	NotifyTimezone  string
+
+	// App Store Connect API key, for replying to the App Store reviews
+	// The private key is the .p8 file downloaded from App Store Connect
+	AppStoreConnectIssuerID       string
+	AppStoreConnectKeyID          string
+	AppStoreConnectPrivateKeyPath string
+	// AppStoreConnectBaseURL is optional, for the API served elsewhere, eg. a local stand-in
+	AppStoreConnectBaseURL string
+
+	// Google Play Developer API service account, for replying to the Play Store reviews
+	// The service account is the .json key file downloaded from Google Cloud
+	GooglePlayServiceAccountPath string
+	// GooglePlayBaseURL is optional, for the API served elsewhere, eg. a local stand-in
+	GooglePlayBaseURL string
+
+	// APIKeys are the keys of the REST API of serve-api, comma separated in the env
+	APIKeys []string
 }
 
 // NewAppConfig returns a new Config struct with the configs
 func NewAppConfig() *AppConfig {
+	emailDigest, _ := strconv.ParseBool(os.Getenv("EMAIL_DIGEST"))
 	return &AppConfig{
-		MSTeamsHookURL: os.Getenv("MS_TEAMS_HOOK_URL"),
+		MSTeamsHookURL:                os.Getenv("MS_TEAMS_HOOK_URL"),
+		SlackWebhookURL:               os.Getenv("SLACK_WEBHOOK_URL"),
+		SlackBotToken:                 os.Getenv("SLACK_BOT_TOKEN"),
+		SlackChannel:                  os.Getenv("SLACK_CHANNEL"),
+		SMTPHost:                      os.Getenv("SMTP_HOST"),
+		SMTPPort:                      os.Getenv("SMTP_PORT"),
+		SMTPUsername:                  os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:                  os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:                      os.Getenv("SMTP_FROM"),
+		SMTPTLS:                       os.Getenv("SMTP_TLS"),
+		EmailTo:                       splitList(os.Getenv("EMAIL_TO")),
+		EmailDigest:                   emailDigest,
+		WebhookURLs:                   splitList(os.Getenv("WEBHOOK_URLS")),
+		WebhookSecret:                 os.Getenv("WEBHOOK_SECRET"),
+		DiscordWebhookURL:             os.Getenv("DISCORD_WEBHOOK_URL"),
+		TelegramBotToken:              os.Getenv("TELEGRAM_BOT_TOKEN"),
+		TelegramChatID:                os.Getenv("TELEGRAM_CHAT_ID"),
+		MattermostWebhookURL:          os.Getenv("MATTERMOST_WEBHOOK_URL"),
+		GoogleChatWebhookURL:          os.Getenv("GOOGLE_CHAT_WEBHOOK_URL"),
+		NotifyChannels:                splitList(os.Getenv("NOTIFY_CHANNELS")),
+		NotifyLookback:                os.Getenv("NOTIFY_LOOKBACK"),
+		NotifyDigest:                  os.Getenv("NOTIFY_DIGEST"),
+		NotifyDigestSchedule:          os.Getenv("NOTIFY_DIGEST_SCHEDULE"),
+		NotifyTemplates:               os.Getenv("NOTIFY_TEMPLATES"),
+		NotifyTimezone:                os.Getenv("NOTIFY_TIMEZONE"),
+		AppStoreConnectIssuerID:       os.Getenv("APP_STORE_CONNECT_ISSUER_ID"),
+		AppStoreConnectKeyID:          os.Getenv("APP_STORE_CONNECT_KEY_ID"),
+		AppStoreConnectPrivateKeyPath: os.Getenv("APP_STORE_CONNECT_PRIVATE_KEY_PATH"),
+		AppStoreConnectBaseURL:        os.Getenv("APP_STORE_CONNECT_BASE_URL"),
+		GooglePlayServiceAccountPath:  os.Getenv("GOOGLE_PLAY_SERVICE_ACCOUNT_PATH"),
+		GooglePlayBaseURL:             os.Getenv("GOOGLE_PLAY_BASE_URL"),
+		APIKeys:                       splitList(os.Getenv("API_KEYS")),
+	}
+}
+
+// splitList splits the comma separated list of the env, without the empty items
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
 	}
+	return list
 }
 
 // NewDBConfig returns a new DBConfig.
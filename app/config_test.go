@@ -17,3 +17,9 @@ func TestConfig(t *testing.T) {
 	assert.NotNil(t, conf.AppConfig)
 	assert.NotNil(t, conf.DBConfig)
 }
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{}, splitList(""))
+	assert.Equal(t, []string{"a@example.com"}, splitList("a@example.com"))
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, splitList(" a@example.com, ,b@example.com,"))
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"gorm.io/driver/mysql"
@@ -12,7 +13,11 @@ import (
 	"gorm.io/gorm/logger"
 )
 
-var dbMaster *gorm.DB
+var (
+	dbMaster *gorm.DB
+	// dbMasterOnce connects once, as the handlers of serve-api and dashboard get the DB concurrently
+	dbMasterOnce sync.Once
+)
 
 func NewDB() *gorm.DB {
 	return NewMasterDB()
@@ -62,9 +67,7 @@ func sqliteConnection() *gorm.DB {
 }
 
 func NewMasterDB() *gorm.DB {
-	if dbMaster == nil {
-		setMasterDB()
-	}
+	dbMasterOnce.Do(setMasterDB)
 	sqlDB, err := dbMaster.DB()
 	_ = sqlDB
 
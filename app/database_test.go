@@ -0,0 +1,26 @@
+package app
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestNewDB(t *testing.T) {
+	// connected once, by the first of the concurrent handlers
+	dbs := make([]*gorm.DB, 10)
+	var wg sync.WaitGroup
+	for i := range dbs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dbs[i] = NewDB()
+		}(i)
+	}
+	wg.Wait()
+	for _, db := range dbs {
+		assert.Same(t, dbs[0], db)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"github.com/kevincobain2000/go-app-reviews-scraper/services"
+)
+
+// runDashboard serves the web UI of the stored reviews and their rating trends, see @services.NewDashboard
+// The UI reads the DB of the env through the API, which requires one of API_KEYS when they are set
+// Without API_KEYS anyone who can reach addr can read the reviews, so the default addr is of this machine only
+// Example: ENV_PATH=./.env.local go-app-reviews-scraper dashboard -addr=127.0.0.1:8081
+func runDashboard(args []string) error {
+	fs := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8081", "Description: The address the dashboard listens on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	keys := app.NewConfig().AppConfig.APIKeys
+	api := services.NewAPI(ctx, keys)
+	if len(keys) == 0 {
+		api.Open = true
+		log.Printf("[warn] API_KEYS is not set, the reviews can be read by anyone who can reach %s\n", *addr)
+	}
+	return listenAndServe(ctx, *addr, services.NewDashboard(api), api)
+}
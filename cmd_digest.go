@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"github.com/kevincobain2000/go-app-reviews-scraper/services"
+)
+
+// runDigest sends the daily or weekly digest of the reviews of the apps now, built from DB, see @services.Digest
+// The apps are of the config file with their notifications, or the app name with the notifications of the env
+// Example: go-app-reviews-scraper digest -config=apps.yaml -period=weekly
+// Example: go-app-reviews-scraper digest -app-name="candy-crush"
+func runDigest(args []string) error {
+	fs := flag.NewFlagSet("digest", flag.ExitOnError)
+	configPath := fs.String("config", "", "Description: The config file of the apps, .yaml, .yml or .toml. Default is -app-name with the notifications of the env")
+	appName := fs.String("app-name", "", "Description: Only the digest of the app name. Required without -config")
+	period := fs.String("period", "", "Description: daily or weekly. Default is the digest of the app, or daily")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *period != "" {
+		if _, err := services.DigestPeriod(*period); err != nil {
+			return err
+		}
+	}
+
+	targets := []appTarget{}
+	if *configPath == "" {
+		if *appName == "" {
+			return fmt.Errorf("[error] -app-name or -config is required. See -h for help")
+		}
+		nn, err := services.NewNotify(app.NotifyEntry{})
+		if err != nil {
+			return err
+		}
+		for _, store := range services.Stores() {
+			scraper, err := services.GetScraper(store)
+			if err != nil {
+				return err
+			}
+			targets = append(targets, appTarget{appName: *appName, scraper: scraper, notify: nn})
+		}
+	} else {
+		config, err := app.LoadAppsConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		all, err := newAppTargets(config, nil)
+		if err != nil {
+			return err
+		}
+		for _, target := range all {
+			if *appName == "" || target.appName == *appName {
+				targets = append(targets, target)
+			}
+		}
+		if len(targets) == 0 {
+			return fmt.Errorf("[error] app %s is not in %s", *appName, *configPath)
+		}
+	}
+
+	errs := []error{}
+	for _, target := range targets {
+		errs = append(errs, sendDigest(target.notify, target.appName, target.scraper.Store(), *period))
+	}
+	return errors.Join(errs...)
+}
+
+// sendDigest sends the digest of the app on the store until now, for the period or the Digest of nn, default daily
+// No digest is sent for a store without reviews in the period, nor a rating
+func sendDigest(nn *services.Notify, appName, store, period string) error {
+	if period == "" {
+		period = nn.Digest
+	}
+	if period == "" {
+		period = services.DigestDaily
+	}
+	digest, err := services.NewDigest(appName, store, period, time.Now())
+	if err != nil {
+		return err
+	}
+	if digest.Total == 0 && digest.Current.ID == 0 {
+		log.Printf("[info] no reviews or rating of %s on %s, skipping the digest\n", appName, store)
+		return nil
+	}
+	return nn.NotifyDigest(digest)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/services"
+)
+
+// runExport streams the rows of reviews or review_counts to CSV, JSON Lines or Parquet, see @services.Exporter
+// The rows are written to -out, or printed when -out isn't set, and the format is of the extension of -out unless -format is set
+// With -cursor only the rows after the last export are written, and the CSV and JSON Lines of -out are appended to,
+// so that a nightly job only adds the new rows. The cursor is saved once the export succeeded, by the table and the filters
+// Example: go-app-reviews-scraper export -table=reviews -app-name=candy-crush -from=2026-10-01 -out=reviews.csv -cursor=export.json
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	table := fs.String("table", services.ExportReviews, "Description: reviews or review_counts")
+	format := fs.String("format", "", "Description: csv, jsonl or parquet. Default is of the extension of -out, or csv")
+	out := fs.String("out", "", "Description: The file the rows are written to. Default is to print them")
+	appNames := fs.String("app-name", "", "Description: Only the rows of the apps, comma separated")
+	stores := fs.String("store", "", "Description: Only the rows on the stores, comma separated, eg. android,ios")
+	from := fs.String("from", "", "Description: Only the rows from the date, eg. 2026-10-01. Rated for the reviews, and scraped for the review_counts")
+	to := fs.String("to", "", "Description: Only the rows until the date, the whole day, eg. 2026-10-31")
+	columns := fs.String("columns", "", "Description: The columns, comma separated, eg. id,app_name,rating,title. Default is all of them")
+	cursorPath := fs.String("cursor", "", "Description: The JSON file of the last rows exported, by the table and the filters, only the rows after them are exported. Optional")
+	bom := fs.Bool("bom", false, "Description: Write the UTF-8 byte order mark before CSV, for Excel to read eg. the Japanese reviews")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = services.ExportCSV
+		switch strings.ToLower(filepath.Ext(*out)) {
+		case ".jsonl", ".ndjson":
+			*format = services.ExportJSONL
+		case ".parquet":
+			*format = services.ExportParquet
+		}
+	}
+
+	e, err := services.NewExporter(*table, *format, splitFlag(*columns))
+	if err != nil {
+		return err
+	}
+	e.BOM = *bom
+	query := services.ExportQuery{Table: *table, AppNames: splitFlag(*appNames), Stores: splitFlag(*stores)}
+	if query.From, err = parseDateFlag("from", *from, false); err != nil {
+		return err
+	}
+	if query.To, err = parseDateFlag("to", *to, true); err != nil {
+		return err
+	}
+	var cursor services.ExportCursor
+	if *cursorPath != "" {
+		if cursor, err = services.LoadExportCursor(*cursorPath); err != nil {
+			return err
+		}
+		query.AfterID = cursor[query.CursorKey()]
+	}
+
+	w, err := openExport(*out, *format, *cursorPath != "")
+	if err != nil {
+		return err
+	}
+	// the header and the byte order mark are only at the start of the file
+	if info, err := w.Stat(); err == nil && info.Mode().IsRegular() && info.Size() > 0 {
+		e.Header = false
+		e.BOM = false
+	}
+	bw := bufio.NewWriter(w)
+	count, lastID, err := e.Export(bw, query)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if w != os.Stdout {
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if cursor != nil {
+		cursor[query.CursorKey()] = lastID
+		if err := cursor.Save(*cursorPath); err != nil {
+			return err
+		}
+	}
+	if *out != "" {
+		log.Printf("[info] %d rows of %s exported to %s\n", count, *table, *out)
+	}
+	return nil
+}
+
+// openExport opens the file of the export, or stdout when there is none
+// The CSV and JSON Lines are appended to when appending, while Parquet can't be, so its file must be new
+func openExport(path, format string, appending bool) (*os.File, error) {
+	if path == "" {
+		return os.Stdout, nil
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appending {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		if format == services.ExportParquet {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		}
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("[error] %s exists, parquet can't be appended to, export each time to a new file, eg. with the date in its name", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[error] unable to open %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// splitFlag splits the comma separated values of the flag, without the empty ones
+func splitFlag(s string) []string {
+	values := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// parseDateFlag parses the date of the flag, eg. 2026-10-01, in the local time
+// A date that ends the range is until the end of the day
+func parseDateFlag(name, s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("[error] -%s must be a date, eg. 2006-01-02", name)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/services"
+)
+
+// runFeed writes the feed of the newest reviews of the app, the same as serve-api serves, see @services.Feed
+// The feed is written to -out, eg. to be hosted on object storage, or printed when -out isn't set
+// The format is of the extension of -out, .atom, .xml or .rss, unless -format is set
+// Example: go-app-reviews-scraper feed -app-name=candy-crush -store=ios -max-rating=2 -out=public/candy-crush-ios.atom
+func runFeed(args []string) error {
+	fs := flag.NewFlagSet("feed", flag.ExitOnError)
+	appName := fs.String("app-name", "", "Description: The app name. Required")
+	store := fs.String("store", "", "Description: Only the reviews on the store, eg. android or ios")
+	minRating := fs.Int("min-rating", 0, "Description: Only the reviews of the rating or above, 1 to 5")
+	maxRating := fs.Int("max-rating", 0, "Description: Only the reviews of the rating or below, 1 to 5")
+	size := fs.Int("size", services.FeedSize, "Description: The number of the newest reviews in the feed")
+	format := fs.String("format", "", "Description: atom or rss. Default is of the extension of -out, or atom")
+	out := fs.String("out", "", "Description: The file the feed is written to. Default is to print it")
+	link := fs.String("link", "", "Description: The URL the file is hosted at, for the feed readers. Optional")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *appName == "" {
+		return fmt.Errorf("[error] -app-name is required. See -h for help")
+	}
+	if *size < 1 {
+		return fmt.Errorf("[error] -size must be 1 or more")
+	}
+	for _, rating := range []int{*minRating, *maxRating} {
+		if rating < 0 || rating > 5 {
+			return fmt.Errorf("[error] -min-rating and -max-rating must be 1 to 5")
+		}
+	}
+	if *format == "" {
+		*format = services.FeedAtom
+		if strings.ToLower(filepath.Ext(*out)) == ".rss" {
+			*format = services.FeedRSS
+		}
+	}
+
+	feed, err := services.NewFeed(services.ReviewsQuery{
+		AppName:   *appName,
+		Store:     *store,
+		MinRating: *minRating,
+		MaxRating: *maxRating,
+		PerPage:   *size,
+	}, *link)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := feed.Write(&b, *format); err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err := os.Stdout.Write(b.Bytes())
+		return err
+	}
+	if err := os.WriteFile(*out, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("[error] unable to write the feed to %s: %w", *out, err)
+	}
+	log.Printf("[info] %d reviews of %s written to %s\n", len(feed.Reviews), *appName, *out)
+	return nil
+}
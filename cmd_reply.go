@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"github.com/kevincobain2000/go-app-reviews-scraper/services"
+)
+
+// runReply posts the reply to a stored review on its store and records it locally
+// The review id is the id in the reviews table, eg. from the unanswered command
+// The Play Store app of an android review is of the url of its app in -config, see @replyPackageName
+// Example: go-app-reviews-scraper reply -review-id=12 -text="Thanks for the review"
+// Example: go-app-reviews-scraper reply -review-id=13 -text="Thanks for the review" -package-name=com.king.candycrushsaga
+func runReply(args []string) error {
+	fs := flag.NewFlagSet("reply", flag.ExitOnError)
+	reviewID := fs.Int("review-id", 0, "Description: The id of the review to reply to")
+	text := fs.String("text", "", "Description: The reply text")
+	configPath := fs.String("config", "apps.yaml", "Description: The config file of the apps, the Play Store app of android reviews is of the url of their app")
+	packageName := fs.String("package-name", "", "Description: The Play Store app of android reviews without -config, checked against the config otherwise. Example: com.king.candycrushsaga")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *reviewID == 0 || *text == "" {
+		return fmt.Errorf("[error] Missing required flags. See reply -h for help")
+	}
+	configSet := false
+	fs.Visit(func(f *flag.Flag) {
+		configSet = configSet || f.Name == "config"
+	})
+
+	review, err := services.NewReviewsRepository().FindReview(*reviewID)
+	if err != nil {
+		return fmt.Errorf("[error] unable to find review %d: %w", *reviewID, err)
+	}
+	pkg, err := replyPackageName(review, *packageName, *configPath, configSet)
+	if err != nil {
+		return err
+	}
+	repliers, err := newRepliers(pkg)
+	if err != nil {
+		return err
+	}
+	response, err := services.NewResponder(repliers...).Reply(context.Background(), *reviewID, *text)
+	if err != nil {
+		return err
+	}
+	log.Printf("[info] Replied to review %d\n", response.ReviewID)
+	return nil
+}
+
+// replyPackageName returns the Play Store app of the review, the id of the url of its app in the config
+// and checks that -package-name is the same, so that a typo isn't replied to on another app
+// Without the config, which is optional unless it was set, -package-name is used as it is
+// The reviews of the other stores have no package name
+func replyPackageName(review services.ReviewModel, packageName, configPath string, configSet bool) (string, error) {
+	if review.Store != services.StoreAndroid {
+		return "", nil
+	}
+	if _, err := os.Stat(configPath); os.IsNotExist(err) && !configSet {
+		if packageName == "" {
+			return "", fmt.Errorf("[error] -package-name or -config is required to reply to the android review %d", review.ID)
+		}
+		log.Printf("[warn] -package-name %s isn't checked to be of the app %s without -config\n", packageName, review.AppName)
+		return packageName, nil
+	}
+	config, err := app.LoadAppsConfig(configPath)
+	if err != nil {
+		return "", err
+	}
+	for _, a := range config.Apps {
+		if a.Name != review.AppName || a.Stores[services.StoreAndroid] == nil {
+			continue
+		}
+		u, err := url.Parse(a.Stores[services.StoreAndroid].URL)
+		if err != nil {
+			return "", err
+		}
+		id := u.Query().Get("id")
+		if id == "" {
+			return "", fmt.Errorf("[error] the android url of app %s has no id", a.Name)
+		}
+		if packageName != "" && packageName != id {
+			return "", fmt.Errorf("[error] -package-name %s is not %s, the app %s of review %d", packageName, id, a.Name, review.ID)
+		}
+		return id, nil
+	}
+	return "", fmt.Errorf("[error] app %s of review %d has no android url in %s", review.AppName, review.ID, configPath)
+}
+
+// newRepliers returns the repliers of the stores with the API keys in the env
+// A store without its API keys is skipped
+func newRepliers(packageName string) ([]services.Replier, error) {
+	c := app.NewConfig().AppConfig
+	repliers := []services.Replier{}
+
+	if c.AppStoreConnectPrivateKeyPath != "" {
+		key, err := os.ReadFile(c.AppStoreConnectPrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		a, err := services.NewAppStoreConnect(c.AppStoreConnectIssuerID, c.AppStoreConnectKeyID, key)
+		if err != nil {
+			return nil, err
+		}
+		if c.AppStoreConnectBaseURL != "" {
+			a.BaseURL = c.AppStoreConnectBaseURL
+		}
+		repliers = append(repliers, a)
+	}
+
+	if c.GooglePlayServiceAccountPath != "" {
+		account, err := os.ReadFile(c.GooglePlayServiceAccountPath)
+		if err != nil {
+			return nil, err
+		}
+		g, err := services.NewGooglePlayDeveloper(packageName, account)
+		if err != nil {
+			return nil, err
+		}
+		if c.GooglePlayBaseURL != "" {
+			g.BaseURL = c.GooglePlayBaseURL
+		}
+		repliers = append(repliers, g)
+	}
+	return repliers, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"github.com/kevincobain2000/go-app-reviews-scraper/services"
+)
+
+// runRulesDryRun prints the stored reviews that each notify rule of the apps would have matched
+// and how many of them each channel with rules would have been notified of, without notifying
+// Example: go-app-reviews-scraper rules-dry-run -config=apps.yaml -app-name="candy-crush" -days=30
+func runRulesDryRun(args []string) error {
+	fs := flag.NewFlagSet("rules-dry-run", flag.ExitOnError)
+	configPath := fs.String("config", "apps.yaml", "Description: The config file of the apps, .yaml, .yml or .toml")
+	appName := fs.String("app-name", "", "Description: Only the rules of the app name. Default all the apps")
+	days := fs.Int("days", 30, "Description: Only the reviews rated in the last days. 0 is all the reviews")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *days < 0 {
+		return fmt.Errorf("[error] -days must be 0 or more. See -h for help")
+	}
+
+	config, err := app.LoadAppsConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	since := time.Time{}
+	if *days > 0 {
+		since = time.Now().AddDate(0, 0, -*days)
+	}
+	repo := services.NewReviewsRepository()
+	found := false
+	for _, a := range config.Apps {
+		if *appName != "" && a.Name != *appName {
+			continue
+		}
+		found = true
+		rules, err := services.NewNotifyRules(a.Notify.Rules)
+		if err != nil {
+			return fmt.Errorf("[error] app %s: %w", a.Name, err)
+		}
+		if len(rules) == 0 {
+			fmt.Printf("%s has no rules, all the reviews are notified\n\n", a.Name)
+			continue
+		}
+		reviews, err := repo.FindReviews(a.Name, "", since)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s has %d stored reviews", a.Name, len(reviews))
+		if *days > 0 {
+			fmt.Printf(" rated in the last %d days", *days)
+		}
+		fmt.Print("\n\n")
+		if err := printRuleMatches(rules, reviews); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return fmt.Errorf("[error] app %s is not in %s", *appName, *configPath)
+	}
+	return nil
+}
+
+// printRuleMatches prints the reviews each rule matches, and the reviews each channel with rules is notified of
+func printRuleMatches(rules services.NotifyRules, reviews []services.ReviewModel) error {
+	channels := []string{}
+	for _, rule := range rules {
+		matched := []services.ReviewModel{}
+		for _, review := range reviews {
+			if rule.Match(review) {
+				matched = append(matched, review)
+			}
+		}
+		on := "all channels"
+		if len(rule.Channels) > 0 {
+			on = strings.Join(rule.Channels, ", ")
+		}
+		fmt.Printf("%s (%s) matched %d reviews\n", rule.Name, on, len(matched))
+		for _, channel := range rule.Channels {
+			if !slices.Contains(channels, channel) {
+				channels = append(channels, channel)
+			}
+		}
+		if len(matched) == 0 {
+			fmt.Println()
+			continue
+		}
+		uu := services.NewUtils()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tRATING\tSTORE\tCOUNTRY\tLANGUAGE\tRATED AT\tUSERNAME\tTITLE")
+		for _, review := range matched {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t@%s\t%s\n",
+				review.ID,
+				uu.Stars(review.Rating),
+				review.Store,
+				review.Country,
+				review.Language,
+				review.RatedAt.Format("02-Jan-2006"),
+				review.Username,
+				review.Title,
+			)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Println()
+	}
+
+	// the rules without channels are for all of them
+	for _, rule := range rules {
+		if len(rule.Channels) == 0 {
+			channels = append([]string{"other channels"}, channels...)
+			break
+		}
+	}
+	for _, channel := range channels {
+		notified := 0
+		for _, review := range reviews {
+			if rules.Allow(channel, review) {
+				notified++
+			}
+		}
+		fmt.Printf("%s would be notified of %d of %d reviews\n", channel, notified, len(reviews))
+	}
+	fmt.Println()
+	return nil
+}
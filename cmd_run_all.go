@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"github.com/kevincobain2000/go-app-reviews-scraper/services"
+)
+
+// appTarget is an app on a store to scrape in run-all, see @runApp
+type appTarget struct {
+	appName string
+	scraper services.Scraper
+	urls    []string
+	notify  *services.Notify
+}
+
+// scrapeJob is a url of an app to scrape by the workers of run-all
+// target and url are the indexes of the app and its url
+type scrapeJob struct {
+	target int
+	url    int
+}
+
+// scrapeJobResult is the result of a scrapeJob
+type scrapeJobResult struct {
+	scrapeJob
+	result scrapeResult
+}
+
+// runAll scrapes all the apps of the config file in one run, see @app.AppsConfig
+// The urls of all the apps are scraped concurrently by -parallel workers,
+// with -rate requests per second for each host shared by the workers, see @services.RateLimitTransport
+// An app is saved once all its urls are scraped, by a single writer so that the DB isn't written concurrently
+// An app that fails doesn't stop the other apps, and the run fails when any of the apps failed
+// Example: go-app-reviews-scraper run-all -config=apps.yaml -parallel=4 -rate=1
+func runAll(args []string) error {
+	fs := flag.NewFlagSet("run-all", flag.ExitOnError)
+	configPath := fs.String("config", "apps.yaml", "Description: The config file of the apps, .yaml, .yml or .toml")
+	parallel := fs.Int("parallel", 4, "Description: The number of urls scraped at once")
+	rate := fs.Float64("rate", 1, "Description: The requests per second to each store host. 0 is no limit")
+	burst := fs.Int("burst", 2, "Description: The requests to each store host that can be sent at once")
+	metricsFile := fs.String("metrics-file", "", "Description: Write the metrics of the apps to the file, for the textfile collector of node_exporter")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *parallel < 1 {
+		return fmt.Errorf("[error] -parallel must be 1 or more")
+	}
+
+	config, err := app.LoadAppsConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	targets, err := newAppTargets(config, services.NewRateLimitTransport(*rate, *burst, nil))
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	jobs := make(chan scrapeJob)
+	results := make(chan scrapeJobResult)
+	go func() {
+		for i, target := range targets {
+			for j := range target.urls {
+				jobs <- scrapeJob{target: i, url: j}
+			}
+		}
+		close(jobs)
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < *parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				target := targets[job.target]
+				results <- scrapeJobResult{scrapeJob: job, result: scrapeURL(ctx, target.scraper, target.urls[job.url])}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// single writer, saves an app once all its urls are scraped
+	// the errors are logged by scrapeURL and saveApp
+	scraped := make([][]scrapeResult, len(targets))
+	remaining := make([]int, len(targets))
+	for i, target := range targets {
+		scraped[i] = make([]scrapeResult, len(target.urls))
+		remaining[i] = len(target.urls)
+	}
+	failed := []string{}
+	for r := range results {
+		scraped[r.target][r.url] = r.result
+		remaining[r.target]--
+		if remaining[r.target] > 0 {
+			continue
+		}
+		target := targets[r.target]
+		name := target.appName + " (" + target.scraper.Store() + ")"
+		log.Println("[info] Saving", name)
+		if saveApp(target.appName, target.scraper.Store(), scraped[r.target], target.notify) != nil {
+			log.Println("[error]", name, "failed")
+			failed = append(failed, name)
+		}
+	}
+
+	log.Printf("[info] %d of %d apps succeeded\n", len(targets)-len(failed), len(targets))
+	if *metricsFile != "" {
+		if err := metrics.WriteFile(*metricsFile); err != nil {
+			log.Println(err)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("[error] %d of %d apps failed: %s", len(failed), len(targets), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// newAppTargets returns the apps of the config, one per store
+// with the urls of each country or language, and the notifications of the app
+// The stores are of the registered scrapers, whose scrapers of all the apps send their requests with the transport
+func newAppTargets(config *app.AppsConfig, transport http.RoundTripper) ([]appTarget, error) {
+	targets := []appTarget{}
+	for _, a := range config.Apps {
+		nn, err := services.NewNotify(a.Notify)
+		if err != nil {
+			return nil, fmt.Errorf("%w of app %s", err, a.Name)
+		}
+		for _, store := range a.StoreNames() {
+			// own scraper, as the options are per app
+			scraper, urls, err := services.NewAppScraper(store, *a.Stores[store], transport)
+			if err != nil {
+				return nil, fmt.Errorf("%w of app %s", err, a.Name)
+			}
+			targets = append(targets, appTarget{appName: a.Name, scraper: scraper, urls: urls, notify: nn})
+		}
+	}
+	return targets, nil
+}
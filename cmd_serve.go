@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"github.com/kevincobain2000/go-app-reviews-scraper/services"
+)
+
+// runServe runs as a daemon, and scrapes each app of the config file on its own schedule, see @services.Scheduler
+// The schedule of an app is its schedule in the config, or the schedule of the config
+// The apps with a digest are sent it on the digest schedule, see @sendDigest
+// A run of an app is never started while its previous run is still running, and a failed run doesn't stop the daemon
+// The apps are saved by one at a time, so that the DB isn't written concurrently
+// On SIGINT or SIGTERM the scraping is stopped, and the apps that are being saved are finished before it exits
+// With -metrics-addr the metrics of the runs are served on /metrics, see @services.Metrics
+// Example: go-app-reviews-scraper serve -config=apps.yaml -metrics-addr=:9091
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := fs.String("config", "apps.yaml", "Description: The config file of the apps, .yaml, .yml or .toml, with their schedules")
+	rate := fs.Float64("rate", 1, "Description: The requests per second to each store host. 0 is no limit")
+	burst := fs.Int("burst", 2, "Description: The requests to each store host that can be sent at once")
+	metricsAddr := fs.String("metrics-addr", "", "Description: The address to serve the Prometheus metrics on, at /metrics. Example: :9091")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	config, err := app.LoadAppsConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	jitter, err := config.JitterDuration()
+	if err != nil {
+		return err
+	}
+	targets, err := newAppTargets(config, services.NewRateLimitTransport(*rate, *burst, nil))
+	if err != nil {
+		return err
+	}
+
+	var writer sync.Mutex
+	scheduler := services.NewScheduler(jitter)
+	for _, a := range config.Apps {
+		spec := config.ScheduleOf(a)
+		if spec == "" {
+			return fmt.Errorf("[error] app %s has no schedule, set the schedule of the app or of the config", a.Name)
+		}
+		appTargets := []appTarget{}
+		for _, target := range targets {
+			if target.appName == a.Name {
+				appTargets = append(appTargets, target)
+			}
+		}
+		if err := scheduler.Add(a.Name, spec, func(ctx context.Context) error {
+			return serveApp(ctx, &writer, appTargets)
+		}); err != nil {
+			return err
+		}
+		if len(appTargets) > 0 && appTargets[0].notify.Digest != "" {
+			if err := scheduler.Add("digest of "+a.Name, appTargets[0].notify.DigestSchedule, func(ctx context.Context) error {
+				return serveDigest(&writer, appTargets)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// the retries of the notifications are stopped on shutdown too
+	for _, target := range targets {
+		target.notify.SetContext(ctx)
+	}
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics)
+		// the daemon is stopped when the metrics can't be served, as they are what alerts on it
+		go func() {
+			if err := listenAndServe(ctx, *metricsAddr, mux, nil); err != nil {
+				log.Println(err)
+				stop()
+			}
+		}()
+	}
+	log.Printf("[info] serving %d apps from %s\n", len(config.Apps), *configPath)
+	scheduler.Run(ctx)
+	log.Println("[info] stopped serving")
+	return nil
+}
+
+// serveApp scrapes the urls of the app on each of its stores and saves them, see @saveApp
+// The scraping is stopped when ctx is done, and its results are dropped without notifying their errors, as they were cut short
+// while saving that already started is finished regardless
+// writer is held while saving, so that only one app is written to DB at a time
+func serveApp(ctx context.Context, writer *sync.Mutex, targets []appTarget) error {
+	failed := 0
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		results := []scrapeResult{}
+		for _, urlStr := range target.urls {
+			results = append(results, scrapeURL(ctx, target.scraper, urlStr))
+		}
+		if ctx.Err() != nil {
+			log.Printf("[info] stopped scraping %s on %s\n", target.appName, target.scraper.Store())
+			return ctx.Err()
+		}
+
+		writer.Lock()
+		err := saveApp(target.appName, target.scraper.Store(), results, target.notify)
+		writer.Unlock()
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("[error] %d of %d stores failed", failed, len(targets))
+	}
+	return nil
+}
+
+// serveDigest sends the digest of the app on each of its stores, see @sendDigest
+// writer is held while building it, so that it isn't read while the app is being saved
+func serveDigest(writer *sync.Mutex, targets []appTarget) error {
+	errs := []error{}
+	for _, target := range targets {
+		writer.Lock()
+		err := sendDigest(target.notify, target.appName, target.scraper.Store(), "")
+		writer.Unlock()
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
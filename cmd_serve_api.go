@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"github.com/kevincobain2000/go-app-reviews-scraper/services"
+)
+
+// runServeAPI serves the stored reviews as a JSON REST API, see @services.API
+// The API requires one of API_KEYS of the env, and the spec is served at /api/openapi.json
+// With -config the apps of the config file can be scraped by the API, see @serveApp
+// On SIGINT or SIGTERM it stops accepting requests, and the scrapes that are running are finished before it exits
+// Example: go-app-reviews-scraper serve-api -addr=:8080 -config=apps.yaml
+func runServeAPI(args []string) error {
+	fs := flag.NewFlagSet("serve-api", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "Description: The address the API listens on")
+	configPath := fs.String("config", "", "Description: The config file of the apps, so that they can be scraped by the API. Optional")
+	rate := fs.Float64("rate", 1, "Description: The requests per second to each store host. 0 is no limit")
+	burst := fs.Int("burst", 2, "Description: The requests to each store host that can be sent at once")
+	openAPI := fs.Bool("openapi", false, "Description: Print the OpenAPI spec of the API and exit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *openAPI {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(services.OpenAPI())
+	}
+
+	keys := app.NewConfig().AppConfig.APIKeys
+	if len(keys) == 0 {
+		return fmt.Errorf("[error] API_KEYS is not set, the API requires at least one key")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	api := services.NewAPI(ctx, keys)
+	if *configPath != "" {
+		config, err := app.LoadAppsConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		targets, err := newAppTargets(config, services.NewRateLimitTransport(*rate, *burst, nil))
+		if err != nil {
+			return err
+		}
+		for _, target := range targets {
+			target.notify.SetContext(ctx)
+		}
+		var writer sync.Mutex
+		for _, a := range config.Apps {
+			appTargets := []appTarget{}
+			for _, target := range targets {
+				if target.appName == a.Name {
+					appTargets = append(appTargets, target)
+				}
+			}
+			api.Scrapers[a.Name] = func(ctx context.Context) error {
+				return serveApp(ctx, &writer, appTargets)
+			}
+		}
+	}
+
+	return listenAndServe(ctx, *addr, api, api)
+}
+
+// listenAndServe serves the handler on addr until ctx is done
+// It then stops accepting requests, and waits for the scrapes of the API that are running, if any, before it returns
+func listenAndServe(ctx context.Context, addr string, handler http.Handler, api *services.API) error {
+	server := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("[info] serving on %s\n", addr)
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return fmt.Errorf("[error] unable to serve on %s: %w", addr, err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Println("[warn] unable to stop serving:", err)
+	}
+	if api != nil {
+		api.Wait()
+	}
+	log.Printf("[info] stopped serving on %s\n", addr)
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"github.com/kevincobain2000/go-app-reviews-scraper/services"
+)
+
+// runTemplatePreview prints the notification of a stored review as it is rendered with the templates on the channel
+// without notifying, see @services.Templates
+// Example: go-app-reviews-scraper template-preview -review-id=12 -event=updated_review -channel=slack -templates=./templates
+func runTemplatePreview(args []string) error {
+	fs := flag.NewFlagSet("template-preview", flag.ExitOnError)
+	reviewID := fs.Int("review-id", 0, "Description: The id of the stored review. Required")
+	event := fs.String("event", services.TemplateNewReview, "Description: new_review, updated_review, rating, error or digest. The last three are of the app and the store of the review")
+	channel := fs.String("channel", services.ChannelConsole, "Description: The channel the notification is rendered for, eg. email or slack")
+	templatesDir := fs.String("templates", "", "Description: The dir of the templates. Default is NOTIFY_TEMPLATES of the env")
+	timezone := fs.String("timezone", "", "Description: The time zone of the dates, eg. Asia/Tokyo. Default is NOTIFY_TIMEZONE of the env")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *reviewID <= 0 {
+		return fmt.Errorf("[error] -review-id is required. See -h for help")
+	}
+
+	config := app.NewConfig().AppConfig
+	if *templatesDir == "" {
+		*templatesDir = config.NotifyTemplates
+	}
+	if *timezone == "" {
+		*timezone = config.NotifyTimezone
+	}
+	templates, err := services.LoadTemplates(*templatesDir, *timezone)
+	if err != nil {
+		return err
+	}
+	review, err := services.NewReviewsRepository().FindReview(*reviewID)
+	if err != nil {
+		return fmt.Errorf("[error] review %d is not found: %w", *reviewID, err)
+	}
+	data, err := services.NewTemplateData(*event, review)
+	if err != nil {
+		return err
+	}
+	rendered, ok, err := templates.Render(*channel, *event, data)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Printf("%s has no template of %s, it is sent in the layout of the channel\n", *channel, *event)
+		return nil
+	}
+	fmt.Printf("Title: %s\nSubject: %s\nSubtitle: %s\n\n%s\n", rendered.Title, rendered.Subject, rendered.Subtitle, rendered.Body)
+	return nil
+}
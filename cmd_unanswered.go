@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/services"
+)
+
+// runUnanswered prints the negative reviews without a developer reply, that are older than the given days
+// so that the support can track the response times
+// Example: go-app-reviews-scraper unanswered -days=3 -max-rating=2 -app-name="candy-crush"
+func runUnanswered(args []string) error {
+	fs := flag.NewFlagSet("unanswered", flag.ExitOnError)
+	days := fs.Int("days", 3, "Description: Only the reviews older than the days")
+	maxRating := fs.Int("max-rating", 2, "Description: Only the reviews with the rating or below")
+	appName := fs.String("app-name", "", "Description: Only the reviews of the app name. Default all the apps")
+	store := fs.String("store", "", "Description: Only the reviews of the store, ios or android. Default all the stores")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *days < 0 || *maxRating < 1 || *maxRating > 5 {
+		return fmt.Errorf("[error] -days must be 0 or more and -max-rating 1 to 5. See -h for help")
+	}
+
+	now := time.Now()
+	repo := services.NewReviewsRepository()
+	reviews, err := repo.FindUnansweredReviews(*appName, *store, *maxRating, now.AddDate(0, 0, -*days))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d unanswered reviews rated %d or below, older than %d days\n", len(reviews), *maxRating, *days)
+	if len(reviews) == 0 {
+		return nil
+	}
+	// the ID is the -review-id of the reply command
+	uu := services.NewUtils()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tAGE\tRATING\tAPP\tSTORE\tRATED AT\tUSERNAME\tTITLE")
+	for _, review := range reviews {
+		age := int(now.Sub(*review.RatedAt).Hours() / 24)
+		fmt.Fprintf(w, "%d\t%dd\t%s\t%s\t%s\t%s\t@%s\t%s\n",
+			review.ID,
+			age,
+			uu.Stars(review.Rating),
+			review.AppName,
+			review.Store,
+			review.RatedAt.Format("02-Jan-2006"),
+			review.Username,
+			review.Title,
+		)
+	}
+	return w.Flush()
+}
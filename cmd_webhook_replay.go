@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/services"
+)
+
+// runWebhookReplay sends the failed webhook deliveries again, as they were sent, see @services.WebhookNotifier
+// The delivery id is the id in the webhook_deliveries table, and all the failed ones are replayed without it
+// along with the ones left pending, eg. by a crash, see @services.WebhookDeliveriesRepository.FindFailedDeliveries
+// Example: go-app-reviews-scraper webhook-replay
+// Example: go-app-reviews-scraper webhook-replay -id=12
+func runWebhookReplay(args []string) error {
+	fs := flag.NewFlagSet("webhook-replay", flag.ExitOnError)
+	id := fs.Int("id", 0, "Description: The id of the delivery to replay. Default is all the failed deliveries, and the ones pending for an hour")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	repo := services.NewWebhookDeliveriesRepository()
+	deliveries := []services.WebhookDeliveryModel{}
+	if *id != 0 {
+		delivery, found, err := repo.FindDelivery(*id)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("[error] webhook delivery %d not found", *id)
+		}
+		deliveries = append(deliveries, delivery)
+	} else {
+		var err error
+		deliveries, err = repo.FindFailedDeliveries()
+		if err != nil {
+			return err
+		}
+	}
+
+	// the deliveries are sent as they were, so the URLs and the secret aren't needed
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	w := services.NewWebhookNotifier(nil, "")
+	failed := 0
+	for _, delivery := range deliveries {
+		if err := w.Replay(ctx, delivery); err != nil {
+			log.Println(err)
+			failed++
+			continue
+		}
+		log.Printf("[info] Replayed webhook delivery %d to %s\n", delivery.ID, delivery.URL)
+	}
+	log.Printf("[info] %d of %d webhook deliveries replayed\n", len(deliveries)-failed, len(deliveries))
+	if failed > 0 {
+		return fmt.Errorf("[error] %d of %d webhook deliveries failed", failed, len(deliveries))
+	}
+	return nil
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"time"
 
 	"github.com/kevincobain2000/go-app-reviews-scraper/app"
 	"github.com/kevincobain2000/go-app-reviews-scraper/services"
@@ -15,9 +19,33 @@ var (
 Description: Apple's link to reviews page. Example: https://apps.apple.com/us/app/candy-crush-saga/id553834731?see-all=reviews
 Description: Google's link reviews page. Example: https://play.google.com/store/apps/details?id=com.king.candycrushsaga&hl=en&gl=US
 	`)
-	migrate = flag.Bool("migrate", false, "Description: Run DB migration")
+	migrate      = flag.Bool("migrate", false, "Description: Run DB migration")
+	appleBackend = flag.String("apple-backend", services.AppleBackendHTML, "Description: Where to read App Store reviews from. html or feed (more reviews, falls back to html)")
+	metricsFile  = flag.String("metrics-file", "", "Description: Write the metrics of the run to the file, for the textfile collector of node_exporter. Example: /var/lib/node_exporter/candy-crush.prom")
 )
 
+// metrics are of every app saved by this process, see @saveApp
+var metrics = services.NewMetrics()
+
+// commands are the subcommands, run as go-app-reviews-scraper <command> [flags]
+// Each command has its own flags, see go-app-reviews-scraper <command> -h
+// Without a command the reviews are scraped with the flags above
+var commands = map[string]func(args []string) error{
+	"unanswered":       runUnanswered,
+	"reply":            runReply,
+	"run-all":          runAll,
+	"serve":            runServe,
+	"daemon":           runServe,
+	"webhook-replay":   runWebhookReplay,
+	"rules-dry-run":    runRulesDryRun,
+	"digest":           runDigest,
+	"template-preview": runTemplatePreview,
+	"serve-api":        runServeAPI,
+	"dashboard":        runDashboard,
+	"feed":             runFeed,
+	"export":           runExport,
+}
+
 // main execution starts here for the command line interface
 // sets env
 // runs migrations
@@ -30,6 +58,16 @@ func main() {
 	// set env and flags
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 	app.SetEnv()
+
+	// run the subcommand if given
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
 	flag.Parse()
 
 	// print cli args
@@ -50,107 +88,220 @@ func main() {
 		log.Fatal("[fatal] Missing required flags. See -h for help.")
 	}
 
-	// prepare services and repositories
-	uu := services.NewUtils()
-	sa := services.NewSurfAppStore()
-	sg := services.NewSurfGoogleStore(100000) // surf everything
-
-	// end prepare services and repositories
+	// App Store reviews from the feed, registering replaces the default html scraper
+	switch *appleBackend {
+	case services.AppleBackendHTML:
+	case services.AppleBackendFeed:
+		sa := services.NewSurfAppStore()
+		sa.Backend = *appleBackend
+		services.RegisterScraper(sa)
+	default:
+		log.Fatal("[fatal] Unknown -apple-backend. See -h for help.")
+	}
 
-	// parse reviews url and get store
-	store, err := uu.GetStoreFromURL(*reviewsURL)
+	// parse reviews url and get the registered scraper for its store
+	scraper, err := services.FindScraper(*reviewsURL)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	// create reviews object where reviews are going to be stored
-	var reviews services.Reviews
-
-	fmt.Println("[info] Started browser to scrape")
-	if store == services.StoreIOS {
-		reviews, err = sa.Surf(*reviewsURL)
+	nn, err := services.NewNotify(app.NotifyEntry{})
+	if err != nil {
+		log.Fatal(err)
 	}
-	if store == services.StoreAndroid {
-		reviews, err = sg.Surf(*reviewsURL)
+	err = runApp(context.Background(), *appName, scraper, []string{*reviewsURL}, nn)
+	if *metricsFile != "" {
+		if err := metrics.WriteFile(*metricsFile); err != nil {
+			log.Println(err)
+		}
 	}
 	if err != nil {
 		log.Fatal(err)
 	}
-	reviews.AppName = *appName
-	reviews.Store = store
-	if reviews.Total == 0 {
-		log.Fatal("[fatal] No reviews found, or something went wrong during fetching")
+	log.Println("[info] Finished!")
+}
+
+// scrapeResult is the reviews scraped from one of the urls of an app, see @scrapeURL
+// errType is the type of err for the metrics, see @services.MetricsRun
+type scrapeResult struct {
+	urlStr   string
+	reviews  services.Reviews
+	err      error
+	errType  string
+	duration time.Duration
+}
+
+// runApp scrapes the reviews of the app from the urls of a store, saves them to DB and notifies with nn
+// see @scrapeURL and @saveApp
+func runApp(ctx context.Context, appName string, scraper services.Scraper, urls []string, nn *services.Notify) error {
+	results := []scrapeResult{}
+	for _, urlStr := range urls {
+		results = append(results, scrapeURL(ctx, scraper, urlStr))
+	}
+	return saveApp(appName, scraper.Store(), results, nn)
+}
+
+// scrapeURL scrapes the reviews from the url
+// No reviews at all is an error, as something went wrong during fetching
+// The reviews without the overall ratings are not, eg. of the App Store feed when the HTML page failed
+// It doesn't touch the DB, so it can be run concurrently
+func scrapeURL(ctx context.Context, scraper services.Scraper, urlStr string) scrapeResult {
+	log.Println("[info] Started browser to scrape", urlStr)
+	start := time.Now()
+	reviews, err := scraper.Surf(ctx, urlStr)
+	result := scrapeResult{urlStr: urlStr, reviews: reviews, err: err, duration: time.Since(start)}
+	switch {
+	case err != nil:
+		result.errType = services.MetricsErrorScrape
+	case reviews.Total == 0 && len(reviews.Items) == 0:
+		result.err = fmt.Errorf("[error] No reviews found, or something went wrong during fetching %s", urlStr)
+		result.errType = services.MetricsErrorNoReviews
+	}
+	if result.err != nil {
+		log.Println(result.err)
+	}
+	return result
+}
+
+// saveApp saves the scraped reviews of the app on the store to DB and notifies with nn
+// The reviews of all the urls, eg. of each country, are saved as the one app on the store
+// and the overall ratings are of the first url that was scraped with them, when none was the review count isn't saved
+// returns an error when any of the urls couldn't be scraped, the reviews of the other urls are still saved
+// The errors of scraping and saving are notified too, see @services.Notify.NotifyError
+// The run is observed by the metrics, see @services.Metrics.Observe
+func saveApp(appName, store string, results []scrapeResult, nn *services.Notify) error {
+	uu := services.NewUtils()
+	reviews := services.Reviews{}
+	seen := map[string]bool{}
+	errs := []error{}
+	run := services.MetricsRun{AppName: appName, Store: store}
+	defer func() {
+		metrics.Observe(run)
+	}()
+	for _, result := range results {
+		run.Duration += result.duration
+		if result.err != nil {
+			errs = append(errs, result.err)
+			run.Errors = append(run.Errors, result.errType)
+			continue
+		}
+		if reviews.Total == 0 {
+			reviews.ReviewsSummary = result.reviews.ReviewsSummary
+		}
+		country, language := uu.GetLocale(result.urlStr)
+		// same review can be shown in more than one language
+		for _, item := range result.reviews.Items {
+			if item.ExternalID != "" {
+				if seen[item.ExternalID] {
+					continue
+				}
+				seen[item.ExternalID] = true
+			}
+			item.Country, item.Language = country, language
+			reviews.Items = append(reviews.Items, item)
+		}
 	}
+	if len(errs) == len(results) {
+		return notifyError(nn, appName, store, errors.Join(errs...))
+	}
+	reviews.AppName = appName
+	reviews.Store = store
+	run.Summary = reviews.ReviewsSummary
 
 	// handle database
-	newReviews, lastReviewCount, currentReviewCount, err := handleDB(reviews)
+	newReviews, editedReviews, lastReviewCount, currentReviewCount, err := handleDB(reviews)
 	if err != nil {
-		log.Fatal(err)
+		run.Errors = append(run.Errors, services.MetricsErrorDB)
+		return notifyError(nn, appName, store, err)
 	}
+	run.NewReviews = len(newReviews)
 	// handle notifications
-	if err := handleNotification(newReviews, lastReviewCount, currentReviewCount); err != nil {
-		log.Fatal(err)
+	nn.BeginRun(services.NotifyRun{AppName: appName, Store: store, URL: reviewsURLOf(results)})
+	log.Printf("[info] %d new and %d edited reviews of %s on %s\n", len(newReviews), len(editedReviews), appName, store)
+	err = handleNotification(nn, appName, store, lastReviewCount, currentReviewCount)
+	// the channels send what they kept until the end of the run, eg. the email digest
+	if err := errors.Join(err, nn.EndRun()); err != nil {
+		run.Errors = append(run.Errors, services.MetricsErrorNotify)
+		return err
 	}
-	log.Println("[info] Finished!")
+	return notifyError(nn, appName, store, errors.Join(errs...))
 }
 
-func handleDB(reviews services.Reviews) ([]services.ReviewModel, services.ReviewCountsModel, services.ReviewCountsModel, error) {
+// reviewsURLOf returns the first url that was scraped
+func reviewsURLOf(results []scrapeResult) string {
+	for _, result := range results {
+		if result.err == nil {
+			return result.urlStr
+		}
+	}
+	return ""
+}
+
+// notifyError notifies the error of the app on the store, when there is one, and returns it
+// The notification failing is only logged, as the error is returned regardless
+func notifyError(nn *services.Notify, appName, store string, err error) error {
+	if err == nil {
+		return nil
+	}
+	_ = nn.NotifyError(appName, store, err)
+	return err
+}
+
+func handleDB(reviews services.Reviews) ([]services.ReviewModel, []services.ReviewEdit, services.ReviewCountsModel, services.ReviewCountsModel, error) {
 	repo := services.NewReviewsRepository()
 	// Start procedure to update database
 
 	// 1) from the scraped reviews, check if the reviews are in DB
 	//    if not then insert the newly scraped reviews
 	//    return is the new reviews that are inserted
-	newReviews, err := repo.FindOrNewReviews(reviews)
+	//    and the reviews edited by the users, that are updated with their previous version kept
+	newReviews, editedReviews, err := repo.FindOrNewReviews(reviews)
 	if err != nil {
 		log.Println(err)
-		return nil, services.ReviewCountsModel{}, services.ReviewCountsModel{}, err
+		return nil, nil, services.ReviewCountsModel{}, services.ReviewCountsModel{}, err
 	}
 
 	// 2) Get the last review count summary from DB
 	lastReviewCount, err := repo.FindLastReviewCount(reviews)
 	if err != nil {
 		log.Println(err)
-		return nil, services.ReviewCountsModel{}, services.ReviewCountsModel{}, err
+		return nil, nil, services.ReviewCountsModel{}, services.ReviewCountsModel{}, err
 	}
 
 	// 3) Only insert the newly scaped reviews summary if there is no difference
 	//    when there is no diff then the last review summary is returned
+	//    without the summary, eg. the store page failed, the last one is kept as it is
+	if reviews.Total == 0 {
+		log.Printf("[warn] No overall ratings of %s on %s, the review count isn't saved\n", reviews.AppName, reviews.Store)
+		return newReviews, editedReviews, lastReviewCount, lastReviewCount, nil
+	}
 	currentReviewCount, err := repo.FindOrNewReviewCount(reviews)
 	if err != nil {
 		log.Println(err)
-		return nil, services.ReviewCountsModel{}, services.ReviewCountsModel{}, err
+		return nil, nil, services.ReviewCountsModel{}, services.ReviewCountsModel{}, err
 	}
 	if currentReviewCount.ID != 0 && currentReviewCount.ID != lastReviewCount.ID {
 		// we have new rating summary since last scraped
 		currentReviewCount, err = repo.InsertReviewCount(reviews)
 		if err != nil {
 			log.Println(err)
-			return nil, services.ReviewCountsModel{}, services.ReviewCountsModel{}, err
+			return nil, nil, services.ReviewCountsModel{}, services.ReviewCountsModel{}, err
 		}
 	}
-	return newReviews, lastReviewCount, currentReviewCount, err
+	return newReviews, editedReviews, lastReviewCount, currentReviewCount, err
 }
 
-func handleNotification(newReviews []services.ReviewModel, lastReviewCount services.ReviewCountsModel, currentReviewCount services.ReviewCountsModel) error {
-	nn := services.NewNotify()
-
+func handleNotification(nn *services.Notify, appName, store string, lastReviewCount services.ReviewCountsModel, currentReviewCount services.ReviewCountsModel) error {
+	// every channel is notified even when another one fails, and their errors are logged by nn
+	errs := []error{}
 	// 4) Check if a new review count summary is created or just using previous one
 	//   Use it for the notification purpose
 	if currentReviewCount.ID != 0 && currentReviewCount.ID != lastReviewCount.ID {
 		// we have new rating summary since last scraped
-		err := nn.NotifyReviewCount(currentReviewCount, lastReviewCount)
-		if err != nil {
-			log.Println(err)
-			return err
-		}
+		errs = append(errs, nn.NotifyReviewCount(currentReviewCount, lastReviewCount))
 	}
 
-	// 5) Notify on new reviews if any
-	err := nn.NotifyNewReviews(newReviews)
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-	return err
+	// 5) Notify on new reviews and on reviews edited by the users, if any
+	//    that weren't delivered yet, including those of the previous runs that failed halfway
+	errs = append(errs, nn.NotifyUndelivered(appName, store))
+	return errors.Join(errs...)
 }
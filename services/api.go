@@ -0,0 +1,368 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Pagination of the reviews of the API
+const (
+	APIDefaultPerPage = 50
+	APIMaxPerPage     = 500
+)
+
+// API serves the stored reviews and rating summaries as JSON, see @OpenAPI for the endpoints
+// Every endpoint but the spec requires one of the Keys, as Authorization: Bearer <key> or X-API-Key: <key>
+type API struct {
+	// Keys are the API keys, the API refuses every request without them
+	Keys []string
+	// Open serves every request without a key, for the dashboard on a trusted network, see @NewDashboard
+	Open bool
+	// Scrapers scrape an app now, by its name, see @API.scrape
+	// The apps without one can't be scraped by the API
+	Scrapers map[string]func(ctx context.Context) error
+
+	mux *http.ServeMux
+	// ctx is of the scrapes, which run after the request that started them
+	ctx context.Context
+	wg  sync.WaitGroup
+	mu  sync.Mutex
+	// scraping are the apps being scraped, so that an app isn't scraped twice at once
+	scraping map[string]bool
+}
+
+// NewAPI creates a new API with the keys, its scrapes are stopped when ctx is done
+func NewAPI(ctx context.Context, keys []string) *API {
+	a := &API{
+		Keys:     keys,
+		Scrapers: map[string]func(ctx context.Context) error{},
+		mux:      http.NewServeMux(),
+		ctx:      ctx,
+		scraping: map[string]bool{},
+	}
+	a.mux.HandleFunc("GET /api/openapi.json", a.openAPI)
+	a.mux.Handle("GET /api/apps", a.auth(a.apps))
+	a.mux.Handle("GET /api/apps/{app}/ratings", a.auth(a.ratings))
+	a.mux.Handle("POST /api/apps/{app}/scrape", a.auth(a.scrape))
+	a.mux.Handle("GET /api/reviews", a.auth(a.reviews))
+	a.mux.Handle("GET /api/reviews/{id}", a.auth(a.review))
+	a.mux.Handle("GET /api/apps/{app}/reviews.atom", a.feedAuth(a.feed(FeedAtom)))
+	a.mux.Handle("GET /api/apps/{app}/reviews.rss", a.feedAuth(a.feed(FeedRSS)))
+	return a
+}
+
+// ServeHTTP see @http.Handler
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+// Wait waits for the scrapes that are running, eg. before exiting
+func (a *API) Wait() {
+	a.wg.Wait()
+}
+
+// APIPage is a page of the reviews
+type APIPage struct {
+	Data    []ReviewModel `json:"data"`
+	Page    int           `json:"page"`
+	PerPage int           `json:"per_page"`
+	Total   int64         `json:"total"`
+}
+
+// APIReview is a review with its edits and the developer's reply
+type APIReview struct {
+	Review            ReviewModel             `json:"review"`
+	Revisions         []ReviewRevisionModel   `json:"revisions"`
+	DeveloperResponse *DeveloperResponseModel `json:"developer_response"`
+}
+
+// APIRating is a rating summary with its average rating
+type APIRating struct {
+	ReviewCountsModel
+	Average float64 `json:"average"`
+}
+
+// APIScrape is the scrape of an app that the API started
+type APIScrape struct {
+	AppName string `json:"app_name"`
+	Status  string `json:"status"`
+}
+
+// APIError is the response of a request that failed
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// auth refuses the requests without one of the Keys
+func (a *API) auth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.Open {
+			next(w, r)
+			return
+		}
+		key := r.Header.Get("X-API-Key")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			key = bearer
+		}
+		for _, k := range a.Keys {
+			if key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+				next(w, r)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		writeAPIError(w, http.StatusUnauthorized, "missing or unknown API key")
+	})
+}
+
+// feedAuth is @API.auth that also takes the key as the key parameter, as the feed readers can't set the headers
+func (a *API) feedAuth(next http.HandlerFunc) http.Handler {
+	auth := a.auth(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.URL.Query().Get("key"); key != "" && r.Header.Get("X-API-Key") == "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		auth.ServeHTTP(w, r)
+	})
+}
+
+func (a *API) openAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, OpenAPI())
+}
+
+func (a *API) apps(w http.ResponseWriter, r *http.Request) {
+	apps, err := NewReviewsRepository().FindApps()
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": apps})
+}
+
+func (a *API) reviews(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := ReviewsQuery{
+		AppName: q.Get("app_name"),
+		Store:   q.Get("store"),
+		Text:    q.Get("q"),
+		Page:    1,
+		PerPage: APIDefaultPerPage,
+	}
+	errs := []error{
+		parseAPIRatings(q, &query),
+		parseAPIInt(q, "page", &query.Page, 1, 0),
+		parseAPIInt(q, "per_page", &query.PerPage, 1, APIMaxPerPage),
+		parseAPIDate(q, "from", &query.From, false),
+		parseAPIDate(q, "to", &query.To, true),
+	}
+	if err := errors.Join(errs...); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	reviews, total, err := NewReviewsRepository().SearchReviews(query)
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, APIPage{Data: reviews, Page: query.Page, PerPage: query.PerPage, Total: total})
+}
+
+func (a *API) review(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeAPIError(w, http.StatusBadRequest, "id is not a review id")
+		return
+	}
+	repo := NewReviewsRepository()
+	review, err := repo.FindReview(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("review %d is not found", id))
+		return
+	}
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+	res := APIReview{Review: review}
+	res.Revisions, err = repo.FindReviewRevisions(id)
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+	response, found, err := repo.FindDeveloperResponse(id)
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+	if found {
+		res.DeveloperResponse = &response
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (a *API) ratings(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var from, to time.Time
+	if err := errors.Join(parseAPIDate(q, "from", &from, false), parseAPIDate(q, "to", &to, true)); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	counts, err := NewReviewsRepository().FindReviewCounts(r.PathValue("app"), q.Get("store"), from, to)
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+	uu := NewUtils()
+	ratings := []APIRating{}
+	for _, count := range counts {
+		ratings = append(ratings, APIRating{ReviewCountsModel: count, Average: uu.AverageRating(count)})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": ratings})
+}
+
+// feed serves the newest reviews of the app as the format, see @Feed
+func (a *API) feed(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		query := ReviewsQuery{AppName: r.PathValue("app"), Store: q.Get("store"), Text: q.Get("q")}
+		if err := parseAPIRatings(q, &query); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		feed, err := NewFeed(query, feedLink(r))
+		if err != nil {
+			writeAPIServerError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", FeedContentType(format))
+		if err := feed.Write(w, format); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// feedLink is the URL of the feed that was requested, without the key
+func feedLink(r *http.Request) string {
+	u := url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path}
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		u.Scheme = "https"
+	}
+	q := r.URL.Query()
+	q.Del("key")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// scrape starts the scrape of the app, and responds before it is done
+// An app that is being scraped isn't scraped again, and its scrape is reported as running
+func (a *API) scrape(w http.ResponseWriter, r *http.Request) {
+	appName := r.PathValue("app")
+	scraper, ok := a.Scrapers[appName]
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("app %s can't be scraped, it isn't in the config", appName))
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.scraping[appName] {
+		writeJSON(w, http.StatusConflict, APIScrape{AppName: appName, Status: "running"})
+		return
+	}
+	a.scraping[appName] = true
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		log.Printf("[info] scraping %s from the API\n", appName)
+		if err := scraper(a.ctx); err != nil {
+			log.Printf("[error] scraping %s from the API failed: %s\n", appName, err)
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		delete(a.scraping, appName)
+	}()
+	writeJSON(w, http.StatusAccepted, APIScrape{AppName: appName, Status: "started"})
+}
+
+// parseAPIRatings parses the rating, min_rating and max_rating parameters into the query
+// rating is the only rating, which is both the min and the max
+func parseAPIRatings(q url.Values, query *ReviewsQuery) error {
+	errs := []error{
+		parseAPIInt(q, "min_rating", &query.MinRating, 1, 5),
+		parseAPIInt(q, "max_rating", &query.MaxRating, 1, 5),
+	}
+	if rating := q.Get("rating"); rating != "" {
+		errs = append(errs, parseAPIInt(q, "rating", &query.MinRating, 1, 5))
+		query.MaxRating = query.MinRating
+	}
+	return errors.Join(errs...)
+}
+
+// parseAPIInt parses the int parameter, from lowest to highest, 0 highest is no maximum
+// The value is kept when the parameter isn't set
+func parseAPIInt(q url.Values, name string, value *int, lowest, highest int) error {
+	s := q.Get(name)
+	if s == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < lowest || (highest > 0 && n > highest) {
+		if highest > 0 {
+			return fmt.Errorf("%s must be %d to %d", name, lowest, highest)
+		}
+		return fmt.Errorf("%s must be %d or more", name, lowest)
+	}
+	*value = n
+	return nil
+}
+
+// parseAPIDate parses the date parameter, 2006-01-02 or RFC3339
+// A day that ends the range is until the end of the day
+func parseAPIDate(q url.Values, name string, value *time.Time, end bool) error {
+	s := q.Get(name)
+	if s == "" {
+		return nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		*value = t
+		return nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+	if err != nil {
+		return fmt.Errorf("%s must be a date, eg. 2006-01-02 or 2006-01-02T15:04:05Z", name)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	*value = t
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("[error] unable to write the response:", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, APIError{Error: message})
+}
+
+// writeAPIServerError logs the error, which isn't shown to the client
+func writeAPIServerError(w http.ResponseWriter, err error) {
+	log.Println("[error] API request failed:", err)
+	writeAPIError(w, http.StatusInternalServerError, "internal server error")
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// apiGet requests the API with the key, and decodes the JSON response into v
+func apiGet(t *testing.T, api *API, method, path, key string, v interface{}) int {
+	req := httptest.NewRequest(method, path, nil)
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	if v != nil {
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), v), w.Body.String())
+	}
+	return w.Code
+}
+
+func TestAPI(t *testing.T) {
+	repo := NewReviewsRepository()
+	now := time.Now()
+	reviews := Reviews{
+		AppName: "app-api",
+		Store:   StoreAndroid,
+		Items: []Review{
+			{ExternalID: "1", Username: "a", Title: "Crash", Body: "It crashes", Rating: 1, RatedAt: now.AddDate(0, 0, -2)},
+			{ExternalID: "2", Username: "b", Title: "Fun", Body: "So fun", Rating: 5, RatedAt: now.AddDate(0, 0, -1)},
+		},
+		ReviewsSummary: ReviewsSummary{Total: 2, Rating5Percentage: 50, Rating1Percentage: 50},
+	}
+	found, _, err := repo.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	_, err = repo.SaveDeveloperResponse(found[0].ID, "Fixed in 1.2", time.Time{})
+	assert.Nil(t, err)
+	_, err = repo.InsertReviewCount(reviews)
+	assert.Nil(t, err)
+	api := NewAPI(context.Background(), []string{"secret"})
+
+	// the key is required, but of the spec
+	assert.Equal(t, http.StatusUnauthorized, apiGet(t, api, http.MethodGet, "/api/apps", "", nil))
+	assert.Equal(t, http.StatusUnauthorized, apiGet(t, api, http.MethodGet, "/api/apps", "wrong", nil))
+	req := httptest.NewRequest(http.MethodGet, "/api/apps", nil)
+	req.Header.Set("X-API-Key", "secret")
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	spec := map[string]interface{}{}
+	assert.Equal(t, http.StatusOK, apiGet(t, api, http.MethodGet, "/api/openapi.json", "", &spec))
+	assert.Equal(t, "3.0.3", spec["openapi"])
+
+	apps := struct{ Data []AppSummary }{}
+	assert.Equal(t, http.StatusOK, apiGet(t, api, http.MethodGet, "/api/apps", "secret", &apps))
+	for _, app := range apps.Data {
+		if app.AppName == "app-api" {
+			assert.Equal(t, int64(2), app.Reviews)
+			assert.True(t, found[1].RatedAt.Equal(*app.LastRatedAt))
+			assert.Equal(t, 2, app.Total)
+			assert.Equal(t, 3.0, app.Average)
+		}
+	}
+
+	page := APIPage{}
+	assert.Equal(t, http.StatusOK, apiGet(t, api, http.MethodGet, "/api/reviews?app_name=app-api", "secret", &page))
+	assert.Equal(t, int64(2), page.Total)
+	assert.Equal(t, APIDefaultPerPage, page.PerPage)
+	assert.Equal(t, "Fun", page.Data[0].Title)
+	assert.Equal(t, http.StatusOK, apiGet(t, api, http.MethodGet, "/api/reviews?app_name=app-api&rating=1&q=CRASH&to="+now.Format(time.DateOnly), "secret", &page))
+	assert.Equal(t, int64(1), page.Total)
+	assert.Equal(t, "Crash", page.Data[0].Title)
+	assert.Equal(t, http.StatusOK, apiGet(t, api, http.MethodGet, "/api/reviews?app_name=app-api&per_page=1&page=2", "secret", &page))
+	assert.Equal(t, 1, len(page.Data))
+	assert.Equal(t, "Crash", page.Data[0].Title)
+	apiErr := APIError{}
+	assert.Equal(t, http.StatusBadRequest, apiGet(t, api, http.MethodGet, "/api/reviews?rating=6&from=yesterday", "secret", &apiErr))
+	assert.Contains(t, apiErr.Error, "rating must be 1 to 5")
+	assert.Contains(t, apiErr.Error, "from must be a date")
+
+	review := APIReview{}
+	assert.Equal(t, http.StatusOK, apiGet(t, api, http.MethodGet, "/api/reviews/"+strconv.Itoa(found[0].ID), "secret", &review))
+	assert.Equal(t, "Crash", review.Review.Title)
+	assert.Equal(t, "Fixed in 1.2", review.DeveloperResponse.Body)
+	assert.Empty(t, review.Revisions)
+	assert.Equal(t, http.StatusNotFound, apiGet(t, api, http.MethodGet, "/api/reviews/999999", "secret", &apiErr))
+	assert.Equal(t, http.StatusBadRequest, apiGet(t, api, http.MethodGet, "/api/reviews/abc", "secret", &apiErr))
+
+	ratings := struct{ Data []APIRating }{}
+	assert.Equal(t, http.StatusOK, apiGet(t, api, http.MethodGet, "/api/apps/app-api/ratings?store=android", "secret", &ratings))
+	assert.Equal(t, 1, len(ratings.Data))
+	assert.Equal(t, 2, ratings.Data[0].Total)
+	assert.Equal(t, 3.0, ratings.Data[0].Average)
+
+	// the feed readers can give the key as a parameter, which isn't in the link of the feed
+	req = httptest.NewRequest(http.MethodGet, "/api/apps/app-api/reviews.rss?store=android&max_rating=2&key=secret", nil)
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, FeedContentType(FeedRSS), w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<title>★☆☆☆☆ Crash</title>")
+	assert.NotContains(t, w.Body.String(), "Fun")
+	assert.Contains(t, w.Body.String(), "<link>http://example.com/api/apps/app-api/reviews.rss?max_rating=2&amp;store=android</link>")
+	assert.Equal(t, http.StatusUnauthorized, apiGet(t, api, http.MethodGet, "/api/apps/app-api/reviews.atom?key=wrong", "", nil))
+	assert.Equal(t, http.StatusBadRequest, apiGet(t, api, http.MethodGet, "/api/apps/app-api/reviews.atom?rating=0", "secret", &apiErr))
+	req = httptest.NewRequest(http.MethodGet, "/api/apps/app-api/reviews.atom", nil)
+	req.Header.Set("X-API-Key", "secret")
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<feed xmlns="http://www.w3.org/2005/Atom">`)
+}
+
+func TestAPIScrape(t *testing.T) {
+	api := NewAPI(context.Background(), []string{"secret"})
+	started := make(chan bool)
+	done := make(chan bool)
+	api.Scrapers["app-api"] = func(ctx context.Context) error {
+		started <- true
+		<-done
+		return nil
+	}
+
+	scrape := APIScrape{}
+	assert.Equal(t, http.StatusNotFound, apiGet(t, api, http.MethodPost, "/api/apps/other/scrape", "secret", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, apiGet(t, api, http.MethodGet, "/api/apps/app-api/scrape", "secret", nil))
+	assert.Equal(t, http.StatusAccepted, apiGet(t, api, http.MethodPost, "/api/apps/app-api/scrape", "secret", &scrape))
+	assert.Equal(t, APIScrape{AppName: "app-api", Status: "started"}, scrape)
+	<-started
+
+	// it isn't scraped twice at once
+	assert.Equal(t, http.StatusConflict, apiGet(t, api, http.MethodPost, "/api/apps/app-api/scrape", "secret", &scrape))
+	assert.Equal(t, "running", scrape.Status)
+	close(done)
+	api.Wait()
+	assert.Equal(t, http.StatusAccepted, apiGet(t, api, http.MethodPost, "/api/apps/app-api/scrape", "secret", &scrape))
+	<-started
+	api.Wait()
+}
+
+func TestOpenAPI(t *testing.T) {
+	spec := OpenAPI()
+	b, err := json.Marshal(spec)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"/api/reviews/{id}"`)
+
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	review := schemas["Review"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "integer"}, review["rating"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "format": "date-time", "nullable": true}, review["rated_at"])
+	// the embedded rating summary is flattened, as in the JSON
+	rating := schemas["Rating"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "number"}, rating["average"])
+	assert.Equal(t, map[string]interface{}{"type": "integer"}, rating["total"])
+	detail := schemas["ReviewDetail"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"$ref": "#/components/schemas/Review"}, detail["review"])
+	assert.Equal(t, map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/components/schemas/ReviewRevision"}}, detail["revisions"])
+}
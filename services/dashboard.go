@@ -0,0 +1,23 @@
+package services
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed dashboard/*
+var dashboardFiles embed.FS
+
+// NewDashboard returns the web UI of the stored reviews, along with the API that it reads them from, see @API
+// The UI is served at / and the API at /api/, and the UI asks for a key when the API requires one
+func NewDashboard(api *API) http.Handler {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/api/", api)
+	mux.Handle("/", http.FileServerFS(files))
+	return mux
+}
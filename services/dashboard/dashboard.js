@@ -0,0 +1,252 @@
+// The dashboard reads the stored reviews from the API of the binary, see services/api.go
+"use strict";
+
+const STORES = { ios: "iOS", android: "Android" };
+const PER_PAGE = 20;
+
+const state = { apps: [], page: 1 };
+const $ = (id) => document.getElementById(id);
+
+// api gets the JSON of the path, and asks for the key when the API requires one
+async function api(path, params) {
+  const query = new URLSearchParams();
+  for (const [name, value] of Object.entries(params || {})) {
+    if (value !== "" && value !== undefined && value !== null) {
+      query.set(name, value);
+    }
+  }
+  const headers = {};
+  const key = localStorage.getItem("apiKey");
+  if (key) {
+    headers["X-API-Key"] = key;
+  }
+  const res = await fetch("api/" + path + (query.toString() ? "?" + query : ""), { headers });
+  if (res.status === 401) {
+    $("key").hidden = false;
+    throw new Error("the API key is missing or unknown");
+  }
+  const body = await res.json();
+  if (!res.ok) {
+    throw new Error(body.error || res.statusText);
+  }
+  return body;
+}
+
+function showError(err) {
+  $("error").textContent = "[error] " + err.message;
+  $("error").hidden = false;
+}
+
+function stars(rating) {
+  return "★".repeat(rating) + "☆".repeat(5 - rating);
+}
+
+function formatDate(value) {
+  return value ? new Date(value).toLocaleDateString() : "-";
+}
+
+// el creates an element with the text, never as HTML as the reviews are written by anyone
+function el(tag, className, text) {
+  const e = document.createElement(tag);
+  if (className) {
+    e.className = className;
+  }
+  if (text !== undefined) {
+    e.textContent = text;
+  }
+  return e;
+}
+
+// dateRange is the date range of the header, for the params of the API
+function dateRange() {
+  return { from: $("from").value, to: $("to").value };
+}
+
+async function loadApps() {
+  state.apps = (await api("apps")).data;
+  const names = [...new Set(state.apps.map((a) => a.app_name))].sort();
+  const select = $("app");
+  select.replaceChildren(...names.map((name) => el("option", "", name)));
+  const saved = new URLSearchParams(location.search).get("app");
+  if (saved && names.includes(saved)) {
+    select.value = saved;
+  }
+}
+
+// renderStores compares the stores of the app side by side, with the latest rating summary of each
+function renderStores(ratings) {
+  const app = $("app").value;
+  const cards = state.apps
+    .filter((a) => a.app_name === app)
+    .map((a) => {
+      const card = el("div", "store " + a.store);
+      card.append(el("h3", "", STORES[a.store] || a.store));
+      const latest = ratings.filter((r) => r.store === a.store).pop();
+      const dl = el("dl");
+      const row = (name, value) => dl.append(el("dt", "", name), el("dd", "", value));
+      row("Average rating", a.total ? a.average.toFixed(2) + " " + stars(Math.round(a.average)) : "-");
+      row("Total reviews", a.total ? a.total.toLocaleString() : "-");
+      row("Stored reviews", a.reviews.toLocaleString());
+      row("Latest review", formatDate(a.last_rated_at));
+      card.append(dl);
+      if (latest) {
+        const bars = el("dl");
+        for (let rating = 5; rating >= 1; rating--) {
+          const percentage = latest["rating_" + rating + "_percentage"];
+          const dd = el("dd");
+          const bar = el("span", "bar");
+          bar.style.width = percentage + "%";
+          dd.append(bar, " " + percentage + "%");
+          bars.append(el("dt", "", stars(rating)), dd);
+        }
+        card.append(el("h4", "", "Ratings"), bars);
+      }
+      return card;
+    });
+  $("stores").replaceChildren(...(cards.length ? cards : [el("p", "muted", "No reviews of the app yet")]));
+}
+
+// renderChart draws a line of each store, of the value of the rating summaries over time
+function renderChart(svg, ratings, value, format) {
+  const W = 600, H = 220, left = 50, right = 10, top = 10, bottom = 30;
+  const ns = "http://www.w3.org/2000/svg";
+  const node = (tag, attrs, text) => {
+    const n = document.createElementNS(ns, tag);
+    for (const [k, v] of Object.entries(attrs)) {
+      n.setAttribute(k, v);
+    }
+    if (text !== undefined) {
+      n.textContent = text;
+    }
+    return n;
+  };
+  svg.replaceChildren();
+  const points = ratings.filter((r) => r.created_at);
+  if (points.length === 0) {
+    svg.append(node("text", { x: W / 2, y: H / 2, "text-anchor": "middle" }, "No rating summaries in the range"));
+    return;
+  }
+  const times = points.map((r) => new Date(r.created_at).getTime());
+  const values = points.map(value);
+  let minT = Math.min(...times), maxT = Math.max(...times);
+  let minV = Math.min(...values), maxV = Math.max(...values);
+  if (minT === maxT) {
+    minT -= 86400000;
+    maxT += 86400000;
+  }
+  if (minV === maxV) {
+    minV -= 1;
+    maxV += 1;
+  }
+  const x = (t) => left + ((t - minT) / (maxT - minT)) * (W - left - right);
+  const y = (v) => top + (1 - (v - minV) / (maxV - minV)) * (H - top - bottom);
+
+  for (let i = 0; i <= 4; i++) {
+    const v = minV + ((maxV - minV) * i) / 4;
+    svg.append(node("line", { class: "grid", x1: left, x2: W - right, y1: y(v), y2: y(v) }));
+    svg.append(node("text", { x: left - 6, y: y(v) + 4, "text-anchor": "end" }, format(v)));
+  }
+  svg.append(node("text", { x: left, y: H - 8 }, new Date(minT).toLocaleDateString()));
+  svg.append(node("text", { x: W - right, y: H - 8, "text-anchor": "end" }, new Date(maxT).toLocaleDateString()));
+
+  for (const store of Object.keys(STORES)) {
+    const line = points
+      .filter((r) => r.store === store)
+      .map((r) => x(new Date(r.created_at).getTime()).toFixed(1) + "," + y(value(r)).toFixed(1));
+    if (line.length === 1) {
+      const [cx, cy] = line[0].split(",");
+      svg.append(node("circle", { class: store, cx, cy, r: 3 }));
+    } else if (line.length > 1) {
+      svg.append(node("polyline", { class: store, points: line.join(" ") }));
+    }
+  }
+}
+
+async function loadRatings() {
+  const ratings = (await api("apps/" + encodeURIComponent($("app").value) + "/ratings", dateRange())).data;
+  renderStores(ratings);
+  renderChart($("chart-average"), ratings, (r) => r.average, (v) => v.toFixed(2));
+  renderChart($("chart-total"), ratings, (r) => r.total, (v) => Math.round(v).toLocaleString());
+}
+
+async function loadReviews() {
+  const page = await api("reviews", {
+    app_name: $("app").value,
+    store: $("store").value,
+    rating: $("rating").value,
+    q: $("q").value.trim(),
+    page: state.page,
+    per_page: PER_PAGE,
+    ...dateRange(),
+  });
+  const items = page.data.map((r) => {
+    const li = el("li");
+    const head = el("div");
+    head.append(el("span", "stars", stars(r.rating)), " ", el("strong", "", r.title));
+    const meta = [STORES[r.store] || r.store, "@" + r.username, formatDate(r.rated_at)];
+    if (r.country) {
+      meta.push(r.country.toUpperCase());
+    }
+    li.append(head, el("div", "meta", meta.join(" · ")), el("p", "", r.body));
+    return li;
+  });
+  $("reviews").replaceChildren(...items);
+  const pages = Math.max(1, Math.ceil(page.total / PER_PAGE));
+  $("count").textContent = page.total.toLocaleString() + " reviews";
+  $("page").textContent = "Page " + state.page + " of " + pages;
+  $("prev").disabled = state.page <= 1;
+  $("next").disabled = state.page >= pages;
+}
+
+async function refresh() {
+  $("error").hidden = true;
+  try {
+    if ($("app").value) {
+      const url = new URL(location);
+      url.searchParams.set("app", $("app").value);
+      history.replaceState(null, "", url);
+      await Promise.all([loadRatings(), loadReviews()]);
+    }
+  } catch (err) {
+    showError(err);
+  }
+}
+
+async function start() {
+  $("error").hidden = true;
+  try {
+    await loadApps();
+    $("key").hidden = true;
+  } catch (err) {
+    showError(err);
+    return;
+  }
+  await refresh();
+}
+
+$("key").addEventListener("submit", (e) => {
+  e.preventDefault();
+  localStorage.setItem("apiKey", $("key-value").value);
+  start();
+});
+$("filters").addEventListener("submit", (e) => {
+  e.preventDefault();
+  state.page = 1;
+  refresh();
+});
+for (const id of ["app", "from", "to"]) {
+  $(id).addEventListener("change", () => {
+    state.page = 1;
+    refresh();
+  });
+}
+$("prev").addEventListener("click", () => {
+  state.page--;
+  loadReviews().catch(showError);
+});
+$("next").addEventListener("click", () => {
+  state.page++;
+  loadReviews().catch(showError);
+});
+
+start();
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDashboard(t *testing.T) {
+	get := func(h http.Handler, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	api := NewAPI(context.Background(), []string{"secret"})
+	dashboard := NewDashboard(api)
+	w := get(dashboard, "/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), `<script src="dashboard.js"></script>`)
+	for _, path := range []string{"/dashboard.js", "/dashboard.css"} {
+		assert.Equal(t, http.StatusOK, get(dashboard, path).Code, path)
+	}
+	assert.Equal(t, http.StatusNotFound, get(dashboard, "/missing.js").Code)
+
+	// the API is served along, with its keys
+	assert.Equal(t, http.StatusUnauthorized, get(dashboard, "/api/apps").Code)
+	api.Open = true
+	assert.Equal(t, http.StatusOK, get(dashboard, "/api/apps").Code)
+	assert.Equal(t, http.StatusOK, get(dashboard, "/api/reviews?store=ios").Code)
+}
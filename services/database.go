@@ -2,13 +2,21 @@ package services
 
 import (
 	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"gorm.io/gorm"
 )
 
+// legacyExternalIDPrefix is the prefix of external_id for the backfilled legacy rows
+const legacyExternalIDPrefix = "legacy-"
+
 // AutoMigrate will auto migrate the database
 // This will not delete the data when ran again
 func AutoMigrate() {
 	db := app.NewDB()
-	err := db.AutoMigrate(&ReviewModel{})
+	err := migrateExternalIDs(db)
+	if err != nil {
+		panic(err)
+	}
+	err = db.AutoMigrate(&ReviewModel{})
 	if err != nil {
 		panic(err)
 	}
@@ -16,4 +24,46 @@ func AutoMigrate() {
 	if err != nil {
 		panic(err)
 	}
+	err = db.AutoMigrate(&ReviewRevisionModel{})
+	if err != nil {
+		panic(err)
+	}
+	err = db.AutoMigrate(&DeveloperResponseModel{})
+	if err != nil {
+		panic(err)
+	}
+	err = db.AutoMigrate(&WebhookDeliveryModel{})
+	if err != nil {
+		panic(err)
+	}
+	err = db.AutoMigrate(&NotificationModel{})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// migrateExternalIDs adds the external_id column to the reviews from before it existed
+// and backfills the legacy rows as legacy-{id}, so that the unique index on
+// (app_name, store, external_id) can be created without touching the existing rows
+// The legacy rows get their store review ID when they are scraped again, see @FindOrNewReviews
+func migrateExternalIDs(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&ReviewModel{}) {
+		return nil
+	}
+	if !migrator.HasColumn(&ReviewModel{}, "ExternalID") {
+		if err := migrator.AddColumn(&ReviewModel{}, "ExternalID"); err != nil {
+			return err
+		}
+	}
+
+	// legacy-{id} in one statement, the column only so that updated_at isn't touched
+	concat := "? || id"
+	if db.Dialector.Name() == "mysql" {
+		concat = "CONCAT(?, id)"
+	}
+	result := db.Model(&ReviewModel{}).
+		Where("external_id = ? OR external_id IS NULL", "").
+		UpdateColumn("external_id", gorm.Expr(concat, legacyExternalIDPrefix))
+	return result.Error
 }
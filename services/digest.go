@@ -0,0 +1,309 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Periods of a Digest
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// digestWorstReviews, digestEdits and digestTopWords are how many of each are in a digest
+const (
+	digestWorstReviews = 5
+	digestEdits        = 5
+	digestTopWords     = 10
+)
+
+// Digest is the summary of the reviews of an app on a store over a period, see @NewDigest
+// It is sent instead of a notification for each review, see @DigestNotifier
+type Digest struct {
+	AppName string    `json:"app_name"`
+	Store   string    `json:"store"`
+	Period  string    `json:"period"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	// Total is the number of the new reviews, first scraped in the period and rated within a period before
+	Total int `json:"total"`
+	// ByRating are the new reviews by their rating, 1 to 5 stars
+	ByRating [5]int `json:"by_rating"`
+	// Average is the average rating of the new reviews
+	Average float64 `json:"average"`
+	// Current is the rating summary at the end of the period, and Previous at its start
+	Current  ReviewCountsModel `json:"current"`
+	Previous ReviewCountsModel `json:"previous"`
+	// Worst are the lowest rated of the new reviews, 3 stars or below, lowest first
+	Worst []ReviewModel `json:"worst"`
+	// TopWords are the words that recur the most in the new reviews
+	TopWords []WordCount `json:"top_words"`
+	// Edited is the number of the edits of the reviews scraped in the period, and Edits are the last of them, oldest first
+	Edited int          `json:"edited"`
+	Edits  []ReviewEdit `json:"edits"`
+}
+
+// WordCount is a word and how many of the reviews it is in
+type WordCount struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+// DigestNotifier is a Notifier that can send a Digest
+// The channels that aren't are skipped, see @Notify.NotifyDigest
+type DigestNotifier interface {
+	NotifyDigest(digest Digest) error
+}
+
+// DigestPeriod returns how long the period is, daily or weekly
+func DigestPeriod(period string) (time.Duration, error) {
+	switch period {
+	case DigestDaily:
+		return 24 * time.Hour, nil
+	case DigestWeekly:
+		return 7 * 24 * time.Hour, nil
+	}
+	return 0, fmt.Errorf("[error] unknown digest %s, use daily or weekly", period)
+}
+
+// DefaultDigestSchedule returns the schedule of the digest, 9:00 every day, or on Monday for weekly
+func DefaultDigestSchedule(period string) string {
+	if period == DigestWeekly {
+		return "0 9 * * 1"
+	}
+	return "0 9 * * *"
+}
+
+// NewDigest builds the digest of the app on the store from DB, for the period until the time
+// The period is of when the reviews and their edits were scraped, so the digest has what was notified without it
+// The new reviews are also rated within the period before they were scraped, so the first scrape of an app isn't in it, see @IsNewReview
+func NewDigest(appName, store, period string, to time.Time) (Digest, error) {
+	d, err := DigestPeriod(period)
+	if err != nil {
+		return Digest{}, err
+	}
+	digest := Digest{AppName: appName, Store: store, Period: period, From: to.Add(-d), To: to}
+
+	repo := NewReviewsRepository()
+	reviews, err := repo.FindNewReviews(appName, store, digest.From, d)
+	if err != nil {
+		return digest, err
+	}
+	sum := 0
+	rated := []ReviewModel{}
+	for _, review := range reviews {
+		if review.CreatedAt.After(to) || review.Rating < 1 || review.Rating > 5 {
+			continue
+		}
+		rated = append(rated, review)
+		digest.Total++
+		digest.ByRating[review.Rating-1]++
+		sum += review.Rating
+		if review.Rating <= 3 {
+			digest.Worst = append(digest.Worst, review)
+		}
+	}
+	if digest.Total > 0 {
+		digest.Average = float64(sum) / float64(digest.Total)
+	}
+	sort.SliceStable(digest.Worst, func(i, j int) bool {
+		return digest.Worst[i].Rating < digest.Worst[j].Rating
+	})
+	if len(digest.Worst) > digestWorstReviews {
+		digest.Worst = digest.Worst[:digestWorstReviews]
+	}
+	digest.TopWords = topWords(rated, digestTopWords)
+
+	edits, err := repo.FindReviewEdits(appName, store, digest.From)
+	if err != nil {
+		return digest, err
+	}
+	for _, edit := range edits {
+		if !edit.Revision.RevisedAt.After(to) {
+			digest.Edits = append(digest.Edits, edit)
+		}
+	}
+	digest.Edited = len(digest.Edits)
+	if len(digest.Edits) > digestEdits {
+		digest.Edits = digest.Edits[len(digest.Edits)-digestEdits:]
+	}
+
+	if digest.Current, err = repo.FindReviewCountAt(appName, store, to); err != nil {
+		return digest, err
+	}
+	if digest.Previous, err = repo.FindReviewCountAt(appName, store, digest.From); err != nil {
+		return digest, err
+	}
+	return digest, nil
+}
+
+// AverageDelta is the change of the average rating of the app over the period
+// 0 when the rating summary isn't known at both ends
+func (d Digest) AverageDelta() float64 {
+	if d.Current.ID == 0 || d.Previous.ID == 0 {
+		return 0
+	}
+	uu := NewUtils()
+	return uu.AverageRating(d.Current) - uu.AverageRating(d.Previous)
+}
+
+// Title is the title of the digest, eg. Daily digest
+func (d Digest) Title() string {
+	if d.Period == DigestWeekly {
+		return "Weekly digest"
+	}
+	return "Daily digest"
+}
+
+// SummaryLines are the lines of the counts of the digest, the same on every channel
+func (d Digest) SummaryLines() []string {
+	lines := []string{fmt.Sprintf("%d new reviews, %s to %s", d.Total, d.From.Format("02-Jan-2006 15:04"), d.To.Format("02-Jan-2006 15:04"))}
+	if d.Total > 0 {
+		lines = append(lines, fmt.Sprintf("Average of the new reviews: %.2f", d.Average))
+	}
+	for rating := 5; rating >= 1; rating-- {
+		lines = append(lines, fmt.Sprintf("%s %d", stars(rating), d.ByRating[rating-1]))
+	}
+	if d.Current.ID != 0 {
+		line := fmt.Sprintf("Average rating: %.2f", NewUtils().AverageRating(d.Current))
+		if d.Previous.ID != 0 {
+			line += fmt.Sprintf(" (%+.2f)", d.AverageDelta())
+		}
+		lines = append(lines, line)
+	}
+	if d.Edited > 0 {
+		lines = append(lines, fmt.Sprintf("%d edited reviews", d.Edited))
+	}
+	return lines
+}
+
+// EditLine is the line of the edit of a review, eg. ★★★★★ → ★☆☆☆☆ Too many ads
+func EditLine(edit ReviewEdit) string {
+	return stars(edit.Revision.Rating) + " → " + stars(edit.Review.Rating) + " " + edit.Review.Title
+}
+
+// WordsLine is the line of the top words, eg. ads (4), crash (3)
+func (d Digest) WordsLine() string {
+	words := []string{}
+	for _, w := range d.TopWords {
+		words = append(words, fmt.Sprintf("%s (%d)", w.Word, w.Count))
+	}
+	return strings.Join(words, ", ")
+}
+
+// Markdown renders the digest in markdown, eg. for the console
+func (d Digest) Markdown() string {
+	lines := []string{
+		"# " + d.Title(),
+		"App (" + d.AppName + ") Store (" + d.Store + ")",
+		"",
+	}
+	for _, line := range d.SummaryLines() {
+		lines = append(lines, "- "+line)
+	}
+	if len(d.TopWords) > 0 {
+		lines = append(lines, "", "## Top words", "", d.WordsLine())
+	}
+	if len(d.Worst) > 0 {
+		lines = append(lines, "", "## Worst reviews")
+		for _, review := range d.Worst {
+			lines = append(lines,
+				"",
+				"### "+stars(review.Rating)+" "+escapeMarkdown(review.Title),
+				"@"+escapeMarkdown(review.Username)+" · "+formatDate(review.RatedAt),
+				"",
+				escapeMarkdown(review.Body),
+			)
+		}
+	}
+	if len(d.Edits) > 0 {
+		lines = append(lines, "", "## Edited reviews")
+		for _, edit := range d.Edits {
+			lines = append(lines,
+				"",
+				"### "+stars(edit.Revision.Rating)+" → "+stars(edit.Review.Rating)+" "+escapeMarkdown(edit.Review.Title),
+				"@"+escapeMarkdown(edit.Review.Username)+" · "+formatDate(edit.Revision.RevisedAt),
+				"",
+				escapeMarkdown(edit.Review.Body),
+			)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// digestChat is the digest as the content of the chat channels
+func digestChat(d Digest) chatContent {
+	content := chatContent{
+		Title:    d.Title(),
+		AppName:  d.AppName,
+		Store:    d.Store,
+		Sections: []chatSection{{Name: "New reviews", Lines: d.SummaryLines()}},
+	}
+	if len(d.TopWords) > 0 {
+		content.Sections = append(content.Sections, chatSection{Name: "Top words", Lines: []string{d.WordsLine()}})
+	}
+	if len(d.Edits) > 0 {
+		edits := []string{}
+		for _, edit := range d.Edits {
+			edits = append(edits, EditLine(edit))
+		}
+		content.Sections = append(content.Sections, chatSection{Name: "Edited reviews", Lines: edits})
+	}
+	worst := []string{}
+	for _, review := range d.Worst {
+		worst = append(worst, stars(review.Rating)+" "+review.Title+"\n@"+review.Username+" · "+formatDate(review.RatedAt)+"\n"+review.Body)
+	}
+	content.Body = strings.Join(worst, "\n\n")
+	return content
+}
+
+// digestStopWords are the common words that aren't counted in the top words
+var digestStopWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`the and for you your are but not this that with have has had was were
+		its it's can can't cant don't dont just all very too out get got what when would will from they them
+		there their then than been being also only more most some any app game one even really like much
+		after again about because into over still now here how why who which our off ever every other should could did does doing make made want time`) {
+		digestStopWords[word] = true
+	}
+}
+
+// topWords returns the words of 3 letters or more that are in most of the reviews, at least 2 of them
+func topWords(reviews []ReviewModel, limit int) []WordCount {
+	counts := map[string]int{}
+	for _, review := range reviews {
+		seen := map[string]bool{}
+		words := strings.FieldsFunc(strings.ToLower(review.Title+" "+review.Body), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+		})
+		for _, word := range words {
+			word = strings.Trim(word, "'")
+			if len([]rune(word)) < 3 || digestStopWords[word] || seen[word] {
+				continue
+			}
+			seen[word] = true
+			counts[word]++
+		}
+	}
+	words := []WordCount{}
+	for word, count := range counts {
+		if count >= 2 {
+			words = append(words, WordCount{Word: word, Count: count})
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if words[i].Count != words[j].Count {
+			return words[i].Count > words[j].Count
+		}
+		return words[i].Word < words[j].Word
+	})
+	if len(words) > limit {
+		words = words[:limit]
+	}
+	return words
+}
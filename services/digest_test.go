@@ -0,0 +1,119 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDigestNotifier is a fakeNotifier that can send the digest
+type fakeDigestNotifier struct {
+	fakeNotifier
+	digests []Digest
+}
+
+func (f *fakeDigestNotifier) NotifyDigest(digest Digest) error {
+	f.digests = append(f.digests, digest)
+	return f.err
+}
+
+func TestNewDigest(t *testing.T) {
+	repo := NewReviewsRepository()
+	now := time.Now()
+	reviews := Reviews{
+		AppName: "app-digest",
+		Store:   StoreIOS,
+		Items: []Review{
+			{ExternalID: "1", Username: "a", Title: "Too many ads", Body: "Ads after every level", Rating: 1, RatedAt: now.Add(-time.Hour)},
+			{ExternalID: "2", Username: "b", Title: "Crashes", Body: "It crashes, and the ads are loud", Rating: 2, RatedAt: now.Add(-2 * time.Hour)},
+			{ExternalID: "3", Username: "c", Title: "Fun", Body: "Fun levels", Rating: 5, RatedAt: now.Add(-3 * time.Hour)},
+			{ExternalID: "4", Username: "d", Title: "Okay", Body: "Fine", Rating: 3, RatedAt: now.Add(-30 * time.Hour)},
+			{ExternalID: "5", Username: "e", Title: "Old", Body: "ads ads", Rating: 1, RatedAt: now.AddDate(0, 0, -3)},
+			{ExternalID: "6", Username: "f", Title: "Backfill", Body: "ads", Rating: 1, RatedAt: now.AddDate(0, 0, -40)},
+		},
+		ReviewsSummary: ReviewsSummary{Total: 100, Rating5Percentage: 100},
+	}
+	found, _, err := repo.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	// the old review was scraped 3 days ago, while Okay is new though it was rated before the day, as it was scraped after a downtime
+	// and Backfill is of the first scrape of the app, rated long before it
+	assert.Nil(t, repo.db.Model(&found[4]).UpdateColumn("created_at", now.AddDate(0, 0, -3)).Error)
+	assert.Nil(t, repo.db.Model(&found[3]).UpdateColumn("created_at", now.Add(-10*time.Hour)).Error)
+	// and Fun was edited
+	reviews.Items[2].Body = "Fun levels, but too short"
+	reviews.Items[2].Rating = 4
+	_, edits, err := repo.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(edits))
+	previous, err := repo.InsertReviewCount(reviews)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.db.Model(&previous).Update("created_at", now.AddDate(0, 0, -2)).Error)
+	reviews.ReviewsSummary = ReviewsSummary{Total: 104, Rating5Percentage: 50, Rating1Percentage: 50}
+	_, err = repo.InsertReviewCount(reviews)
+	assert.Nil(t, err)
+
+	// until after the rating summary was inserted
+	now = time.Now()
+	digest, err := NewDigest("app-digest", StoreIOS, DigestDaily, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, digest.Total)
+	assert.Equal(t, [5]int{1, 1, 1, 1, 0}, digest.ByRating)
+	assert.Equal(t, 2.5, digest.Average)
+	assert.Equal(t, 1, digest.Edited)
+	assert.Equal(t, "★★★★★ → ★★★★☆ Fun", EditLine(digest.Edits[0]))
+	assert.Equal(t, -2.0, digest.AverageDelta())
+	assert.Equal(t, 3, len(digest.Worst))
+	assert.Equal(t, "Too many ads", digest.Worst[0].Title)
+	assert.Equal(t, "Okay", digest.Worst[2].Title)
+	assert.Equal(t, []WordCount{{Word: "ads", Count: 2}}, digest.TopWords)
+
+	markdown := digest.Markdown()
+	assert.Contains(t, markdown, "# Daily digest")
+	assert.Contains(t, markdown, "Average rating: 3.00 (-2.00)")
+	assert.Contains(t, markdown, "ads (2)")
+	assert.Contains(t, markdown, "### ★☆☆☆☆ Too many ads")
+	assert.Contains(t, markdown, "- 1 edited reviews")
+	assert.Contains(t, markdown, "### ★★★★★ → ★★★★☆ Fun")
+	rendered, ok, err := defaultTemplates.Render(ChannelEmail, TemplateDigest, digestData(digest))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "Daily digest", rendered.Title)
+	assert.Contains(t, rendered.Body, "<p>Ads after every level</p>")
+	assert.Contains(t, rendered.Body, "<p>Fun levels, but too short</p>")
+
+	// the weekly has the older review
+	digest, err = NewDigest("app-digest", StoreIOS, DigestWeekly, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, digest.Total)
+	assert.Equal(t, "Weekly digest", digest.Title())
+	assert.Equal(t, 0.0, digest.AverageDelta())
+
+	_, err = NewDigest("app-digest", StoreIOS, "monthly", now)
+	assert.NotNil(t, err)
+}
+
+func TestNotifyDigest(t *testing.T) {
+	digestible := &fakeDigestNotifier{fakeNotifier: fakeNotifier{channel: "digestible"}}
+	plain := &fakeNotifier{channel: "plain"}
+	nn := &Notify{Notifiers: []Notifier{plain, digestible}, Digest: DigestDaily}
+
+	assert.Nil(t, nn.NotifyDigest(Digest{AppName: "candy-crush", Total: 3}))
+	assert.Equal(t, 1, len(digestible.digests))
+	assert.Equal(t, 0, len(plain.events))
+
+	// the reviews and the rating are in the digest
+	assert.Nil(t, nn.NotifyReviewCount(ReviewCountsModel{Total: 10}, ReviewCountsModel{}))
+	assert.Nil(t, nn.NotifyUndelivered("candy-crush", StoreIOS))
+	assert.Equal(t, 0, len(digestible.events))
+
+	// every channel sends it natively
+	for _, notifier := range []Notifier{NewConsoleNotifier(), NewMSTeamsNotifier(""), &EmailNotifier{}, NewSlackWebhookNotifier(""), NewWebhookNotifier(nil, ""),
+		NewDiscordNotifier(""), NewTelegramNotifier("", ""), NewMattermostNotifier(""), NewGoogleChatNotifier("")} {
+		_, ok := notifier.(DigestNotifier)
+		assert.True(t, ok, notifier.Channel())
+	}
+	content := digestChat(Digest{AppName: "candy-crush", Store: StoreIOS, Worst: []ReviewModel{{Title: "Bad", Body: "Too many ads", Rating: 1}}})
+	assert.Contains(t, mattermostRender(content), "Too many ads")
+	assert.Contains(t, mattermostRender(content), "**New reviews**")
+}
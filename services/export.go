@@ -0,0 +1,430 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Tables that can be exported
+const (
+	ExportReviews      = "reviews"
+	ExportReviewCounts = "review_counts"
+)
+
+// Formats of the exports
+const (
+	ExportCSV     = "csv"
+	ExportJSONL   = "jsonl"
+	ExportParquet = "parquet"
+)
+
+// ExportBatchSize is the rows read from DB at once, so that a table is exported without reading it all
+const ExportBatchSize = 1000
+
+// exportModels are the models of the tables, their columns are of the JSON of the models
+var exportModels = map[string]interface{}{
+	ExportReviews:      ReviewModel{},
+	ExportReviewCounts: ReviewCountsModel{},
+}
+
+// ExportQuery is the rows of a table to export, see @Exporter.Export
+// The rows of all the apps and stores are exported when they are empty
+type ExportQuery struct {
+	Table    string
+	AppNames []string
+	Stores   []string
+	// From is inclusive and To is exclusive, of rated_at of the reviews and of created_at of the rating summaries
+	From time.Time
+	To   time.Time
+	// AfterID is the cursor, only the rows after it are exported, see @ExportCursor
+	AfterID int
+}
+
+// CursorKey is the key of the query in the ExportCursor, its table and filters, eg. reviews?app_name=candy-crush&store=ios
+// so that the cursor of an export isn't used for other rows, which would skip the rows of the other apps or stores
+func (q ExportQuery) CursorKey() string {
+	values := url.Values{}
+	if len(q.AppNames) > 0 {
+		values.Set("app_name", sortedJoin(q.AppNames))
+	}
+	if len(q.Stores) > 0 {
+		values.Set("store", sortedJoin(q.Stores))
+	}
+	if !q.From.IsZero() {
+		values.Set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		values.Set("to", q.To.Format(time.RFC3339))
+	}
+	if len(values) == 0 {
+		return q.Table
+	}
+	return q.Table + "?" + values.Encode()
+}
+
+// sortedJoin joins the values comma separated in order, so that the order of the flags doesn't matter
+func sortedJoin(values []string) string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// exportColumn is a column of a table, the field of its model
+type exportColumn struct {
+	name  string
+	index int
+	typ   reflect.Type
+}
+
+// Exporter streams the rows of a table as CSV, JSON Lines or Parquet, oldest first
+type Exporter struct {
+	Table   string
+	Format  string
+	columns []exportColumn
+	// Header writes the names of the columns as the first row of CSV, eg. unless appending to a file
+	Header bool
+	// BOM writes the UTF-8 byte order mark before CSV, so that Excel doesn't garble eg. the Japanese reviews
+	BOM bool
+}
+
+// NewExporter creates a new Exporter of the columns of the table, all of them when empty
+func NewExporter(table, format string, columns []string) (*Exporter, error) {
+	all, err := ExportColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case ExportCSV, ExportJSONL, ExportParquet:
+	default:
+		return nil, fmt.Errorf("[error] unknown export format %s, csv, jsonl or parquet", format)
+	}
+	if len(columns) == 0 {
+		columns = all
+	}
+	model := reflect.TypeOf(exportModels[table])
+	e := &Exporter{Table: table, Format: format, Header: true}
+	seen := map[string]bool{}
+	for _, name := range columns {
+		if seen[name] {
+			return nil, fmt.Errorf("[error] column %s is selected twice", name)
+		}
+		seen[name] = true
+		index := -1
+		for i := 0; i < model.NumField(); i++ {
+			if exportColumnName(model.Field(i)) == name {
+				index = i
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("[error] unknown column %s of %s, one of %s", name, table, strings.Join(all, ", "))
+		}
+		e.columns = append(e.columns, exportColumn{name: name, index: index, typ: model.Field(index).Type})
+	}
+	return e, nil
+}
+
+// ExportColumns returns the names of the columns of the table, in the order of its model
+func ExportColumns(table string) ([]string, error) {
+	model, ok := exportModels[table]
+	if !ok {
+		return nil, fmt.Errorf("[error] unknown table %s, reviews or review_counts", table)
+	}
+	columns := []string{}
+	t := reflect.TypeOf(model)
+	for i := 0; i < t.NumField(); i++ {
+		if name := exportColumnName(t.Field(i)); name != "" {
+			columns = append(columns, name)
+		}
+	}
+	return columns, nil
+}
+
+func exportColumnName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// Export writes the rows of the query to w, and returns the number of the rows and the id of the last one
+// The rows are read from DB in batches of ExportBatchSize, by their id, so the last id is the cursor of the next export
+func (e *Exporter) Export(w io.Writer, query ExportQuery) (int, int, error) {
+	if query.Table != e.Table {
+		return 0, 0, fmt.Errorf("[error] the exporter is of %s, not of %s", e.Table, query.Table)
+	}
+	writer, err := e.newWriter(w)
+	if err != nil {
+		return 0, 0, err
+	}
+	repo := NewReviewsRepository()
+	count, lastID := 0, query.AfterID
+	for {
+		rows := reflect.New(reflect.SliceOf(reflect.TypeOf(exportModels[e.Table])))
+		if err := repo.FindExportRows(query, lastID, ExportBatchSize, rows.Interface()); err != nil {
+			return count, lastID, err
+		}
+		batch := rows.Elem()
+		for i := 0; i < batch.Len(); i++ {
+			row := batch.Index(i)
+			values := make([]interface{}, len(e.columns))
+			for j, column := range e.columns {
+				values[j] = row.Field(column.index).Interface()
+			}
+			if err := writer.write(values); err != nil {
+				return count, lastID, fmt.Errorf("[error] unable to export %s: %w", e.Table, err)
+			}
+			count++
+			lastID = int(row.FieldByName("ID").Int())
+		}
+		if batch.Len() < ExportBatchSize {
+			break
+		}
+	}
+	if err := writer.close(); err != nil {
+		return count, lastID, fmt.Errorf("[error] unable to export %s: %w", e.Table, err)
+	}
+	return count, lastID, nil
+}
+
+// exportWriter writes the rows of a format, values are in the order of the columns
+type exportWriter interface {
+	write(values []interface{}) error
+	close() error
+}
+
+func (e *Exporter) newWriter(w io.Writer) (exportWriter, error) {
+	switch e.Format {
+	case ExportCSV:
+		return newCSVExportWriter(w, e)
+	case ExportJSONL:
+		return &jsonlExportWriter{w: bufio.NewWriter(w), columns: e.columns}, nil
+	}
+	return newParquetExportWriter(w, e), nil
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func newCSVExportWriter(w io.Writer, e *Exporter) (*csvExportWriter, error) {
+	if e.BOM {
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return nil, err
+		}
+	}
+	cw := &csvExportWriter{w: csv.NewWriter(w)}
+	if e.Header {
+		names := []string{}
+		for _, column := range e.columns {
+			names = append(names, column.name)
+		}
+		if err := cw.w.Write(names); err != nil {
+			return nil, err
+		}
+	}
+	return cw, nil
+}
+
+// write quotes the values with a comma, a quote or a line break, which is by bytes so any UTF-8 text is kept as it is
+func (cw *csvExportWriter) write(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = exportString(v)
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvExportWriter) close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type jsonlExportWriter struct {
+	w       *bufio.Writer
+	columns []exportColumn
+}
+
+// write writes the values as an object in the order of the columns, the dates as RFC3339 and NULL as null
+func (jw *jsonlExportWriter) write(values []interface{}) error {
+	jw.w.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			jw.w.WriteByte(',')
+		}
+		name, _ := json.Marshal(jw.columns[i].name)
+		jw.w.Write(name)
+		jw.w.WriteByte(':')
+		var b strings.Builder
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(exportJSONValue(v)); err != nil {
+			return err
+		}
+		jw.w.WriteString(strings.TrimSuffix(b.String(), "\n"))
+	}
+	jw.w.WriteByte('}')
+	return jw.w.WriteByte('\n')
+}
+
+func (jw *jsonlExportWriter) close() error {
+	return jw.w.Flush()
+}
+
+type parquetExportWriter struct {
+	w *parquet.Writer
+	// order is the index of the value of each column of the schema, which orders the columns by their name
+	order []int
+	types []reflect.Type
+}
+
+// newParquetExportWriter writes the columns as optional, as the dates of the models can be NULL
+// The ints are INT64, the strings UTF8 and the dates TIMESTAMP in milliseconds
+func newParquetExportWriter(w io.Writer, e *Exporter) *parquetExportWriter {
+	group := parquet.Group{}
+	byName := map[string]int{}
+	for i, column := range e.columns {
+		byName[column.name] = i
+		var node parquet.Node
+		switch exportKind(column.typ) {
+		case reflect.Int:
+			node = parquet.Int(64)
+		case reflect.Struct:
+			node = parquet.Timestamp(parquet.Millisecond)
+		default:
+			node = parquet.String()
+		}
+		group[column.name] = parquet.Optional(node)
+	}
+	schema := parquet.NewSchema(e.Table, group)
+	pw := &parquetExportWriter{w: parquet.NewWriter(w, schema)}
+	for _, field := range schema.Fields() {
+		i := byName[field.Name()]
+		pw.order = append(pw.order, i)
+		pw.types = append(pw.types, e.columns[i].typ)
+	}
+	return pw
+}
+
+func (pw *parquetExportWriter) write(values []interface{}) error {
+	row := make(parquet.Row, len(pw.order))
+	for c, i := range pw.order {
+		v := reflect.ValueOf(values[i])
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				row[c] = parquet.NullValue().Level(0, 0, c)
+				continue
+			}
+			v = v.Elem()
+		}
+		var value parquet.Value
+		switch exportKind(pw.types[c]) {
+		case reflect.Int:
+			value = parquet.Int64Value(v.Int())
+		case reflect.Struct:
+			value = parquet.Int64Value(v.Interface().(time.Time).UnixMilli())
+		default:
+			value = parquet.ByteArrayValue([]byte(v.String()))
+		}
+		row[c] = value.Level(0, 1, c)
+	}
+	_, err := pw.w.WriteRows([]parquet.Row{row})
+	return err
+}
+
+func (pw *parquetExportWriter) close() error {
+	return pw.w.Close()
+}
+
+// exportKind is the kind of the column, Int of any int, and Struct of the dates
+func exportKind(t reflect.Type) reflect.Kind {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.Int
+	case reflect.Struct:
+		return reflect.Struct
+	}
+	return reflect.String
+}
+
+// exportString is the value in CSV, the dates as RFC3339 and NULL as empty
+func exportString(v interface{}) string {
+	switch v := v.(type) {
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case int:
+		return strconv.Itoa(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// exportJSONValue is the value in JSON Lines, the dates as RFC3339 in UTC
+func exportJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return v.UTC().Format(time.RFC3339)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	}
+	return v
+}
+
+// ExportCursor is the id of the last row exported of each table and filters, so that the next export only has the new rows
+// see @ExportQuery.CursorKey
+type ExportCursor map[string]int
+
+// LoadExportCursor reads the cursor from the JSON file, a file that doesn't exist yet is an empty cursor
+func LoadExportCursor(path string) (ExportCursor, error) {
+	cursor := ExportCursor{}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cursor, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[error] unable to read the cursor %s: %w", path, err)
+	}
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, fmt.Errorf("[error] unable to read the cursor %s: %w", path, err)
+	}
+	return cursor, nil
+}
+
+// Save writes the cursor to the JSON file, replaced at once so that a failed save keeps the previous cursor
+func (c ExportCursor) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("[error] unable to save the cursor %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("[error] unable to save the cursor %s: %w", path, err)
+	}
+	return nil
+}
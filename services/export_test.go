@@ -0,0 +1,164 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportColumns(t *testing.T) {
+	columns, err := ExportColumns(ExportReviews)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "app_name", "store", "external_id", "username", "title", "body", "rating", "rated_at", "country", "language", "created_at", "updated_at", "deleted_at"}, columns)
+	columns, err = ExportColumns(ExportReviewCounts)
+	assert.Nil(t, err)
+	assert.Contains(t, columns, "rating_5_percentage")
+	_, err = ExportColumns("notifications")
+	assert.NotNil(t, err)
+
+	_, err = NewExporter(ExportReviews, "xlsx", nil)
+	assert.NotNil(t, err)
+	_, err = NewExporter(ExportReviews, ExportCSV, []string{"title", "average"})
+	assert.ErrorContains(t, err, "unknown column average of reviews")
+	_, err = NewExporter(ExportReviews, ExportCSV, []string{"title", "title"})
+	assert.ErrorContains(t, err, "selected twice")
+}
+
+func TestExport(t *testing.T) {
+	ratedAt := time.Date(2026, 9, 1, 9, 0, 0, 0, time.UTC)
+	reviews := Reviews{
+		AppName: "app-export",
+		Store:   StoreIOS,
+		Items: []Review{
+			{ExternalID: "1", Username: "たろう", Title: "最高", Body: "とても楽しい、\n\"また\"遊びます", Rating: 5, RatedAt: ratedAt},
+			{ExternalID: "2", Username: "bob", Title: "Meh, ok", Body: "<b>fine</b>", Rating: 3, RatedAt: ratedAt.AddDate(0, 0, 1)},
+		},
+	}
+	found, _, err := NewReviewsRepository().FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	query := ExportQuery{Table: ExportReviews, AppNames: []string{"app-export"}}
+
+	// CSV keeps the Japanese text as it is, quoted when needed
+	e, err := NewExporter(ExportReviews, ExportCSV, []string{"id", "username", "title", "body", "rating", "rated_at", "deleted_at"})
+	assert.Nil(t, err)
+	e.BOM = true
+	var b bytes.Buffer
+	count, lastID, err := e.Export(&b, query)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, found[1].ID, lastID)
+	assert.True(t, strings.HasPrefix(b.String(), "\ufeffid,username,title,body,rating,rated_at,deleted_at\n"))
+	assert.Contains(t, b.String(), fmt.Sprintf("%d,たろう,最高,\"とても楽しい、\n\"\"また\"\"遊びます\",5,2026-09-01T09:00:00Z,\n", found[0].ID))
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(b.String(), "\ufeff"))).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, "とても楽しい、\n\"また\"遊びます", records[1][3])
+	assert.Equal(t, "Meh, ok", records[2][2])
+
+	// JSON Lines in the order of the columns, with NULL as null
+	e, err = NewExporter(ExportReviews, ExportJSONL, []string{"title", "body", "rated_at", "deleted_at"})
+	assert.Nil(t, err)
+	b.Reset()
+	_, _, err = e.Export(&b, query)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Equal(t, `{"title":"最高","body":"とても楽しい、\n\"また\"遊びます","rated_at":"2026-09-01T09:00:00Z","deleted_at":null}`, lines[0])
+	assert.Equal(t, `{"title":"Meh, ok","body":"<b>fine</b>","rated_at":"2026-09-02T09:00:00Z","deleted_at":null}`, lines[1])
+	row := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &row))
+
+	// after the cursor, and by the date range
+	count, _, err = e.Export(io.Discard, ExportQuery{Table: ExportReviews, AppNames: []string{"app-export"}, AfterID: found[0].ID})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	count, lastID, err = e.Export(io.Discard, ExportQuery{Table: ExportReviews, AppNames: []string{"app-export"}, AfterID: found[1].ID})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+	assert.Equal(t, found[1].ID, lastID)
+	count, _, err = e.Export(io.Discard, ExportQuery{Table: ExportReviews, AppNames: []string{"app-export"}, Stores: []string{StoreIOS}, To: ratedAt.Add(time.Hour)})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	_, _, err = e.Export(io.Discard, ExportQuery{Table: ExportReviewCounts})
+	assert.NotNil(t, err)
+
+	// Parquet, with the types of the columns
+	e, err = NewExporter(ExportReviews, ExportParquet, []string{"id", "title", "rating", "rated_at", "deleted_at"})
+	assert.Nil(t, err)
+	b.Reset()
+	_, _, err = e.Export(&b, query)
+	assert.Nil(t, err)
+	f, err := parquet.OpenFile(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), f.NumRows())
+	type exported struct {
+		ID        *int64  `parquet:"id,optional"`
+		Title     *string `parquet:"title,optional"`
+		Rating    *int64  `parquet:"rating,optional"`
+		RatedAt   *int64  `parquet:"rated_at,optional"`
+		DeletedAt *int64  `parquet:"deleted_at,optional"`
+	}
+	rows := make([]exported, 2)
+	n, err := parquet.NewGenericReader[exported](bytes.NewReader(b.Bytes())).Read(rows)
+	assert.True(t, err == nil || err == io.EOF, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, int64(found[0].ID), *rows[0].ID)
+	assert.Equal(t, "最高", *rows[0].Title)
+	assert.Equal(t, int64(5), *rows[0].Rating)
+	assert.Equal(t, ratedAt.UnixMilli(), *rows[0].RatedAt)
+	column, ok := f.Schema().Lookup("rated_at")
+	assert.True(t, ok)
+	assert.NotNil(t, column.Node.Type().LogicalType().Timestamp)
+	assert.Nil(t, rows[0].DeletedAt)
+}
+
+func TestExportBatches(t *testing.T) {
+	reviews := Reviews{AppName: "app-export-batches", Store: StoreAndroid}
+	for i := 0; i < ExportBatchSize+5; i++ {
+		reviews.Items = append(reviews.Items, Review{ExternalID: fmt.Sprint(i), Username: "u", Title: "t", Body: "b", Rating: 4, RatedAt: time.Now()})
+	}
+	_, _, err := NewReviewsRepository().FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	e, err := NewExporter(ExportReviews, ExportCSV, []string{"external_id"})
+	assert.Nil(t, err)
+	e.Header = false
+	var b bytes.Buffer
+	count, _, err := e.Export(&b, ExportQuery{Table: ExportReviews, AppNames: []string{"app-export-batches"}})
+	assert.Nil(t, err)
+	assert.Equal(t, ExportBatchSize+5, count)
+	assert.Equal(t, ExportBatchSize+5, strings.Count(b.String(), "\n"))
+	assert.True(t, strings.HasPrefix(b.String(), "0\n1\n"))
+}
+
+func TestExportCursor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursor.json")
+	cursor, err := LoadExportCursor(path)
+	assert.Nil(t, err)
+	assert.Equal(t, ExportCursor{}, cursor)
+	cursor[ExportReviews] = 42
+	assert.Nil(t, cursor.Save(path))
+	cursor, err = LoadExportCursor(path)
+	assert.Nil(t, err)
+	assert.Equal(t, ExportCursor{ExportReviews: 42}, cursor)
+
+	_, err = LoadExportCursor(t.TempDir())
+	assert.NotNil(t, err)
+
+	// the cursor of the filtered rows is apart from the one of all the rows
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, ExportReviews, ExportQuery{Table: ExportReviews, AfterID: 42}.CursorKey())
+	assert.Equal(t, "reviews?app_name=a%2Cb&from=2026-10-01T00%3A00%3A00Z&store=ios",
+		ExportQuery{Table: ExportReviews, AppNames: []string{"b", "a"}, Stores: []string{StoreIOS}, From: from}.CursorKey())
+	assert.NotEqual(t,
+		ExportQuery{Table: ExportReviews, AppNames: []string{"a"}}.CursorKey(),
+		ExportQuery{Table: ExportReviews, AppNames: []string{"b"}}.CursorKey())
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// updateFixtures records the responses of the live stores under recordedDir
+// go test ./services -run TestRecordFixtures -update
+var updateFixtures = flag.Bool("update", false, "record the responses of the live stores under testdata/recorded")
+
+// recordedDir is where -update records the responses, apart from the fixtures of testdata
+// so that the tests keep asserting the fixtures, and a recorded response is copied to testdata by hand when a store changed
+var recordedDir = filepath.Join("testdata", "recorded")
+
+var (
+	// googleAppIDRe extracts the app id from the batchexecute form payload
+	googleAppIDRe = regexp.MustCompile(`%5C%22([^%]+)%5C%22%2C7%5D`)
+	// googleTokenRe matches the form payload of a paginated request
+	googleTokenRe = regexp.MustCompile(`%2Cnull%2C%5C%22[^%]+%5C%22%5D`)
+	// appleFeedPathRe extracts the page and app id from the customer reviews feed path
+	appleFeedPathRe = regexp.MustCompile(`/rss/customerreviews/page=(\d+)/id=(\d+)/`)
+)
+
+// fixtureName maps a store request to its golden file under testdata
+// The golden files are hand-written in the format of the store responses, they are not captured from the live stores
+// apps.apple.com/us/app/candy-crush-saga/id553834731 -> apple_candy-crush-saga.html
+// play.google.com batchexecute for com.king.candycrushsaga -> google_com.king.candycrushsaga.txt
+// play.google.com batchexecute next page for com.king.candycrushsaga -> google_com.king.candycrushsaga_next.txt
+// itunes.apple.com/us/rss/customerreviews/page=1/id=553834731/sortby=mostrecent/json -> apple_feed_553834731_page1.json
+func fixtureName(req *http.Request, body []byte) string {
+	if m := appleFeedPathRe.FindStringSubmatch(req.URL.Path); m != nil {
+		return "apple_feed_" + m[2] + "_page" + m[1] + ".json"
+	}
+	if strings.HasSuffix(req.URL.Path, "/data/batchexecute") {
+		id := googleAppIDRe.FindSubmatch(body)
+		if id == nil {
+			return ""
+		}
+		if googleTokenRe.Match(body) {
+			return "google_" + string(id[1]) + "_next.txt"
+		}
+		return "google_" + string(id[1]) + ".txt"
+	}
+	// /us/app/candy-crush-saga/id553834731
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(parts) >= 3 && parts[1] == "app" {
+		return "apple_" + parts[2] + ".html"
+	}
+	return ""
+}
+
+// newFakeStore starts a local fake store that serves the golden files from testdata
+// and returns a transport which routes the requests for every store host to it
+// With -update the transport calls the live stores instead and records their responses, see @recordedDir
+func newFakeStore(t *testing.T) http.RoundTripper {
+	if *updateFixtures {
+		return &recordingTransport{t: t, next: http.DefaultTransport}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		name := fixtureName(r, body)
+		if name == "" {
+			http.NotFound(w, r)
+			return
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasSuffix(name, ".html") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	target, _ := url.Parse(server.URL)
+	return &rewriteTransport{target: target}
+}
+
+// rewriteTransport sends every request to the target host, keeping the path and query
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (rt *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = rt.target.Scheme
+	req.URL.Host = rt.target.Host
+	req.Host = rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// recordingTransport calls the live store and saves the response under recordedDir, with the name of the golden file of the request
+type recordingTransport struct {
+	t    *testing.T
+	next http.RoundTripper
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	name := fixtureName(req, body)
+	if name != "" && resp.StatusCode == http.StatusOK {
+		rt.t.Logf("recording %s", filepath.Join(recordedDir, name))
+		if err := os.MkdirAll(recordedDir, 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(recordedDir, name), data, 0600); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// capturingTransport keeps every request it sends to next, as its method, url, content type and body
+type capturingTransport struct {
+	next     http.RoundTripper
+	requests []string
+}
+
+func (ct *capturingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	ct.requests = append(ct.requests, req.Method+" "+req.URL.String()+"\n"+req.Header.Get("Content-Type")+"\n"+string(body))
+	return ct.next.RoundTrip(req)
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Formats of the feeds
+const (
+	FeedAtom = "atom"
+	FeedRSS  = "rss"
+)
+
+// FeedSize is the number of the newest reviews in a feed
+const FeedSize = 50
+
+// Feed is the newest reviews of an app, of all its stores or of one, as an Atom or RSS feed
+type Feed struct {
+	AppName string
+	Store   string
+	// Link is the URL the feed is served at, optional
+	Link    string
+	Reviews []ReviewModel
+}
+
+// NewFeed creates the feed of the newest reviews that match the query, see @ReviewsRepository.SearchReviews
+// The query is of an app, and PerPage is FeedSize when it isn't set
+func NewFeed(query ReviewsQuery, link string) (*Feed, error) {
+	if query.AppName == "" {
+		return nil, fmt.Errorf("[error] the feed is of an app, the app name is required")
+	}
+	if query.PerPage <= 0 {
+		query.PerPage = FeedSize
+	}
+	query.Page = 1
+	reviews, _, err := NewReviewsRepository().SearchReviews(query)
+	if err != nil {
+		return nil, err
+	}
+	return &Feed{AppName: query.AppName, Store: query.Store, Link: link, Reviews: reviews}, nil
+}
+
+// FeedContentType is the Content-Type of the format, see @Feed.Write
+func FeedContentType(format string) string {
+	if format == FeedRSS {
+		return "application/rss+xml; charset=utf-8"
+	}
+	return "application/atom+xml; charset=utf-8"
+}
+
+// Write writes the feed as atom or rss
+func (f *Feed) Write(w io.Writer, format string) error {
+	var v interface{}
+	switch format {
+	case FeedAtom:
+		v = f.atom()
+	case FeedRSS:
+		v = f.rss()
+	default:
+		return fmt.Errorf("[error] unknown feed format %s, atom or rss", format)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("[error] unable to write the feed: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// title of the feed, eg. Reviews of candy-crush on ios
+func (f *Feed) title() string {
+	if f.Store != "" {
+		return fmt.Sprintf("Reviews of %s on %s", f.AppName, f.Store)
+	}
+	return "Reviews of " + f.AppName
+}
+
+// id of the feed, which stays the same wherever it is served
+func (f *Feed) id() string {
+	id := "urn:app-reviews:" + url.PathEscape(f.AppName)
+	if f.Store != "" {
+		id += ":" + url.PathEscape(f.Store)
+	}
+	return id
+}
+
+// updated is when the newest review of the feed was rated or edited
+func (f *Feed) updated() time.Time {
+	updated := time.Unix(0, 0)
+	for _, review := range f.Reviews {
+		if t := feedUpdated(review); t.After(updated) {
+			updated = t
+		}
+	}
+	return updated.UTC()
+}
+
+// FeedGUID is the id of the review in the feeds, by the store's review id, which stays the same when the review is edited
+// The reviews without the store's id are by their id in DB, as their hash- id changes with the edits, see @Utils.ReviewExternalID
+// so their GUID changes when the DB is rebuilt, or when the store's id of the review is scraped later on
+func FeedGUID(review ReviewModel) string {
+	id := review.ExternalID
+	if id == "" || strings.HasPrefix(id, hashExternalIDPrefix) {
+		id = fmt.Sprintf("id-%d", review.ID)
+	}
+	return fmt.Sprintf("urn:app-reviews:%s:%s:%s", url.PathEscape(review.AppName), url.PathEscape(review.Store), url.PathEscape(id))
+}
+
+// feedTitle is the title of the review with its rating, eg. ★★★★☆ Fun game
+func feedTitle(review ReviewModel) string {
+	return strings.TrimSpace(stars(review.Rating) + " " + review.Title)
+}
+
+func feedPublished(review ReviewModel) time.Time {
+	if review.RatedAt != nil {
+		return review.RatedAt.UTC()
+	}
+	return time.Unix(0, 0).UTC()
+}
+
+// feedUpdated is when the review was edited, or rated when it wasn't
+// A review is updated after it was created only by its edits, see @ReviewsRepository.updateEditedReview
+func feedUpdated(review ReviewModel) time.Time {
+	if review.UpdatedAt != nil && review.CreatedAt != nil && review.UpdatedAt.After(*review.CreatedAt) {
+		return review.UpdatedAt.UTC()
+	}
+	return feedPublished(review)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    *atomLink   `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Author    atomAuthor  `xml:"author"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Category  atomTerm    `xml:"category"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomTerm struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func (f *Feed) atom() atomFeed {
+	feed := atomFeed{ID: f.id(), Title: f.title(), Updated: f.updated().Format(time.RFC3339)}
+	if f.Link != "" {
+		feed.Link = &atomLink{Href: f.Link, Rel: "self"}
+	}
+	for _, review := range f.Reviews {
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:        FeedGUID(review),
+			Title:     feedTitle(review),
+			Author:    atomAuthor{Name: review.Username},
+			Published: feedPublished(review).Format(time.RFC3339),
+			Updated:   feedUpdated(review).Format(time.RFC3339),
+			Category:  atomTerm{Term: review.Store},
+			Content:   atomContent{Type: "text", Body: review.Body},
+		})
+	}
+	return feed
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	GUID        rssGUID `xml:"guid"`
+	Title       string  `xml:"title"`
+	Author      string  `xml:"dc:creator"`
+	PubDate     string  `xml:"pubDate"`
+	Category    string  `xml:"category"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	ID          string `xml:",chardata"`
+}
+
+func (f *Feed) rss() rssFeed {
+	channel := rssChannel{
+		Title:         f.title(),
+		Link:          f.Link,
+		Description:   f.title() + ", newest first",
+		LastBuildDate: f.updated().Format(time.RFC1123Z),
+	}
+	for _, review := range f.Reviews {
+		channel.Items = append(channel.Items, rssItem{
+			GUID:        rssGUID{IsPermaLink: "false", ID: FeedGUID(review)},
+			Title:       feedTitle(review),
+			Author:      review.Username,
+			PubDate:     feedPublished(review).Format(time.RFC1123Z),
+			Category:    review.Store,
+			Description: review.Body,
+		})
+	}
+	return rssFeed{Version: "2.0", DC: "http://purl.org/dc/elements/1.1/", Channel: channel}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeed(t *testing.T) {
+	ratedAt := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	editedAt := ratedAt.Add(48 * time.Hour)
+	feed := &Feed{
+		AppName: "candy crush",
+		Store:   StoreIOS,
+		Link:    "http://localhost:8080/api/apps/candy%20crush/reviews.atom?store=ios",
+		Reviews: []ReviewModel{
+			{ID: 2, AppName: "candy crush", Store: StoreIOS, ExternalID: "e2", Username: "bob", Title: "Fun <3", Body: "So fun & sweet", Rating: 4, RatedAt: &ratedAt, CreatedAt: &ratedAt, UpdatedAt: &editedAt},
+			{ID: 1, AppName: "candy crush", Store: StoreIOS, Username: "amy", Title: "", Body: "Crashes", Rating: 1, RatedAt: &ratedAt, CreatedAt: &editedAt, UpdatedAt: &editedAt},
+		},
+	}
+
+	var b bytes.Buffer
+	assert.Nil(t, feed.Write(&b, FeedAtom))
+	atom := atomFeed{}
+	assert.Nil(t, xml.Unmarshal(b.Bytes(), &atom))
+	assert.Equal(t, "urn:app-reviews:candy%20crush:ios", atom.ID)
+	assert.Equal(t, "Reviews of candy crush on ios", atom.Title)
+	assert.Equal(t, "2026-10-03T09:00:00Z", atom.Updated)
+	assert.Equal(t, feed.Link, atom.Link.Href)
+	assert.Equal(t, 2, len(atom.Entries))
+	assert.Equal(t, "urn:app-reviews:candy%20crush:ios:e2", atom.Entries[0].ID)
+	assert.Equal(t, "★★★★☆ Fun <3", atom.Entries[0].Title)
+	assert.Equal(t, "bob", atom.Entries[0].Author.Name)
+	assert.Equal(t, "So fun & sweet", atom.Entries[0].Content.Body)
+	assert.Equal(t, "2026-10-01T09:00:00Z", atom.Entries[0].Published)
+	assert.Equal(t, "2026-10-03T09:00:00Z", atom.Entries[0].Updated)
+	// without the store's id, and never edited
+	assert.Equal(t, "urn:app-reviews:candy%20crush:ios:id-1", atom.Entries[1].ID)
+	assert.Equal(t, "★☆☆☆☆", atom.Entries[1].Title)
+	assert.Equal(t, "2026-10-01T09:00:00Z", atom.Entries[1].Updated)
+	assert.Contains(t, b.String(), "Fun &lt;3")
+
+	b.Reset()
+	assert.Nil(t, feed.Write(&b, FeedRSS))
+	assert.Contains(t, b.String(), `<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/">`)
+	assert.Contains(t, b.String(), `<dc:creator>bob</dc:creator>`)
+	rss := rssFeed{}
+	assert.Nil(t, xml.Unmarshal(b.Bytes(), &rss))
+	assert.Equal(t, "Reviews of candy crush on ios", rss.Channel.Title)
+	assert.Equal(t, feed.Link, rss.Channel.Link)
+	assert.Equal(t, 2, len(rss.Channel.Items))
+	assert.Equal(t, rssGUID{IsPermaLink: "false", ID: "urn:app-reviews:candy%20crush:ios:e2"}, rss.Channel.Items[0].GUID)
+	assert.Equal(t, "Thu, 01 Oct 2026 09:00:00 +0000", rss.Channel.Items[0].PubDate)
+	assert.Equal(t, "So fun & sweet", rss.Channel.Items[0].Description)
+
+	// the hash of the reviews without the store's id changes with the edits, so it isn't their GUID
+	assert.Equal(t, "urn:app-reviews:candy%20crush:ios:id-3", FeedGUID(ReviewModel{ID: 3, AppName: "candy crush", Store: StoreIOS, ExternalID: "hash-0123456789abcdef0123"}))
+
+	assert.NotNil(t, feed.Write(&b, "json"))
+	assert.Equal(t, "application/rss+xml; charset=utf-8", FeedContentType(FeedRSS))
+}
+
+func TestNewFeed(t *testing.T) {
+	now := time.Now()
+	reviews := Reviews{
+		AppName: "app-feed",
+		Store:   StoreAndroid,
+		Items: []Review{
+			{ExternalID: "1", Username: "a", Title: "Bad", Body: "x", Rating: 1, RatedAt: now.AddDate(0, 0, -2)},
+			{ExternalID: "2", Username: "b", Title: "Good", Body: "y", Rating: 5, RatedAt: now.AddDate(0, 0, -1)},
+		},
+	}
+	_, _, err := NewReviewsRepository().FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+
+	feed, err := NewFeed(ReviewsQuery{AppName: "app-feed"}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(feed.Reviews))
+	assert.Equal(t, "Good", feed.Reviews[0].Title)
+	feed, err = NewFeed(ReviewsQuery{AppName: "app-feed", Store: StoreAndroid, MaxRating: 2}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(feed.Reviews))
+	assert.Equal(t, StoreAndroid, feed.Store)
+
+	_, err = NewFeed(ReviewsQuery{}, "")
+	assert.NotNil(t, err)
+}
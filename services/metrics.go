@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of the errors of a run, see @MetricsRun
+const (
+	MetricsErrorScrape    = "scrape"
+	MetricsErrorNoReviews = "no_reviews"
+	MetricsErrorDB        = "db"
+	MetricsErrorNotify    = "notify"
+)
+
+// metricsErrorTypes are written for every app, so that an error that never happened is a 0
+var metricsErrorTypes = []string{MetricsErrorScrape, MetricsErrorNoReviews, MetricsErrorDB, MetricsErrorNotify}
+
+// MetricsRun is a run of an app on a store, see @Metrics.Observe
+type MetricsRun struct {
+	AppName string
+	Store   string
+	// Summary is the rating summary that was scraped, its Total is 0 when none of the urls could be scraped
+	Summary    ReviewsSummary
+	NewReviews int
+	Duration   time.Duration
+	// Errors are the types of the errors of the run, one for each error
+	Errors []string
+}
+
+// appMetrics are the metrics of an app on a store
+type appMetrics struct {
+	summary     ReviewsSummary
+	newReviews  int
+	duration    time.Duration
+	lastSuccess time.Time
+	errors      map[string]int
+}
+
+// Metrics are the metrics of the runs of the apps, in the Prometheus text format
+// They are served on /metrics by the daemon, or written for the textfile collector of node_exporter by a single run
+type Metrics struct {
+	mu   sync.Mutex
+	apps map[[2]string]*appMetrics
+}
+
+// NewMetrics creates new Metrics without any app
+func NewMetrics() *Metrics {
+	return &Metrics{apps: map[[2]string]*appMetrics{}}
+}
+
+// Observe records the run of the app on the store
+// A run without errors is a success, and the rating summary of a run that couldn't scrape it is kept as it was
+// The errors are counted over all the runs
+func (m *Metrics) Observe(run MetricsRun) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := [2]string{run.AppName, run.Store}
+	a, ok := m.apps[key]
+	if !ok {
+		a = &appMetrics{errors: map[string]int{}}
+		m.apps[key] = a
+	}
+	if run.Summary.Total > 0 {
+		a.summary = run.Summary
+	}
+	a.newReviews = run.NewReviews
+	a.duration = run.Duration
+	if len(run.Errors) == 0 {
+		a.lastSuccess = time.Now()
+	}
+	for _, errType := range run.Errors {
+		a.errors[errType]++
+	}
+}
+
+// metric is a family of the metrics, with the value of each app
+type metric struct {
+	name string
+	typ  string
+	help string
+	// label is added to the labels of the app, with one line for each of its values in labels
+	label  string
+	labels []string
+	value  func(a *appMetrics, label string) float64
+}
+
+var metricsFamilies = []metric{
+	{
+		name: "app_reviews_average_rating", typ: "gauge", help: "Average rating of the app, from its star percentages",
+		value: func(a *appMetrics, _ string) float64 {
+			s := a.summary
+			return NewUtils().AverageRating(ReviewCountsModel{
+				Rating1Percentage: s.Rating1Percentage, Rating2Percentage: s.Rating2Percentage, Rating3Percentage: s.Rating3Percentage,
+				Rating4Percentage: s.Rating4Percentage, Rating5Percentage: s.Rating5Percentage,
+			})
+		},
+	},
+	{
+		name: "app_reviews_total", typ: "gauge", help: "Total reviews of the app on the store",
+		value: func(a *appMetrics, _ string) float64 { return float64(a.summary.Total) },
+	},
+	{
+		name: "app_reviews_rating_percentage", typ: "gauge", help: "Percentage of the reviews of the app with the rating",
+		label: "rating", labels: []string{"1", "2", "3", "4", "5"},
+		value: func(a *appMetrics, rating string) float64 {
+			s := a.summary
+			return float64(map[string]int{
+				"1": s.Rating1Percentage, "2": s.Rating2Percentage, "3": s.Rating3Percentage, "4": s.Rating4Percentage, "5": s.Rating5Percentage,
+			}[rating])
+		},
+	},
+	{
+		name: "app_reviews_new_reviews", typ: "gauge", help: "New reviews of the app saved by the last run",
+		value: func(a *appMetrics, _ string) float64 { return float64(a.newReviews) },
+	},
+	{
+		name: "app_reviews_scrape_duration_seconds", typ: "gauge", help: "Duration of scraping all the urls of the app by the last run",
+		value: func(a *appMetrics, _ string) float64 { return a.duration.Seconds() },
+	},
+	{
+		name: "app_reviews_last_success_timestamp_seconds", typ: "gauge", help: "Unix time of the last run of the app without errors, 0 when there was none",
+		value: func(a *appMetrics, _ string) float64 {
+			if a.lastSuccess.IsZero() {
+				return 0
+			}
+			return float64(a.lastSuccess.UnixMilli()) / 1000
+		},
+	},
+	{
+		name: "app_reviews_errors_total", typ: "counter", help: "Errors of the runs of the app by their type",
+		label: "type", labels: metricsErrorTypes,
+		value: func(a *appMetrics, errType string) float64 { return float64(a.errors[errType]) },
+	},
+}
+
+// Write writes the metrics in the Prometheus text format, the apps in the order of their names
+func (m *Metrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([][2]string, 0, len(m.apps))
+	for key := range m.apps {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, f := range metricsFamilies {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+		for _, key := range keys {
+			labels := fmt.Sprintf(`app="%s",store="%s"`, escapeLabel(key[0]), escapeLabel(key[1]))
+			if len(f.labels) == 0 {
+				fmt.Fprintf(bw, "%s{%s} %g\n", f.name, labels, f.value(m.apps[key], ""))
+				continue
+			}
+			for _, label := range f.labels {
+				fmt.Fprintf(bw, "%s{%s,%s=\"%s\"} %g\n", f.name, labels, f.label, label, f.value(m.apps[key], label))
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteFile writes the metrics to the file, for the textfile collector of node_exporter, eg. to app.prom
+// The file is replaced at once, so that the collector never reads it half written
+func (m *Metrics) WriteFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("[error] unable to write the metrics to %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := m.Write(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("[error] unable to write the metrics to %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("[error] unable to write the metrics to %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("[error] unable to write the metrics to %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("[error] unable to write the metrics to %s: %w", path, err)
+	}
+	return nil
+}
+
+// ServeHTTP serves the metrics, see @http.Handler
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.Write(w); err != nil {
+		log.Println("[error] unable to write the metrics:", err)
+	}
+}
+
+// escapeLabel escapes the label value of the Prometheus text format
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
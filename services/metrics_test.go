@@ -0,0 +1,62 @@
+package services
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	mm := NewMetrics()
+	summary := ReviewsSummary{Total: 120, Rating5Percentage: 50, Rating1Percentage: 50}
+	mm.Observe(MetricsRun{AppName: "candy", Store: StoreIOS, Summary: summary, NewReviews: 3, Duration: 1500 * time.Millisecond})
+	mm.Observe(MetricsRun{AppName: `say "hi"`, Store: StoreAndroid, Errors: []string{MetricsErrorScrape}})
+
+	var b bytes.Buffer
+	assert.Nil(t, mm.Write(&b))
+	out := b.String()
+	assert.Contains(t, out, "# TYPE app_reviews_average_rating gauge\n")
+	assert.Contains(t, out, `app_reviews_average_rating{app="candy",store="ios"} 3`+"\n")
+	assert.Contains(t, out, `app_reviews_total{app="candy",store="ios"} 120`+"\n")
+	assert.Contains(t, out, `app_reviews_rating_percentage{app="candy",store="ios",rating="5"} 50`+"\n")
+	assert.Contains(t, out, `app_reviews_rating_percentage{app="candy",store="ios",rating="2"} 0`+"\n")
+	assert.Contains(t, out, `app_reviews_new_reviews{app="candy",store="ios"} 3`+"\n")
+	assert.Contains(t, out, `app_reviews_scrape_duration_seconds{app="candy",store="ios"} 1.5`+"\n")
+	assert.Contains(t, out, "# TYPE app_reviews_errors_total counter\n")
+	assert.Contains(t, out, `app_reviews_errors_total{app="candy",store="ios",type="scrape"} 0`+"\n")
+	// the label values are escaped, and an app that never succeeded has no last success
+	assert.Contains(t, out, `app_reviews_errors_total{app="say \"hi\"",store="android",type="scrape"} 1`+"\n")
+	assert.Contains(t, out, `app_reviews_last_success_timestamp_seconds{app="say \"hi\"",store="android"} 0`+"\n")
+	assert.NotContains(t, out, `app_reviews_last_success_timestamp_seconds{app="candy",store="ios"} 0`+"\n")
+
+	// a failed run keeps the rating summary, and the errors are counted over the runs
+	mm.Observe(MetricsRun{AppName: "candy", Store: StoreIOS, Errors: []string{MetricsErrorNoReviews, MetricsErrorNoReviews}})
+	b.Reset()
+	assert.Nil(t, mm.Write(&b))
+	out = b.String()
+	assert.Contains(t, out, `app_reviews_total{app="candy",store="ios"} 120`+"\n")
+	assert.Contains(t, out, `app_reviews_new_reviews{app="candy",store="ios"} 0`+"\n")
+	assert.Contains(t, out, `app_reviews_errors_total{app="candy",store="ios",type="no_reviews"} 2`+"\n")
+
+	w := httptest.NewRecorder()
+	mm.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "version=0.0.4")
+	assert.Equal(t, out, w.Body.String())
+
+	path := filepath.Join(t.TempDir(), "app.prom")
+	assert.Nil(t, mm.WriteFile(path))
+	written, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, out, string(written))
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.NotNil(t, mm.WriteFile(filepath.Join(t.TempDir(), "missing", "app.prom")))
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"gorm.io/gorm"
+)
+
+// NotificationsRepository is the repository of the delivered notifications, see @NotificationModel
+type NotificationsRepository struct {
+	db *gorm.DB
+}
+
+// NewNotificationsRepository the constructor for NotificationsRepository
+func NewNotificationsRepository() *NotificationsRepository {
+	return &NotificationsRepository{
+		db: app.NewDB(),
+	}
+}
+
+// IsDelivered returns true when the event of the review was delivered on the channel
+func (r *NotificationsRepository) IsDelivered(channel, event string, reviewID, revisionID int) (bool, error) {
+	notification := NotificationModel{}
+	query := `channel = ?
+		AND event = ?
+		AND review_id = ?
+		AND revision_id = ?
+		AND deleted_at IS NULL`
+	result := r.db.Where(query, channel, event, reviewID, revisionID).First(&notification)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return result.Error == nil, result.Error
+}
+
+// InsertNotification records that the event of the review was delivered on the channel
+func (r *NotificationsRepository) InsertNotification(review ReviewModel, channel, event string, revisionID int) (NotificationModel, error) {
+	now := time.Now()
+	notification := NotificationModel{
+		AppName:     review.AppName,
+		Store:       review.Store,
+		Channel:     channel,
+		Event:       event,
+		ReviewID:    review.ID,
+		RevisionID:  revisionID,
+		DeliveredAt: &now,
+		CreatedAt:   &now,
+		UpdatedAt:   &now,
+	}
+	result := r.db.Create(&notification)
+	return notification, result.Error
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+)
+
+// Notifier is a channel where the notifications are sent, eg. console or MS Teams
+// Every channel is a self contained file which registers itself with RegisterChannel in init()
+// Third parties can register their own channel from Go code the same way
+type Notifier interface {
+	// Channel is the unique channel name
+	// Example: console, msteams
+	Channel() string
+	// NotifyNewReview is sent for a review that was scraped for the first time
+	NotifyNewReview(review ReviewModel) error
+	// NotifyUpdatedReview is sent for a review that was edited by the user since it was last scraped
+	NotifyUpdatedReview(edit ReviewEdit) error
+	// NotifyReviewCount is sent when the rating summary changed since it was last scraped
+	// last is empty on the first scrape of the app
+	NotifyReviewCount(current, last ReviewCountsModel) error
+	// NotifyError is sent when the app couldn't be scraped or saved
+	NotifyError(appName, store string, err error) error
+}
+
+// ChannelFactory creates the Notifier of a channel from the notify settings of an app, see @NewNotify
+// ok is false when the channel isn't configured in the settings, eg. has no hook URL, and isn't notified
+type ChannelFactory func(settings app.NotifyEntry) (notifier Notifier, ok bool, err error)
+
+// channel is a registered ChannelFactory, see @RegisterChannel
+type channel struct {
+	name    string
+	factory ChannelFactory
+}
+
+var (
+	channelsMu sync.RWMutex
+	// channels are kept in the order of registration
+	// so that the notifications are sent in the same order every time
+	channels []channel
+)
+
+// RegisterChannel registers the factory of a channel
+// Registering a channel for an already registered name replaces the previous one
+func RegisterChannel(name string, factory ChannelFactory) {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+	for i, c := range channels {
+		if c.name == name {
+			channels[i].factory = factory
+			return
+		}
+	}
+	channels = append(channels, channel{name: name, factory: factory})
+}
+
+// Channels returns the names of all the registered channels in the order of registration
+func Channels() []string {
+	channelsMu.RLock()
+	defer channelsMu.RUnlock()
+	names := []string{}
+	for _, c := range channels {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// NewNotifiers returns the notifiers of all the registered channels that are configured in the settings
+// When the settings select the channels, only those are returned, and each has to be configured
+// The console is always returned, as it is the output of the run
+// The notifiers are set the templates of the settings, see @TemplateNotifier
+func NewNotifiers(settings app.NotifyEntry) ([]Notifier, error) {
+	channelsMu.RLock()
+	registered := append([]channel{}, channels...)
+	channelsMu.RUnlock()
+
+	selected := map[string]bool{}
+	for _, name := range settings.Channels {
+		found := false
+		for _, c := range registered {
+			found = found || c.name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("[error] unknown notification channel %s, use one of %s", name, strings.Join(Channels(), ", "))
+		}
+		selected[name] = true
+	}
+
+	templates, err := LoadTemplates(settings.Templates, settings.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	notifiers := []Notifier{}
+	for _, c := range registered {
+		if len(selected) > 0 && !selected[c.name] && c.name != ChannelConsole {
+			continue
+		}
+		notifier, ok, err := c.factory(settings)
+		if err != nil {
+			return nil, fmt.Errorf("[error] unable to set up %s notifications: %w", c.name, err)
+		}
+		if !ok && selected[c.name] {
+			return nil, fmt.Errorf("[error] %s notifications are selected but not configured", c.name)
+		}
+		if !ok {
+			continue
+		}
+		if t, ok := notifier.(TemplateNotifier); ok {
+			t.SetTemplates(templates)
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	return notifiers, nil
+}
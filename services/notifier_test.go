@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannels(t *testing.T) {
+	assert.Subset(t, Channels(), []string{ChannelConsole, ChannelMSTeams})
+
+	// msteams is only on with the hook URL
+	notifiers, err := NewNotifiers(app.NotifyEntry{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(notifiers))
+	notifiers, err = NewNotifiers(app.NotifyEntry{MSTeamsHookURL: "https://example.com/hook"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(notifiers))
+	assert.Equal(t, "https://example.com/hook", notifiers[1].(*MSTeamsNotifier).HookURL)
+	assert.Equal(t, ChannelConsole, notifiers[0].Channel())
+
+	// third party channel
+	fake := &fakeNotifier{channel: "fake"}
+	RegisterChannel("fake", func(settings app.NotifyEntry) (Notifier, bool, error) {
+		return fake, true, nil
+	})
+	defer unregisterChannel("fake")
+	assert.Contains(t, Channels(), "fake")
+	notifiers, err = NewNotifiers(app.NotifyEntry{})
+	assert.Nil(t, err)
+	assert.Equal(t, fake, notifiers[len(notifiers)-1])
+
+	// registering the same name replaces the channel
+	RegisterChannel("fake", func(settings app.NotifyEntry) (Notifier, bool, error) {
+		return nil, false, errors.New("bad settings")
+	})
+	assert.Equal(t, 1, countOf(Channels(), "fake"))
+	_, err = NewNotifiers(app.NotifyEntry{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "fake")
+}
+
+func unregisterChannel(name string) {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+	for i, c := range channels {
+		if c.name == name {
+			channels = append(channels[:i], channels[i+1:]...)
+			return
+		}
+	}
+}
+
+func countOf(names []string, name string) int {
+	count := 0
+	for _, n := range names {
+		if n == name {
+			count++
+		}
+	}
+	return count
+}
+
+func TestChannelsSelection(t *testing.T) {
+	settings := app.NotifyEntry{
+		MSTeamsHookURL:    "https://example.com/hook",
+		DiscordWebhookURL: "https://example.com/discord",
+		Channels:          []string{ChannelDiscord},
+	}
+	// console is always on
+	notifiers, err := NewNotifiers(settings)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(notifiers))
+	assert.Equal(t, ChannelConsole, notifiers[0].Channel())
+	assert.Equal(t, ChannelDiscord, notifiers[1].Channel())
+
+	// selected but not configured
+	settings.Channels = []string{ChannelDiscord, ChannelTelegram}
+	_, err = NewNotifiers(settings)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), ChannelTelegram)
+
+	settings.Channels = []string{"pager"}
+	_, err = NewNotifiers(settings)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown")
+
+	// templates that don't load
+	settings.Channels = nil
+	settings.Templates = "testdata/missing-templates"
+	_, err = NewNotifiers(settings)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "templates")
+}
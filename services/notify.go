@@ -1,126 +1,387 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
-	md "github.com/JohannesKaufmann/html-to-markdown"
 	"github.com/kevincobain2000/go-app-reviews-scraper/app"
-	gmt "github.com/kevincobain2000/go-msteams/src"
 )
 
+// Notify sends every notification of an app to all its channels, see @Notifier
+// A channel that fails doesn't stop the others, and its error is returned along with the channel name
 type Notify struct {
+	Notifiers []Notifier
+	// Rules select the reviews that are notified on each channel, see @NotifyRules.Allow
+	Rules NotifyRules
+	// Lookback is how long ago a new review can be first scraped, and how long before that it can be rated, and still be notified
+	// so that the old reviews of the first scrape of an app aren't, see @IsNewReview. Default is DefaultNotifyLookback
+	Lookback time.Duration
+	// Digest is daily or weekly when a digest is sent instead of the notifications of the reviews and the ratings
+	// see @Notify.NotifyDigest, and DigestSchedule is when serve sends it
+	Digest         string
+	DigestSchedule string
+
+	// notifications records the reviews delivered on each channel, so that they are delivered once
+	// nil doesn't record them, and every review is delivered
+	notifications *NotificationsRepository
+	// buffered are the notifications of the run kept by the channels until its end, see @BufferedNotifier
+	// they are recorded once the run is sent, see @Notify.EndRun
+	mu       sync.Mutex
+	buffered map[string][]bufferedNotification
 }
 
-func NewNotify() *Notify {
-	return &Notify{}
+// bufferedNotification is a notification of a review that is recorded at the end of the run
+type bufferedNotification struct {
+	review       ReviewModel
+	notification string
+	revisionID   int
 }
 
-// NotifyNewReviews sends a notification to a list of email addresses
-// sends notification on microsoft teams
-// also stdout the message to console in markdown of the message (html)
-// when the env for MS Teams hook or EMAIL addresses are not sent the notifications are not sent
-func (n *Notify) NotifyNewReviews(reviews []ReviewModel) error {
-	now := time.Now()
-	for _, review := range reviews {
+// DefaultNotifyLookback is the default Lookback of Notify
+const DefaultNotifyLookback = 24 * time.Hour
 
-		if review.RatedAt.Format("02-Jan-2006") != now.Format("02-Jan-2006") {
-			log.Println("[info] not today's review, skipping notification")
-			continue
+// NewNotify creates a new Notify with the channels configured in the notify settings of an app
+// Empty settings are the same as the env
+func NewNotify(settings app.NotifyEntry) (*Notify, error) {
+	config := app.NewConfig().AppConfig
+	if settings.MSTeamsHookURL == "" {
+		settings.MSTeamsHookURL = config.MSTeamsHookURL
+	}
+	if settings.SlackWebhookURL == "" {
+		settings.SlackWebhookURL = config.SlackWebhookURL
+	}
+	if settings.SlackBotToken == "" {
+		settings.SlackBotToken = config.SlackBotToken
+	}
+	if settings.SlackChannel == "" {
+		settings.SlackChannel = config.SlackChannel
+	}
+	if len(settings.EmailTo) == 0 {
+		settings.EmailTo = config.EmailTo
+	}
+	settings.EmailDigest = settings.EmailDigest || config.EmailDigest
+	if len(settings.WebhookURLs) == 0 {
+		settings.WebhookURLs = config.WebhookURLs
+	}
+	if settings.WebhookSecret == "" {
+		settings.WebhookSecret = config.WebhookSecret
+	}
+	if settings.DiscordWebhookURL == "" {
+		settings.DiscordWebhookURL = config.DiscordWebhookURL
+	}
+	if settings.TelegramBotToken == "" {
+		settings.TelegramBotToken = config.TelegramBotToken
+	}
+	if settings.TelegramChatID == "" {
+		settings.TelegramChatID = config.TelegramChatID
+	}
+	if settings.MattermostWebhookURL == "" {
+		settings.MattermostWebhookURL = config.MattermostWebhookURL
+	}
+	if settings.GoogleChatWebhookURL == "" {
+		settings.GoogleChatWebhookURL = config.GoogleChatWebhookURL
+	}
+	if len(settings.Channels) == 0 {
+		settings.Channels = config.NotifyChannels
+	}
+	if settings.Templates == "" {
+		settings.Templates = config.NotifyTemplates
+	}
+	if settings.Timezone == "" {
+		settings.Timezone = config.NotifyTimezone
+	}
+	notifiers, err := NewNotifiers(settings)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := NewNotifyRules(settings.Rules)
+	if err != nil {
+		return nil, err
+	}
+	if settings.Lookback == "" {
+		settings.Lookback = config.NotifyLookback
+	}
+	lookback := DefaultNotifyLookback
+	if settings.Lookback != "" {
+		lookback, err = time.ParseDuration(settings.Lookback)
+		if err != nil || lookback <= 0 {
+			return nil, fmt.Errorf("[error] notify lookback %s is not a duration, eg. 72h", settings.Lookback)
 		}
-		// send message to MS Teams
-		title := "You have a new review!"
-		subtitle := "Store (" + review.Store + ")"
-		subject := "App (" + review.AppName + ")"
-		color := ""
-		proxy := ""
-		message := ""
-		message += "<h2>" + review.Title + "</h2>" + "<br>"
-		message += "<h3>@" + review.Username + "</h3>" + "<br>"
-		message += "<h4>" + review.RatedAt.Format("02-Jan-2006") + "</h4>" + "<br>"
-		message += "<h5>" + "Rating " + strings.Repeat("★", review.Rating) + strings.Repeat("☆", 5-review.Rating) + "</h5>" + "<br>"
-		message += "<p>" + review.Body + "<p>" + "<br>"
-		// For ascii output
-		converter := md.NewConverter("", true, nil)
-		markdown, err := converter.ConvertString(message)
-		if err != nil {
-			return err
+	}
+	if settings.Digest == "" {
+		settings.Digest = config.NotifyDigest
+	}
+	if settings.DigestSchedule == "" {
+		settings.DigestSchedule = config.NotifyDigestSchedule
+	}
+	if settings.Digest != "" {
+		if _, err := DigestPeriod(settings.Digest); err != nil {
+			return nil, err
 		}
-		log.Println("[info] Printing to console")
-		for _, line := range strings.Split(markdown, "\n") {
-			if strings.TrimSpace(line) != "" {
-				fmt.Println(line)
-			}
+		if settings.DigestSchedule == "" {
+			settings.DigestSchedule = DefaultDigestSchedule(settings.Digest)
+		}
+		if _, err := ParseSchedule(settings.DigestSchedule); err != nil {
+			return nil, err
 		}
+	}
+	return &Notify{
+		Notifiers:      notifiers,
+		Rules:          rules,
+		Lookback:       lookback,
+		Digest:         settings.Digest,
+		DigestSchedule: settings.DigestSchedule,
+		notifications:  NewNotificationsRepository(),
+	}, nil
+}
 
-		c := app.NewConfig()
+// NotifyRun is the scrape of an app on a store that the notifications are sent for
+type NotifyRun struct {
+	AppName string
+	Store   string
+	// URL is the reviews url that was scraped
+	URL string
+}
 
-		// For MS Teams
-		if c.AppConfig.MSTeamsHookURL != "" {
-			log.Println("[info] Sending to MS Teams")
-			if err := gmt.Send(title, subtitle, subject, color, message, c.AppConfig.MSTeamsHookURL, proxy); err != nil {
-				return err
-			}
+// RunNotifier is a Notifier that keeps the notifications of a run together, eg. in a thread or a digest
+// BeginRun is called before the notifications of every run, and EndRun after them
+type RunNotifier interface {
+	BeginRun(run NotifyRun)
+	EndRun() error
+}
+
+// BufferedNotifier is a RunNotifier that keeps some notifications until EndRun, eg. the email digest of a run
+// Buffered returns true when the notification is sent at EndRun, so that it is recorded as delivered only then
+type BufferedNotifier interface {
+	RunNotifier
+	Buffered(notification string) bool
+}
+
+// ContextNotifier is a Notifier that waits while sending, eg. to retry, and stops waiting when the context is done
+type ContextNotifier interface {
+	SetContext(ctx context.Context)
+}
+
+// SetContext sets the context of the channels that wait while sending, eg. of the daemon, see @ContextNotifier
+func (n *Notify) SetContext(ctx context.Context) {
+	for _, notifier := range n.Notifiers {
+		if c, ok := notifier.(ContextNotifier); ok {
+			c.SetContext(ctx)
 		}
 	}
-	return nil
 }
 
-// NotifyReviewCount sends a notification to a list of email addresses
-// sends notification on microsoft teams
-// also stdout the message to console in markdown of the message (html)
-// when the env for MS Teams hook or EMAIL addresses are not sent the notifications are not sent
-func (n *Notify) NotifyReviewCount(currentReviewCount, lastReviewCount ReviewCountsModel) error {
-	uu := NewUtils()
-	title := "You have a new rating!"
-	subtitle := "Store (" + currentReviewCount.Store + ")"
-	subject := "App (" + currentReviewCount.AppName + ")"
-	color := ""
-	proxy := ""
-	message := ""
-
-	message += "<b>Now </b>" + currentReviewCount.CreatedAt.Format("02-Jan-2006") + "<br>"
-	message += fmt.Sprintf("Total reviews: %d", currentReviewCount.Total) + "<br>"
-	message += fmt.Sprintf("Average rating: %.2f", uu.AverageRating(currentReviewCount)) + "<br>"
-	message += fmt.Sprintf("★★★★★: %d", currentReviewCount.Rating5Percentage) + "%" + "<br>"
-	message += fmt.Sprintf("★★★★☆: %d", currentReviewCount.Rating4Percentage) + "%" + "<br>"
-	message += fmt.Sprintf("★★★☆☆: %d", currentReviewCount.Rating3Percentage) + "%" + "<br>"
-	message += fmt.Sprintf("★★☆☆☆: %d", currentReviewCount.Rating2Percentage) + "%" + "<br>"
-	message += fmt.Sprintf("★☆☆☆☆: %d", currentReviewCount.Rating1Percentage) + "%" + "<br>"
-
-	if lastReviewCount.Total > 0 {
-		message += "<b>Before </b>" + lastReviewCount.CreatedAt.Format("02-Jan-2006") + "<br>"
-		message += fmt.Sprintf("Average rating: %.2f", uu.AverageRating(lastReviewCount)) + "<br>"
-		message += fmt.Sprintf("Total reviews: %d", lastReviewCount.Total) + "<br>"
-		message += fmt.Sprintf("★★★★★: %d", lastReviewCount.Rating5Percentage) + "%" + "<br>"
-		message += fmt.Sprintf("★★★★☆: %d", lastReviewCount.Rating4Percentage) + "%" + "<br>"
-		message += fmt.Sprintf("★★★☆☆: %d", lastReviewCount.Rating3Percentage) + "%" + "<br>"
-		message += fmt.Sprintf("★★☆☆☆: %d", lastReviewCount.Rating2Percentage) + "%" + "<br>"
-		message += fmt.Sprintf("★☆☆☆☆: %d", lastReviewCount.Rating1Percentage) + "%" + "<br>"
-	}
-
-	// For ascii output
-	converter := md.NewConverter("", true, nil)
-	markdown, err := converter.ConvertString(message)
+// BeginRun starts the notifications of a run on the channels that keep them together, see @RunNotifier
+func (n *Notify) BeginRun(run NotifyRun) {
+	n.mu.Lock()
+	n.buffered = nil
+	n.mu.Unlock()
+	for _, notifier := range n.Notifiers {
+		if r, ok := notifier.(RunNotifier); ok {
+			r.BeginRun(run)
+		}
+	}
+}
+
+// EndRun ends the notifications of the run on the channels that keep them together, see @RunNotifier
+// and records the notifications they kept once they are sent, so that they are sent again on the next run when they fail
+func (n *Notify) EndRun() error {
+	return n.fanOut("end of run", func(notifier Notifier) error {
+		r, ok := notifier.(RunNotifier)
+		if !ok {
+			return nil
+		}
+		channel := notifier.Channel()
+		n.mu.Lock()
+		buffered := n.buffered[channel]
+		delete(n.buffered, channel)
+		n.mu.Unlock()
+		if err := r.EndRun(); err != nil {
+			return err
+		}
+		errs := []error{}
+		for _, b := range buffered {
+			_, err := n.notifications.InsertNotification(b.review, channel, b.notification, b.revisionID)
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// NotifyUndelivered sends the new reviews of the app on the store, see @IsNewReview,
+// and the edits of its reviews scraped within the Lookback, on the channels they weren't delivered on yet
+// so that the reviews of a run that failed halfway, eg. on a channel that was down, are delivered on the next run
+// With a Digest they aren't notified, as they are in the digest
+func (n *Notify) NotifyUndelivered(appName, store string) error {
+	if n.Digest != "" {
+		log.Printf("[info] reviews of %s on %s are sent in the %s digest, skipping notification\n", appName, store, n.Digest)
+		return nil
+	}
+	repo := NewReviewsRepository()
+	since := time.Now().Add(-n.lookback())
+	reviews, err := repo.FindNewReviews(appName, store, since, n.lookback())
+	if err != nil {
+		return err
+	}
+	edits, err := repo.FindReviewEdits(appName, store, since)
 	if err != nil {
 		return err
 	}
-	log.Println("[info] Printing to console")
-	for _, line := range strings.Split(markdown, "\n") {
-		if strings.TrimSpace(line) != "" {
-			fmt.Println(line)
+	return errors.Join(n.NotifyNewReviews(reviews), n.NotifyUpdatedReviews(edits))
+}
+
+// IsNewReview returns true when the review was first scraped since the time, and rated within the lookback before it was scraped
+// So the reviews rated before a downtime are still new when they are scraped after it,
+// but not the reviews of the first scrape of an app, which are rated long before it
+func IsNewReview(review ReviewModel, since time.Time, lookback time.Duration) bool {
+	if review.CreatedAt == nil {
+		return true
+	}
+	if review.CreatedAt.Before(since) {
+		return false
+	}
+	return review.RatedAt == nil || !review.RatedAt.Before(review.CreatedAt.Add(-lookback))
+}
+
+// NotifyNewReviews sends a notification for each new review, see @IsNewReview
+// on all the channels whose rules allow it and that it wasn't delivered on yet, eg. stdout in markdown and microsoft teams
+func (n *Notify) NotifyNewReviews(reviews []ReviewModel) error {
+	since := time.Now().Add(-n.lookback())
+	errs := []error{}
+	for _, review := range reviews {
+		if !IsNewReview(review, since, n.lookback()) {
+			log.Printf("[info] review %d isn't new within the lookback of %s, skipping notification\n", review.ID, n.lookback())
+			continue
+		}
+		errs = append(errs, n.fanOutReview("new review", NotificationNewReview, review, 0, func(notifier Notifier) error {
+			return notifier.NotifyNewReview(review)
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+// NotifyUpdatedReviews sends a notification for the reviews edited by the users
+// on all the channels whose rules allow it and that the edit wasn't delivered on yet
+// edits are found when the review is scraped again, so unlike new reviews they are not limited by their rating date
+func (n *Notify) NotifyUpdatedReviews(edits []ReviewEdit) error {
+	errs := []error{}
+	for _, edit := range edits {
+		errs = append(errs, n.fanOutReview("updated review", NotificationUpdatedReview, edit.Review, edit.Revision.ID, func(notifier Notifier) error {
+			return notifier.NotifyUpdatedReview(edit)
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+// NotifyReviewCount sends a notification for the new rating summary, along with the last one
+// With a Digest it isn't notified, as the change of the rating is in the digest
+func (n *Notify) NotifyReviewCount(currentReviewCount, lastReviewCount ReviewCountsModel) error {
+	if n.Digest != "" {
+		log.Printf("[info] rating of %s on %s is sent in the %s digest, skipping notification\n", currentReviewCount.AppName, currentReviewCount.Store, n.Digest)
+		return nil
+	}
+	return n.fanOut("rating", func(notifier Notifier) error {
+		return notifier.NotifyReviewCount(currentReviewCount, lastReviewCount)
+	})
+}
+
+// NotifyDigest sends the digest on the channels that can send it, see @DigestNotifier
+func (n *Notify) NotifyDigest(digest Digest) error {
+	return n.fanOut("digest", func(notifier Notifier) error {
+		d, ok := notifier.(DigestNotifier)
+		if !ok {
+			log.Printf("[info] %s can't send the digest, skipping notification\n", notifier.Channel())
+			return nil
+		}
+		return d.NotifyDigest(digest)
+	})
+}
+
+// NotifyError sends a notification that the app on the store couldn't be scraped or saved
+func (n *Notify) NotifyError(appName, store string, err error) error {
+	return n.fanOut("error", func(notifier Notifier) error {
+		return notifier.NotifyError(appName, store, err)
+	})
+}
+
+// fanOut sends the event to every channel
+// returns the errors of all the channels that failed
+func (n *Notify) fanOut(event string, send func(notifier Notifier) error) error {
+	errs := []error{}
+	for _, notifier := range n.Notifiers {
+		if err := send(notifier); err != nil {
+			err = fmt.Errorf("[error] %s notification on %s failed: %w", event, notifier.Channel(), err)
+			log.Println(err)
+			errs = append(errs, err)
 		}
 	}
+	return errors.Join(errs...)
+}
 
-	c := app.NewConfig()
-	// For MS Teams
-	if c.AppConfig.MSTeamsHookURL != "" {
-		log.Println("[info] Sending to MS Teams")
-		if err := gmt.Send(title, subtitle, subject, color, message, c.AppConfig.MSTeamsHookURL, proxy); err != nil {
+// fanOutReview sends the event of the review to the channels whose rules allow it, see @NotifyRules.Allow
+// and that it wasn't delivered on yet, and records the delivery on each channel that succeeded
+func (n *Notify) fanOutReview(event, notification string, review ReviewModel, revisionID int, send func(notifier Notifier) error) error {
+	return n.fanOut(event, func(notifier Notifier) error {
+		channel := notifier.Channel()
+		if !n.Rules.Allow(channel, review) {
+			log.Printf("[info] review %d doesn't match the rules of %s, skipping notification\n", review.ID, channel)
+			return nil
+		}
+		if n.notifications == nil || review.ID == 0 {
+			return send(notifier)
+		}
+		delivered, err := n.notifications.IsDelivered(channel, notification, review.ID, revisionID)
+		if err != nil || delivered {
+			return err
+		}
+		if err := send(notifier); err != nil {
 			return err
 		}
+		if b, ok := notifier.(BufferedNotifier); ok && b.Buffered(notification) {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if n.buffered == nil {
+				n.buffered = map[string][]bufferedNotification{}
+			}
+			n.buffered[channel] = append(n.buffered[channel], bufferedNotification{review: review, notification: notification, revisionID: revisionID})
+			return nil
+		}
+		_, err = n.notifications.InsertNotification(review, channel, notification, revisionID)
+		return err
+	})
+}
+
+func (n *Notify) lookback() time.Duration {
+	if n.Lookback <= 0 {
+		return DefaultNotifyLookback
+	}
+	return n.Lookback
+}
+
+// stars returns the rating as stars, eg. ★★★☆☆
+func stars(rating int) string {
+	rating = max(0, min(5, rating))
+	return strings.Repeat("★", rating) + strings.Repeat("☆", 5-rating)
+}
+
+// formatDate returns the date as it is shown in the notifications, eg. 02-Jan-2006
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return ""
 	}
-	return nil
+	return t.Format("02-Jan-2006")
+}
+
+// notifyMessage is a notification in html, as sent to MS Teams and by email, and printed to console
+// The texts of the users are escaped in the html
+type notifyMessage struct {
+	Title    string
+	Subtitle string
+	Subject  string
+	HTML     string
 }
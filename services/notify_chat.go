@@ -0,0 +1,202 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chatContent is a notification for the chat channels, eg. Discord or Telegram
+// Each channel renders it natively, instead of the html of MS Teams
+type chatContent struct {
+	// Title is what the notification is about, eg. You have a new review!
+	Title   string
+	AppName string
+	Store   string
+	// Rating is of the review, 0 when it isn't about a review
+	Rating int
+	// Stars, Heading and Byline are of the review, eg. ★★★★☆, its title, and @username · 02-Jan-2006
+	Stars   string
+	Heading string
+	Byline  string
+	// Body is the body of the review, or the error when IsError
+	Body    string
+	IsError bool
+	// Sections are the rating summaries, Now and Before
+	Sections []chatSection
+	// URL is where the review is viewed in the store, empty when it isn't known
+	URL string
+	// Text is of the template of the channel, see @Templates
+	// When set it is sent as is, instead of the heading, the body and the sections
+	Text string
+}
+
+// chatSection is a titled list of lines, eg. the rating summary
+type chatSection struct {
+	Name  string
+	Lines []string
+}
+
+func newReviewChat(review ReviewModel, runURL string) chatContent {
+	return chatContent{
+		Title:   "You have a new review!",
+		AppName: review.AppName,
+		Store:   review.Store,
+		Rating:  review.Rating,
+		Stars:   stars(review.Rating),
+		Heading: review.Title,
+		Byline:  "@" + review.Username + " · " + formatDate(review.RatedAt),
+		Body:    review.Body,
+		URL:     reviewStoreURL(runURL, review),
+	}
+}
+
+// updatedReviewChat shows the rating before and after the edit, and a word diff of the title and the body
+func updatedReviewChat(edit ReviewEdit, runURL string) chatContent {
+	uu := NewUtils()
+	review := edit.Review
+	revision := edit.Revision
+	body := uu.DiffWords(revision.Body, review.Body)
+	if revision.Title != review.Title {
+		body = "Title: " + uu.DiffWords(revision.Title, review.Title) + "\n\n" + body
+	}
+	return chatContent{
+		Title:   "A review was updated!",
+		AppName: review.AppName,
+		Store:   review.Store,
+		Rating:  review.Rating,
+		Stars:   stars(revision.Rating) + " → " + stars(review.Rating),
+		Heading: review.Title,
+		Byline:  "@" + review.Username + " · " + formatDate(revision.RatedAt) + " → " + formatDate(review.RatedAt),
+		Body:    body,
+		URL:     reviewStoreURL(runURL, review),
+	}
+}
+
+func reviewCountChat(current, last ReviewCountsModel) chatContent {
+	content := chatContent{
+		Title:    "You have a new rating!",
+		AppName:  current.AppName,
+		Store:    current.Store,
+		Sections: []chatSection{{Name: "Now " + formatDate(current.CreatedAt), Lines: ratingLines(current)}},
+	}
+	if last.Total > 0 {
+		content.Sections = append(content.Sections, chatSection{Name: "Before " + formatDate(last.CreatedAt), Lines: ratingLines(last)})
+	}
+	return content
+}
+
+func errorChat(appName, store string, err error) chatContent {
+	return chatContent{
+		Title:   "Scraping reviews failed!",
+		AppName: appName,
+		Store:   store,
+		Body:    err.Error(),
+		IsError: true,
+	}
+}
+
+// ratingLines are the lines of the rating summary
+func ratingLines(count ReviewCountsModel) []string {
+	return []string{
+		fmt.Sprintf("Total reviews: %d", count.Total),
+		fmt.Sprintf("Average rating: %.2f", NewUtils().AverageRating(count)),
+		fmt.Sprintf("★★★★★ %d%%", count.Rating5Percentage),
+		fmt.Sprintf("★★★★☆ %d%%", count.Rating4Percentage),
+		fmt.Sprintf("★★★☆☆ %d%%", count.Rating3Percentage),
+		fmt.Sprintf("★★☆☆☆ %d%%", count.Rating2Percentage),
+		fmt.Sprintf("★☆☆☆☆ %d%%", count.Rating1Percentage),
+	}
+}
+
+// reviewStoreURL returns where the review is viewed in the store, from the reviews url that was scraped
+// On the Play Store it opens the review itself
+func reviewStoreURL(runURL string, review ReviewModel) string {
+	if runURL == "" {
+		return ""
+	}
+	if review.Store != StoreAndroid || review.ExternalID == "" || strings.HasPrefix(review.ExternalID, hashExternalIDPrefix) {
+		return runURL
+	}
+	u, err := url.Parse(runURL)
+	if err != nil {
+		return runURL
+	}
+	q := u.Query()
+	q.Set("reviewId", review.ExternalID)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// chatRun keeps the url of the current run, for the "View in store" links, see @RunNotifier
+type chatRun struct {
+	mu  sync.Mutex
+	url string
+}
+
+// BeginRun see @RunNotifier
+func (c *chatRun) BeginRun(run NotifyRun) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.url = run.URL
+}
+
+// EndRun see @RunNotifier
+func (c *chatRun) EndRun() error {
+	return nil
+}
+
+func (c *chatRun) runURL() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.url
+}
+
+// postJSON posts the payload and returns the response body, or an error when the response is not 2xx
+func postJSON(transport http.RoundTripper, endpoint string, payload interface{}) ([]byte, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	client := &http.Client{Transport: transport, Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("[error] %s responded with %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// truncate cuts the text to limit runes
+func truncate(text string, limit int) string {
+	if r := []rune(text); len(r) > limit {
+		return string(r[:limit-1]) + "…"
+	}
+	return text
+}
+
+// escapeMarkdown escapes the text from the users for markdown, eg. of Discord and Mattermost
+func escapeMarkdown(text string) string {
+	return strings.NewReplacer(
+		`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`",
+		"|", `\|`, "[", `\[`, "]", `\]`, ">", `\>`, "#", `\#`,
+	).Replace(text)
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"github.com/stretchr/testify/assert"
+)
+
+// chatServer is a chat webhook, that keeps the JSON posted to it and responds with the response
+type chatServer struct {
+	*httptest.Server
+	response string
+	mu       sync.Mutex
+	paths    []string
+	bodies   []map[string]interface{}
+}
+
+func newChatServer(t *testing.T, status int, response string) *chatServer {
+	s := &chatServer{response: response}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal(b, &body))
+		s.mu.Lock()
+		s.paths = append(s.paths, r.URL.Path)
+		s.bodies = append(s.bodies, body)
+		s.mu.Unlock()
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(s.response))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *chatServer) last(t *testing.T) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.NotEmpty(t, s.bodies)
+	return s.bodies[len(s.bodies)-1]
+}
+
+func testChatReview() ReviewModel {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	return ReviewModel{AppName: "candy-crush", Store: StoreAndroid, ExternalID: "gp:abc", Username: "sugar", Title: "Love *it*", Body: "So <sweet>", Rating: 2, RatedAt: &now}
+}
+
+func TestReviewStoreURL(t *testing.T) {
+	runURL := "https://play.google.com/store/apps/details?id=com.king.candycrushsaga&showAllReviews=true"
+	review := testChatReview()
+	assert.Equal(t, "", reviewStoreURL("", review))
+	assert.Contains(t, reviewStoreURL(runURL, review), "reviewId=gp%3Aabc")
+	review.Store = StoreIOS
+	assert.Equal(t, runURL, reviewStoreURL(runURL, review))
+	assert.Equal(t, "ab…", truncate("abcd", 3))
+	assert.Equal(t, `\*it\*`, escapeMarkdown("*it*"))
+}
+
+func TestDiscordNotifier(t *testing.T) {
+	server := newChatServer(t, http.StatusNoContent, "")
+	d := NewDiscordNotifier(server.URL)
+	d.BeginRun(NotifyRun{URL: "https://play.google.com/store/apps/details?id=com.king.candycrushsaga"})
+	assert.Nil(t, d.NotifyNewReview(testChatReview()))
+
+	embed := server.last(t)["embeds"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "You have a new review!", embed["title"])
+	assert.Equal(t, float64(discordColorBad), embed["color"])
+	assert.Contains(t, embed["description"], `Love \*it\*`)
+	assert.Contains(t, embed["url"], "reviewId=")
+
+	assert.Nil(t, d.NotifyReviewCount(ReviewCountsModel{AppName: "candy-crush", Store: StoreAndroid, Total: 10}, ReviewCountsModel{Total: 9}))
+	embed = server.last(t)["embeds"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, float64(discordColorInfo), embed["color"])
+	assert.Equal(t, 4, len(embed["fields"].([]interface{})))
+
+	failing := newChatServer(t, http.StatusBadRequest, `{"message": "Invalid Webhook Token"}`)
+	err := NewDiscordNotifier(failing.URL).NotifyError("candy-crush", StoreIOS, errors.New("failed"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Invalid Webhook Token")
+}
+
+func TestTelegramNotifier(t *testing.T) {
+	server := newChatServer(t, http.StatusOK, `{"ok": true}`)
+	tg := NewTelegramNotifier("123:token", "@reviews")
+	tg.BaseURL = server.URL
+	tg.BeginRun(NotifyRun{URL: "https://apps.apple.com/app/id553834731"})
+	assert.Nil(t, tg.NotifyNewReview(testChatReview()))
+
+	body := server.last(t)
+	assert.Equal(t, "/bot123:token/sendMessage", server.paths[0])
+	assert.Equal(t, "@reviews", body["chat_id"])
+	assert.Equal(t, "HTML", body["parse_mode"])
+	text := body["text"].(string)
+	assert.Contains(t, text, "<b>You have a new review!</b>")
+	assert.Contains(t, text, "So &lt;sweet&gt;")
+	assert.Contains(t, text, ">View in store</a>")
+
+	// long bodies are cut to the limit
+	review := testChatReview()
+	review.Body = strings.Repeat("a", 2*telegramTextLimit)
+	assert.Nil(t, tg.NotifyNewReview(review))
+	assert.LessOrEqual(t, len([]rune(server.last(t)["text"].(string))), telegramTextLimit)
+
+	server.response = `{"ok": false, "description": "Bad Request: chat not found"}`
+	err := tg.NotifyError("candy-crush", StoreIOS, errors.New("failed"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "chat not found")
+
+	_, err = NewNotifiers(app.NotifyEntry{TelegramBotToken: "123:token"})
+	assert.NotNil(t, err)
+}
+
+func TestMattermostNotifier(t *testing.T) {
+	server := newChatServer(t, http.StatusOK, "ok")
+	m := NewMattermostNotifier(server.URL)
+	assert.Nil(t, m.NotifyNewReview(testChatReview()))
+	text := server.last(t)["text"].(string)
+	assert.Contains(t, text, "#### You have a new review!")
+	assert.Contains(t, text, `> So <sweet\>`)
+	assert.NotContains(t, text, "View in store")
+
+	assert.Nil(t, m.NotifyError("candy-crush", StoreIOS, errors.New("[error] No reviews found")))
+	assert.Contains(t, server.last(t)["text"], "```\n[error] No reviews found\n```")
+}
+
+func TestGoogleChatNotifier(t *testing.T) {
+	server := newChatServer(t, http.StatusOK, "{}")
+	g := NewGoogleChatNotifier(server.URL)
+	g.BeginRun(NotifyRun{URL: "https://apps.apple.com/app/id553834731"})
+	review := testChatReview()
+	review.Store = StoreIOS
+	assert.Nil(t, g.NotifyNewReview(review))
+
+	cards := server.last(t)["cardsV2"].([]interface{})
+	card := cards[0].(map[string]interface{})["card"].(map[string]interface{})
+	header := card["header"].(map[string]interface{})
+	assert.Equal(t, "You have a new review!", header["title"])
+	assert.Equal(t, "App (candy-crush) · Store (ios)", header["subtitle"])
+	b, _ := json.Marshal(card["sections"])
+	assert.Contains(t, string(b), "So \\u0026lt;sweet\\u0026gt;")
+	assert.Contains(t, string(b), `"openLink":{"url":"https://apps.apple.com/app/id553834731"}`)
+
+	assert.Nil(t, g.NotifyReviewCount(ReviewCountsModel{AppName: "candy-crush", Store: StoreIOS, Total: 10}, ReviewCountsModel{}))
+	card = server.last(t)["cardsV2"].([]interface{})[0].(map[string]interface{})["card"].(map[string]interface{})
+	assert.Equal(t, 1, len(card["sections"].([]interface{})))
+}
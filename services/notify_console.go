@@ -0,0 +1,84 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+)
+
+// ChannelConsole prints the notifications to stdout, it is always on
+const ChannelConsole = "console"
+
+func init() {
+	RegisterChannel(ChannelConsole, func(settings app.NotifyEntry) (Notifier, bool, error) {
+		return NewConsoleNotifier(), true, nil
+	})
+}
+
+// ConsoleNotifier prints the notifications to stdout in markdown of the message (html)
+type ConsoleNotifier struct {
+	templated
+}
+
+// NewConsoleNotifier creates a new ConsoleNotifier
+func NewConsoleNotifier() *ConsoleNotifier {
+	return &ConsoleNotifier{}
+}
+
+// Channel see @Notifier
+func (c *ConsoleNotifier) Channel() string {
+	return ChannelConsole
+}
+
+// NotifyNewReview see @Notifier
+func (c *ConsoleNotifier) NotifyNewReview(review ReviewModel) error {
+	return c.print(TemplateNewReview, newReviewData(review, ""))
+}
+
+// NotifyUpdatedReview see @Notifier
+func (c *ConsoleNotifier) NotifyUpdatedReview(edit ReviewEdit) error {
+	return c.print(TemplateUpdatedReview, updatedReviewData(edit, ""))
+}
+
+// NotifyReviewCount see @Notifier
+func (c *ConsoleNotifier) NotifyReviewCount(current, last ReviewCountsModel) error {
+	return c.print(TemplateRating, ratingData(current, last))
+}
+
+// NotifyError see @Notifier
+func (c *ConsoleNotifier) NotifyError(appName, store string, err error) error {
+	return c.print(TemplateError, errorData(appName, store, err))
+}
+
+// NotifyDigest prints the digest in markdown, or its template when there is one, see @DigestNotifier
+func (c *ConsoleNotifier) NotifyDigest(digest Digest) error {
+	if c.templates.custom(ChannelConsole, TemplateDigest) {
+		return c.print(TemplateDigest, digestData(digest))
+	}
+	log.Println("[info] Printing to console")
+	fmt.Print(digest.Markdown())
+	return nil
+}
+
+// print prints the message (html) of the event as markdown, for ascii output
+func (c *ConsoleNotifier) print(event string, data TemplateData) error {
+	message, err := c.message(ChannelConsole, event, data)
+	if err != nil {
+		return err
+	}
+	converter := md.NewConverter("", true, nil)
+	markdown, err := converter.ConvertString(message.HTML)
+	if err != nil {
+		return err
+	}
+	log.Println("[info] Printing to console")
+	for _, line := range strings.Split(markdown, "\n") {
+		if strings.TrimSpace(line) != "" {
+			fmt.Println(line)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+)
+
+// ChannelDiscord sends the notifications to a Discord webhook, when its URL is set
+const ChannelDiscord = "discord"
+
+// Colors of the Discord embeds
+const (
+	discordColorGood  = 0x2ECC71
+	discordColorOkay  = 0xF1C40F
+	discordColorBad   = 0xE74C3C
+	discordColorInfo  = 0x3498DB
+	discordTextLimit  = 4096
+	discordFieldLimit = 1024
+)
+
+func init() {
+	RegisterChannel(ChannelDiscord, func(settings app.NotifyEntry) (Notifier, bool, error) {
+		if settings.DiscordWebhookURL == "" {
+			return nil, false, nil
+		}
+		return NewDiscordNotifier(settings.DiscordWebhookURL), true, nil
+	})
+}
+
+// DiscordNotifier sends the notifications to a Discord webhook as embeds
+type DiscordNotifier struct {
+	WebhookURL string
+	// Transport is the http transport the messages are sent with
+	// When nil, http.DefaultTransport is used
+	Transport http.RoundTripper
+
+	chatRun
+	templated
+}
+
+// NewDiscordNotifier creates a new DiscordNotifier
+func NewDiscordNotifier(webhookURL string) *DiscordNotifier {
+	return &DiscordNotifier{
+		WebhookURL: webhookURL,
+	}
+}
+
+// discordEmbed is a rich message of Discord
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	URL         string         `json:"url,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Timestamp   string         `json:"timestamp"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// Channel see @Notifier
+func (d *DiscordNotifier) Channel() string {
+	return ChannelDiscord
+}
+
+// NotifyNewReview see @Notifier
+func (d *DiscordNotifier) NotifyNewReview(review ReviewModel) error {
+	return d.send(TemplateNewReview, newReviewData(review, d.runURL()), newReviewChat(review, d.runURL()))
+}
+
+// NotifyUpdatedReview see @Notifier
+func (d *DiscordNotifier) NotifyUpdatedReview(edit ReviewEdit) error {
+	return d.send(TemplateUpdatedReview, updatedReviewData(edit, d.runURL()), updatedReviewChat(edit, d.runURL()))
+}
+
+// NotifyReviewCount see @Notifier
+func (d *DiscordNotifier) NotifyReviewCount(current, last ReviewCountsModel) error {
+	return d.send(TemplateRating, ratingData(current, last), reviewCountChat(current, last))
+}
+
+// NotifyError see @Notifier
+func (d *DiscordNotifier) NotifyError(appName, store string, err error) error {
+	return d.send(TemplateError, errorData(appName, store, err), errorChat(appName, store, err))
+}
+
+// NotifyDigest see @DigestNotifier
+func (d *DiscordNotifier) NotifyDigest(digest Digest) error {
+	return d.send(TemplateDigest, digestData(digest), digestChat(digest))
+}
+
+// send sends the content of the event, or its template when the channel has one, see @Templates.Render
+func (d *DiscordNotifier) send(event string, data TemplateData, content chatContent) error {
+	content, err := d.chat(ChannelDiscord, event, data, content)
+	if err != nil {
+		return err
+	}
+	log.Println("[info] Sending to Discord")
+	_, err = postJSON(d.Transport, d.WebhookURL, map[string]interface{}{
+		"embeds": []discordEmbed{discordRender(content)},
+	})
+	return err
+}
+
+// discordRender renders the content as an embed, colored by the rating
+func discordRender(content chatContent) discordEmbed {
+	embed := discordEmbed{
+		Title:     content.Title,
+		URL:       content.URL,
+		Color:     discordColorInfo,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Fields: []discordField{
+			{Name: "App", Value: escapeMarkdown(content.AppName), Inline: true},
+			{Name: "Store", Value: escapeMarkdown(content.Store), Inline: true},
+		},
+	}
+	switch {
+	case content.IsError || (content.Rating > 0 && content.Rating <= 2):
+		embed.Color = discordColorBad
+	case content.Rating == 3:
+		embed.Color = discordColorOkay
+	case content.Rating >= 4:
+		embed.Color = discordColorGood
+	}
+
+	if content.Text != "" {
+		embed.Description = truncate(content.Text, discordTextLimit)
+		return embed
+	}
+
+	lines := []string{}
+	if content.Stars != "" {
+		lines = append(lines, content.Stars+"  **"+escapeMarkdown(content.Heading)+"**", "*"+escapeMarkdown(content.Byline)+"*")
+	}
+	if content.Body != "" {
+		if content.IsError {
+			lines = append(lines, "```"+strings.ReplaceAll(content.Body, "```", "'''")+"```")
+		} else {
+			lines = append(lines, "", escapeMarkdown(content.Body))
+		}
+	}
+	embed.Description = truncate(strings.Join(lines, "\n"), discordTextLimit)
+	for _, section := range content.Sections {
+		embed.Fields = append(embed.Fields, discordField{Name: section.Name, Value: truncate(strings.Join(section.Lines, "\n"), discordFieldLimit), Inline: true})
+	}
+	return embed
+}
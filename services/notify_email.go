@@ -0,0 +1,355 @@
+package services
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+)
+
+// ChannelEmail sends the notifications by email, when the recipients are set
+const ChannelEmail = "email"
+
+// TLS of the SMTP server, see @EmailNotifier
+const (
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSImplicit = "tls"
+	SMTPTLSNone     = "none"
+)
+
+func init() {
+	RegisterChannel(ChannelEmail, func(settings app.NotifyEntry) (Notifier, bool, error) {
+		if len(settings.EmailTo) == 0 {
+			return nil, false, nil
+		}
+		config := app.NewConfig().AppConfig
+		e := NewEmailNotifier(config.SMTPHost, config.SMTPPort, config.SMTPFrom, settings.EmailTo)
+		e.Username = config.SMTPUsername
+		e.Password = config.SMTPPassword
+		if config.SMTPTLS != "" {
+			e.TLS = config.SMTPTLS
+		}
+		e.Digest = settings.EmailDigest
+		if err := e.validate(); err != nil {
+			return nil, false, err
+		}
+		return e, true, nil
+	})
+}
+
+// EmailNotifier sends the notifications by email over SMTP
+// as multipart messages with the html, as sent to MS Teams, and its plain text
+// With Digest the new reviews of a run are sent in one email at the end of the run
+type EmailNotifier struct {
+	Host string
+	// Port default is 587 for starttls, 465 for tls and 25 for none
+	Port     string
+	Username string
+	Password string
+	// From default is the Username
+	From string
+	To   []string
+	// TLS is starttls, tls for implicit TLS, or none for a local server
+	TLS string
+	// TLSConfig is optional, eg. for the CA of a self signed server
+	TLSConfig *tls.Config
+	Digest    bool
+
+	mu sync.Mutex
+	// runURL is the reviews url of the current run, for the links to the reviews
+	runURL string
+	// digest are the new reviews of the current run, sent at its end
+	digest []ReviewModel
+
+	templated
+}
+
+// NewEmailNotifier creates a new EmailNotifier with STARTTLS
+func NewEmailNotifier(host, port, from string, to []string) *EmailNotifier {
+	return &EmailNotifier{
+		Host: host,
+		Port: port,
+		From: from,
+		To:   to,
+		TLS:  SMTPTLSStartTLS,
+	}
+}
+
+// validate checks that the emails can be sent
+func (e *EmailNotifier) validate() error {
+	if e.Host == "" {
+		return fmt.Errorf("[error] email recipients are set without the SMTP host")
+	}
+	if e.from() == "" {
+		return fmt.Errorf("[error] email recipients are set without the sender, set SMTP_FROM")
+	}
+	switch e.TLS {
+	case SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+	default:
+		return fmt.Errorf("[error] unknown SMTP TLS %s, use starttls, tls or none", e.TLS)
+	}
+	return nil
+}
+
+// Channel see @Notifier
+func (e *EmailNotifier) Channel() string {
+	return ChannelEmail
+}
+
+// BeginRun starts a new digest, see @RunNotifier
+func (e *EmailNotifier) BeginRun(run NotifyRun) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.runURL = run.URL
+	e.digest = nil
+}
+
+// EndRun sends the digest of the run, when there are new reviews, see @RunNotifier
+func (e *EmailNotifier) EndRun() error {
+	e.mu.Lock()
+	reviews := e.digest
+	runURL := e.runURL
+	e.digest = nil
+	e.mu.Unlock()
+	if len(reviews) == 0 {
+		return nil
+	}
+
+	bodies := []string{}
+	for _, review := range reviews {
+		message, err := e.message(ChannelEmail, TemplateNewReview, newReviewData(review, runURL))
+		if err != nil {
+			return err
+		}
+		bodies = append(bodies, message.HTML)
+	}
+	title := fmt.Sprintf("You have %d new reviews!", len(reviews))
+	if len(reviews) == 1 {
+		title = "You have a new review!"
+	}
+	return e.send(notifyMessage{
+		Title:    title,
+		Subtitle: "Store (" + reviews[0].Store + ")",
+		Subject:  "App (" + reviews[0].AppName + ")",
+		HTML:     strings.Join(bodies, "<hr>"),
+	})
+}
+
+// Buffered returns true for the new reviews with Digest, as they are sent at the end of the run, see @BufferedNotifier
+func (e *EmailNotifier) Buffered(notification string) bool {
+	return e.Digest && notification == NotificationNewReview
+}
+
+// NotifyNewReview see @Notifier
+// With Digest the review is sent at the end of the run, see @EmailNotifier.EndRun
+func (e *EmailNotifier) NotifyNewReview(review ReviewModel) error {
+	if e.Digest {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.digest = append(e.digest, review)
+		return nil
+	}
+	return e.render(TemplateNewReview, newReviewData(review, e.currentRunURL()))
+}
+
+// NotifyUpdatedReview see @Notifier
+func (e *EmailNotifier) NotifyUpdatedReview(edit ReviewEdit) error {
+	return e.render(TemplateUpdatedReview, updatedReviewData(edit, e.currentRunURL()))
+}
+
+// NotifyReviewCount see @Notifier
+func (e *EmailNotifier) NotifyReviewCount(current, last ReviewCountsModel) error {
+	return e.render(TemplateRating, ratingData(current, last))
+}
+
+// NotifyError see @Notifier
+func (e *EmailNotifier) NotifyError(appName, store string, err error) error {
+	return e.render(TemplateError, errorData(appName, store, err))
+}
+
+// NotifyDigest sends the digest as an html email, see @DigestNotifier
+func (e *EmailNotifier) NotifyDigest(digest Digest) error {
+	return e.render(TemplateDigest, digestData(digest))
+}
+
+// render sends the message of the event, see @Templates.Render
+func (e *EmailNotifier) render(event string, data TemplateData) error {
+	message, err := e.message(ChannelEmail, event, data)
+	if err != nil {
+		return err
+	}
+	return e.send(message)
+}
+
+func (e *EmailNotifier) currentRunURL() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.runURL
+}
+
+// send sends the message to all the recipients
+func (e *EmailNotifier) send(message notifyMessage) error {
+	b, err := e.build(message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	log.Println("[info] Sending email to", strings.Join(e.To, ", "))
+	client, err := e.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if e.TLS == SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("[error] SMTP server %s doesn't support STARTTLS", e.Host)
+		}
+		if err := client.StartTLS(e.tlsConfig()); err != nil {
+			return err
+		}
+	}
+	if e.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.Username, e.Password, e.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(e.from()); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// dial connects to the SMTP server, over TLS for implicit TLS
+func (e *EmailNotifier) dial() (*smtp.Client, error) {
+	port := e.Port
+	if port == "" {
+		switch e.TLS {
+		case SMTPTLSImplicit:
+			port = "465"
+		case SMTPTLSNone:
+			port = "25"
+		default:
+			port = "587"
+		}
+	}
+	addr := net.JoinHostPort(e.Host, port)
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if e.TLS == SMTPTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, e.tlsConfig())
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(time.Minute)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	client, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func (e *EmailNotifier) tlsConfig() *tls.Config {
+	config := &tls.Config{}
+	if e.TLSConfig != nil {
+		config = e.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = e.Host
+	}
+	return config
+}
+
+func (e *EmailNotifier) from() string {
+	if e.From != "" {
+		return e.From
+	}
+	return e.Username
+}
+
+// build returns the email of the message, with the html and its plain text as alternatives
+func (e *EmailNotifier) build(message notifyMessage, now time.Time) ([]byte, error) {
+	body := "<h1>" + message.Title + "</h1>" + "<p>" + message.Subject + " " + message.Subtitle + "</p>" + message.HTML
+	text, err := md.NewConverter("", true, nil).ConvertString(body)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := &bytes.Buffer{}
+	mw := multipart.NewWriter(parts)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{contentType: "text/plain; charset=utf-8", content: text},
+		{contentType: "text/html; charset=utf-8", content: "<html><body>" + body + "</body></html>"},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(w)
+		if _, err := qw.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	b := &bytes.Buffer{}
+	headers := [][2]string{
+		{"From", e.from()},
+		{"To", strings.Join(e.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", message.Title+" "+message.Subject+" "+message.Subtitle)},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", `multipart/alternative; boundary="` + mw.Boundary() + `"`},
+	}
+	for _, header := range headers {
+		b.WriteString(header[0] + ": " + header[1] + "\r\n")
+	}
+	b.WriteString("\r\n")
+	b.Write(parts.Bytes())
+	return b.Bytes(), nil
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"github.com/stretchr/testify/assert"
+)
+
+// sinkMail is an email received by the smtpSink
+type sinkMail struct {
+	auth string
+	from string
+	to   []string
+	data []byte
+}
+
+// smtpSink is a local SMTP server that keeps the emails instead of sending them
+// It offers STARTTLS with the tlsConfig, and serves implicit TLS when implicit is set
+type smtpSink struct {
+	addr      string
+	tlsConfig *tls.Config
+	implicit  bool
+
+	mu    sync.Mutex
+	mails []sinkMail
+}
+
+func newSMTPSink(t *testing.T, tlsConfig *tls.Config, implicit bool) *smtpSink {
+	var ln net.Listener
+	var err error
+	if implicit {
+		ln, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	assert.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+	sink := &smtpSink{addr: ln.Addr().String(), tlsConfig: tlsConfig, implicit: implicit}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go sink.serve(conn)
+		}
+	}()
+	return sink
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	secure := s.implicit
+	mail := sinkMail{}
+	_ = tp.PrintfLine("220 sink ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO":
+			_ = tp.PrintfLine("250-sink")
+			if s.tlsConfig != nil && !secure {
+				_ = tp.PrintfLine("250-STARTTLS")
+			}
+			_ = tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			_ = tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			secure = true
+		case "AUTH":
+			parts := strings.Fields(line)
+			b, _ := base64.StdEncoding.DecodeString(parts[len(parts)-1])
+			mail.auth = string(b)
+			_ = tp.PrintfLine("235 ok")
+		case "MAIL":
+			mail.from = strings.Trim(strings.SplitN(line, ":", 2)[1], "<>")
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			mail.to = append(mail.to, strings.Trim(strings.SplitN(line, ":", 2)[1], "<>"))
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			mail.data = data
+			s.mu.Lock()
+			s.mails = append(s.mails, mail)
+			s.mu.Unlock()
+			mail = sinkMail{auth: mail.auth}
+			_ = tp.PrintfLine("250 queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (s *smtpSink) received() []sinkMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sinkMail{}, s.mails...)
+}
+
+// notifier returns an EmailNotifier of the sink
+func (s *smtpSink) notifier(t *testing.T) *EmailNotifier {
+	host, port, err := net.SplitHostPort(s.addr)
+	assert.Nil(t, err)
+	return NewEmailNotifier(host, port, "reviews@example.com", []string{"a@example.com", "b@example.com"})
+}
+
+// selfSignedTLS returns the server and the client configs of a self signed cert of 127.0.0.1
+func selfSignedTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sink"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		&tls.Config{RootCAs: pool}
+}
+
+// parseEmail returns the decoded subject, and the plain text and the html parts of the email
+func parseEmail(t *testing.T, data []byte) (string, string, string) {
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	assert.Nil(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.Nil(t, err)
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.Nil(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	bodies := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		b, err := io.ReadAll(bufio.NewReader(part))
+		assert.Nil(t, err)
+		bodies[contentType] = string(b)
+	}
+	return subject, bodies["text/plain"], bodies["text/html"]
+}
+
+func TestEmailNotifier(t *testing.T) {
+	sink := newSMTPSink(t, nil, false)
+	e := sink.notifier(t)
+	e.TLS = SMTPTLSNone
+	assert.Nil(t, e.validate())
+
+	now := time.Now()
+	review := ReviewModel{AppName: "candy-crush", Store: StoreIOS, Username: "sugar", Title: "Love <b>it</b>", Body: "So sweet", Rating: 4, RatedAt: &now}
+	assert.Nil(t, e.NotifyNewReview(review))
+
+	mails := sink.received()
+	assert.Equal(t, 1, len(mails))
+	assert.Equal(t, "reviews@example.com", mails[0].from)
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, mails[0].to)
+	subject, text, html := parseEmail(t, mails[0].data)
+	assert.Equal(t, "You have a new review! App (candy-crush) Store (ios)", subject)
+	assert.Contains(t, html, "<h2>Love &lt;b&gt;it&lt;/b&gt;</h2>")
+	assert.Contains(t, html, "Rating ★★★★☆")
+	assert.Contains(t, text, "Love <b>it</b>")
+	assert.Contains(t, text, "So sweet")
+	assert.NotContains(t, text, "<h2>")
+
+	// STARTTLS is required
+	e.TLS = SMTPTLSStartTLS
+	err := e.NotifyError("candy-crush", StoreIOS, errors.New("failed"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "STARTTLS")
+}
+
+func TestEmailNotifierStartTLSDigest(t *testing.T) {
+	serverTLS, clientTLS := selfSignedTLS(t)
+	sink := newSMTPSink(t, serverTLS, false)
+	e := sink.notifier(t)
+	e.TLSConfig = clientTLS
+	e.Username = "user"
+	e.Password = "pass"
+	e.Digest = true
+
+	now := time.Now()
+	e.BeginRun(NotifyRun{AppName: "candy-crush", Store: StoreAndroid})
+	for _, title := range []string{"First", "Second"} {
+		assert.Nil(t, e.NotifyNewReview(ReviewModel{AppName: "candy-crush", Store: StoreAndroid, Title: title, Rating: 1, RatedAt: &now}))
+	}
+	assert.Equal(t, 0, len(sink.received()))
+
+	// rating summary isn't in the digest
+	assert.Nil(t, e.NotifyReviewCount(ReviewCountsModel{AppName: "candy-crush", Store: StoreAndroid, Total: 10, CreatedAt: &now}, ReviewCountsModel{}))
+	assert.Nil(t, e.EndRun())
+	mails := sink.received()
+	assert.Equal(t, 2, len(mails))
+	assert.Equal(t, "\x00user\x00pass", mails[0].auth)
+	subject, _, _ := parseEmail(t, mails[0].data)
+	assert.Equal(t, "You have a new rating! App (candy-crush) Store (android)", subject)
+	subject, text, _ := parseEmail(t, mails[1].data)
+	assert.Equal(t, "You have 2 new reviews! App (candy-crush) Store (android)", subject)
+	assert.Contains(t, text, "First")
+	assert.Contains(t, text, "Second")
+
+	// digest is sent once
+	assert.Nil(t, e.EndRun())
+	assert.Equal(t, 2, len(sink.received()))
+
+	// not trusted
+	e.TLSConfig = nil
+	assert.NotNil(t, e.NotifyError("candy-crush", StoreAndroid, errors.New("failed")))
+}
+
+func TestEmailNotifierImplicitTLS(t *testing.T) {
+	serverTLS, clientTLS := selfSignedTLS(t)
+	sink := newSMTPSink(t, serverTLS, true)
+	e := sink.notifier(t)
+	e.TLS = SMTPTLSImplicit
+	e.TLSConfig = clientTLS
+
+	assert.Nil(t, e.NotifyError("candy-crush", StoreIOS, errors.New("[error] No reviews found")))
+	mails := sink.received()
+	assert.Equal(t, 1, len(mails))
+	subject, text, _ := parseEmail(t, mails[0].data)
+	assert.Equal(t, "Scraping reviews failed! App (candy-crush) Store (ios)", subject)
+	assert.Contains(t, text, "No reviews found")
+}
+
+func TestEmailChannel(t *testing.T) {
+	// no SMTP host in the env
+	_, err := NewNotifiers(app.NotifyEntry{EmailTo: []string{"a@example.com"}})
+	assert.NotNil(t, err)
+
+	e := NewEmailNotifier("smtp.example.com", "", "", []string{"a@example.com"})
+	assert.NotNil(t, e.validate())
+	e.Username = "reviews@example.com"
+	assert.Nil(t, e.validate())
+	e.TLS = "ssl"
+	assert.NotNil(t, e.validate())
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"html"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+)
+
+// ChannelGoogleChat sends the notifications to a Google Chat webhook, when its URL is set
+const ChannelGoogleChat = "googlechat"
+
+// googleChatTextLimit is the maximum length of the text of a card
+const googleChatTextLimit = 4000
+
+func init() {
+	RegisterChannel(ChannelGoogleChat, func(settings app.NotifyEntry) (Notifier, bool, error) {
+		if settings.GoogleChatWebhookURL == "" {
+			return nil, false, nil
+		}
+		return NewGoogleChatNotifier(settings.GoogleChatWebhookURL), true, nil
+	})
+}
+
+// GoogleChatNotifier sends the notifications to a Google Chat space webhook as cards
+type GoogleChatNotifier struct {
+	WebhookURL string
+	// Transport is the http transport the messages are sent with
+	// When nil, http.DefaultTransport is used
+	Transport http.RoundTripper
+
+	chatRun
+	templated
+}
+
+// NewGoogleChatNotifier creates a new GoogleChatNotifier
+func NewGoogleChatNotifier(webhookURL string) *GoogleChatNotifier {
+	return &GoogleChatNotifier{
+		WebhookURL: webhookURL,
+	}
+}
+
+// Channel see @Notifier
+func (g *GoogleChatNotifier) Channel() string {
+	return ChannelGoogleChat
+}
+
+// NotifyNewReview see @Notifier
+func (g *GoogleChatNotifier) NotifyNewReview(review ReviewModel) error {
+	return g.send(TemplateNewReview, newReviewData(review, g.runURL()), newReviewChat(review, g.runURL()))
+}
+
+// NotifyUpdatedReview see @Notifier
+func (g *GoogleChatNotifier) NotifyUpdatedReview(edit ReviewEdit) error {
+	return g.send(TemplateUpdatedReview, updatedReviewData(edit, g.runURL()), updatedReviewChat(edit, g.runURL()))
+}
+
+// NotifyReviewCount see @Notifier
+func (g *GoogleChatNotifier) NotifyReviewCount(current, last ReviewCountsModel) error {
+	return g.send(TemplateRating, ratingData(current, last), reviewCountChat(current, last))
+}
+
+// NotifyError see @Notifier
+func (g *GoogleChatNotifier) NotifyError(appName, store string, err error) error {
+	return g.send(TemplateError, errorData(appName, store, err), errorChat(appName, store, err))
+}
+
+// NotifyDigest see @DigestNotifier
+func (g *GoogleChatNotifier) NotifyDigest(digest Digest) error {
+	return g.send(TemplateDigest, digestData(digest), digestChat(digest))
+}
+
+// send sends the content of the event, or its template when the channel has one, see @Templates.Render
+func (g *GoogleChatNotifier) send(event string, data TemplateData, content chatContent) error {
+	content, err := g.chat(ChannelGoogleChat, event, data, content)
+	if err != nil {
+		return err
+	}
+	log.Println("[info] Sending to Google Chat")
+	_, err = postJSON(g.Transport, g.WebhookURL, googleChatRender(content))
+	return err
+}
+
+// googleChatRender renders the content as a card of Google Chat
+func googleChatRender(content chatContent) map[string]interface{} {
+	widgets := []map[string]interface{}{}
+	if content.Text != "" {
+		widgets = append(widgets, map[string]interface{}{
+			"textParagraph": map[string]interface{}{"text": truncate(content.Text, googleChatTextLimit)},
+		})
+	}
+	if content.Stars != "" {
+		widgets = append(widgets, map[string]interface{}{
+			"decoratedText": map[string]interface{}{
+				"topLabel":    content.Stars,
+				"text":        "<b>" + html.EscapeString(content.Heading) + "</b>",
+				"bottomLabel": content.Byline,
+				"wrapText":    true,
+			},
+		})
+	}
+	if content.Body != "" {
+		text := strings.ReplaceAll(html.EscapeString(truncate(content.Body, googleChatTextLimit)), "\n", "<br>")
+		if content.IsError {
+			text = `<font color="#d93025">` + text + "</font>"
+		}
+		widgets = append(widgets, map[string]interface{}{
+			"textParagraph": map[string]interface{}{"text": text},
+		})
+	}
+	if content.URL != "" {
+		widgets = append(widgets, map[string]interface{}{
+			"buttonList": map[string]interface{}{
+				"buttons": []map[string]interface{}{{
+					"text":    "View in store",
+					"onClick": map[string]interface{}{"openLink": map[string]interface{}{"url": content.URL}},
+				}},
+			},
+		})
+	}
+
+	sections := []map[string]interface{}{}
+	if len(widgets) > 0 {
+		sections = append(sections, map[string]interface{}{"widgets": widgets})
+	}
+	for _, section := range content.Sections {
+		sections = append(sections, map[string]interface{}{
+			"header": html.EscapeString(section.Name),
+			"widgets": []map[string]interface{}{{
+				"textParagraph": map[string]interface{}{"text": strings.ReplaceAll(html.EscapeString(strings.Join(section.Lines, "\n")), "\n", "<br>")},
+			}},
+		})
+	}
+	return map[string]interface{}{
+		"text": content.Title + " App (" + content.AppName + ") Store (" + content.Store + ")",
+		"cardsV2": []map[string]interface{}{{
+			"cardId": "review",
+			"card": map[string]interface{}{
+				"header": map[string]interface{}{
+					"title":    content.Title,
+					"subtitle": "App (" + content.AppName + ") · Store (" + content.Store + ")",
+				},
+				"sections": sections,
+			},
+		}},
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+)
+
+// ChannelMattermost sends the notifications to a Mattermost webhook, when its URL is set
+const ChannelMattermost = "mattermost"
+
+// mattermostTextLimit is the maximum length of a post
+const mattermostTextLimit = 16383
+
+func init() {
+	RegisterChannel(ChannelMattermost, func(settings app.NotifyEntry) (Notifier, bool, error) {
+		if settings.MattermostWebhookURL == "" {
+			return nil, false, nil
+		}
+		return NewMattermostNotifier(settings.MattermostWebhookURL), true, nil
+	})
+}
+
+// MattermostNotifier sends the notifications to a Mattermost incoming webhook in markdown
+type MattermostNotifier struct {
+	WebhookURL string
+	// Transport is the http transport the messages are sent with
+	// When nil, http.DefaultTransport is used
+	Transport http.RoundTripper
+
+	chatRun
+	templated
+}
+
+// NewMattermostNotifier creates a new MattermostNotifier
+func NewMattermostNotifier(webhookURL string) *MattermostNotifier {
+	return &MattermostNotifier{
+		WebhookURL: webhookURL,
+	}
+}
+
+// Channel see @Notifier
+func (m *MattermostNotifier) Channel() string {
+	return ChannelMattermost
+}
+
+// NotifyNewReview see @Notifier
+func (m *MattermostNotifier) NotifyNewReview(review ReviewModel) error {
+	return m.send(TemplateNewReview, newReviewData(review, m.runURL()), newReviewChat(review, m.runURL()))
+}
+
+// NotifyUpdatedReview see @Notifier
+func (m *MattermostNotifier) NotifyUpdatedReview(edit ReviewEdit) error {
+	return m.send(TemplateUpdatedReview, updatedReviewData(edit, m.runURL()), updatedReviewChat(edit, m.runURL()))
+}
+
+// NotifyReviewCount see @Notifier
+func (m *MattermostNotifier) NotifyReviewCount(current, last ReviewCountsModel) error {
+	return m.send(TemplateRating, ratingData(current, last), reviewCountChat(current, last))
+}
+
+// NotifyError see @Notifier
+func (m *MattermostNotifier) NotifyError(appName, store string, err error) error {
+	return m.send(TemplateError, errorData(appName, store, err), errorChat(appName, store, err))
+}
+
+// NotifyDigest see @DigestNotifier
+func (m *MattermostNotifier) NotifyDigest(digest Digest) error {
+	return m.send(TemplateDigest, digestData(digest), digestChat(digest))
+}
+
+// send sends the content of the event, or its template when the channel has one, see @Templates.Render
+func (m *MattermostNotifier) send(event string, data TemplateData, content chatContent) error {
+	content, err := m.chat(ChannelMattermost, event, data, content)
+	if err != nil {
+		return err
+	}
+	log.Println("[info] Sending to Mattermost")
+	_, err = postJSON(m.Transport, m.WebhookURL, map[string]interface{}{
+		"text": mattermostRender(content),
+	})
+	return err
+}
+
+// mattermostRender renders the content in the markdown of Mattermost
+func mattermostRender(content chatContent) string {
+	lines := []string{
+		"#### " + escapeMarkdown(content.Title),
+		"**App** " + escapeMarkdown(content.AppName) + " · **Store** " + escapeMarkdown(content.Store),
+	}
+	if content.Text != "" {
+		return truncate(strings.Join(append(lines, "", content.Text), "\n"), mattermostTextLimit)
+	}
+	if content.Stars != "" {
+		lines = append(lines, "", content.Stars+"  **"+escapeMarkdown(content.Heading)+"**", "_"+escapeMarkdown(content.Byline)+"_")
+	}
+	if content.Body != "" {
+		if content.IsError {
+			lines = append(lines, "", "```", strings.ReplaceAll(content.Body, "```", "'''"), "```")
+		} else {
+			for _, line := range strings.Split(truncate(content.Body, mattermostTextLimit/2), "\n") {
+				lines = append(lines, "> "+escapeMarkdown(line))
+			}
+		}
+	}
+	for _, section := range content.Sections {
+		lines = append(lines, "", "**"+escapeMarkdown(section.Name)+"**")
+		lines = append(lines, section.Lines...)
+	}
+	if content.URL != "" {
+		lines = append(lines, "", "[View in store]("+content.URL+")")
+	}
+	return truncate(strings.Join(lines, "\n"), mattermostTextLimit)
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"log"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	gmt "github.com/kevincobain2000/go-msteams/src"
+)
+
+// ChannelMSTeams sends the notifications to MS Teams, when the hook URL is set
+const ChannelMSTeams = "msteams"
+
+func init() {
+	RegisterChannel(ChannelMSTeams, func(settings app.NotifyEntry) (Notifier, bool, error) {
+		if settings.MSTeamsHookURL == "" {
+			return nil, false, nil
+		}
+		return NewMSTeamsNotifier(settings.MSTeamsHookURL), true, nil
+	})
+}
+
+// MSTeamsNotifier sends the notifications to an MS Teams incoming webhook
+type MSTeamsNotifier struct {
+	HookURL string
+	// Proxy is optional, the proxy the notifications are sent through
+	Proxy string
+
+	templated
+}
+
+// NewMSTeamsNotifier creates a new MSTeamsNotifier
+func NewMSTeamsNotifier(hookURL string) *MSTeamsNotifier {
+	return &MSTeamsNotifier{
+		HookURL: hookURL,
+	}
+}
+
+// Channel see @Notifier
+func (m *MSTeamsNotifier) Channel() string {
+	return ChannelMSTeams
+}
+
+// NotifyNewReview see @Notifier
+func (m *MSTeamsNotifier) NotifyNewReview(review ReviewModel) error {
+	return m.send(TemplateNewReview, newReviewData(review, ""))
+}
+
+// NotifyUpdatedReview see @Notifier
+func (m *MSTeamsNotifier) NotifyUpdatedReview(edit ReviewEdit) error {
+	return m.send(TemplateUpdatedReview, updatedReviewData(edit, ""))
+}
+
+// NotifyReviewCount see @Notifier
+func (m *MSTeamsNotifier) NotifyReviewCount(current, last ReviewCountsModel) error {
+	return m.send(TemplateRating, ratingData(current, last))
+}
+
+// NotifyError see @Notifier
+func (m *MSTeamsNotifier) NotifyError(appName, store string, err error) error {
+	return m.send(TemplateError, errorData(appName, store, err))
+}
+
+// NotifyDigest see @DigestNotifier
+func (m *MSTeamsNotifier) NotifyDigest(digest Digest) error {
+	return m.send(TemplateDigest, digestData(digest))
+}
+
+func (m *MSTeamsNotifier) send(event string, data TemplateData) error {
+	message, err := m.message(ChannelMSTeams, event, data)
+	if err != nil {
+		return err
+	}
+	log.Println("[info] Sending to MS Teams")
+	color := ""
+	return gmt.Send(message.Title, message.Subtitle, message.Subject, color, message.HTML, m.HookURL, m.Proxy)
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+)
+
+// ChannelSlack sends the notifications to Slack, when the webhook URL or the bot token is set
+const ChannelSlack = "slack"
+
+// SlackBaseURL is the Slack Web API, used with the bot token
+const SlackBaseURL = "https://slack.com/api"
+
+// slackTextLimit is the maximum length of the text of a section block
+const slackTextLimit = 3000
+
+func init() {
+	RegisterChannel(ChannelSlack, func(settings app.NotifyEntry) (Notifier, bool, error) {
+		if settings.SlackBotToken != "" {
+			if settings.SlackChannel == "" {
+				return nil, false, fmt.Errorf("[error] Slack bot token is set without the channel")
+			}
+			return NewSlackBotNotifier(settings.SlackBotToken, settings.SlackChannel), true, nil
+		}
+		if settings.SlackWebhookURL != "" {
+			return NewSlackWebhookNotifier(settings.SlackWebhookURL), true, nil
+		}
+		return nil, false, nil
+	})
+}
+
+// SlackNotifier sends the notifications to Slack as Block Kit messages
+// with the incoming webhook, or with the bot token by chat.postMessage
+// With the bot token the new reviews of a run are posted as replies to the rating summary of the run
+// The webhook can't thread, as Slack doesn't return the posted message
+type SlackNotifier struct {
+	WebhookURL string
+	BotToken   string
+	// ChannelID is the channel the bot posts to, its ID or name, eg. #reviews
+	ChannelID string
+	// BaseURL is the Slack Web API, default is SlackBaseURL
+	BaseURL string
+	// Transport is the http transport the messages are sent with
+	// When nil, http.DefaultTransport is used
+	Transport http.RoundTripper
+
+	mu sync.Mutex
+	// run is the current run, see @SlackNotifier.BeginRun
+	run NotifyRun
+	// threadTS is the rating summary of the current run, that the new reviews are replied to
+	threadTS string
+
+	templated
+}
+
+// NewSlackWebhookNotifier creates a new SlackNotifier that posts to the incoming webhook
+func NewSlackWebhookNotifier(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{
+		WebhookURL: webhookURL,
+	}
+}
+
+// NewSlackBotNotifier creates a new SlackNotifier that posts to the channel with the bot token
+func NewSlackBotNotifier(botToken, channelID string) *SlackNotifier {
+	return &SlackNotifier{
+		BotToken:  botToken,
+		ChannelID: channelID,
+		BaseURL:   SlackBaseURL,
+	}
+}
+
+// slackMessage is the payload of the webhook and of chat.postMessage
+// Text is the fallback of the blocks, shown in the notifications
+type slackMessage struct {
+	Channel  string                   `json:"channel,omitempty"`
+	Text     string                   `json:"text"`
+	Blocks   []map[string]interface{} `json:"blocks"`
+	ThreadTS string                   `json:"thread_ts,omitempty"`
+}
+
+// slackResponse is the response of chat.postMessage
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	TS    string `json:"ts"`
+}
+
+// Channel see @Notifier
+func (s *SlackNotifier) Channel() string {
+	return ChannelSlack
+}
+
+// BeginRun starts a new thread for the run, see @RunNotifier
+func (s *SlackNotifier) BeginRun(run NotifyRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.run = run
+	s.threadTS = ""
+}
+
+// EndRun see @RunNotifier
+func (s *SlackNotifier) EndRun() error {
+	return nil
+}
+
+// NotifyNewReview see @Notifier
+// it is a reply to the rating summary of the run, when there is one
+func (s *SlackNotifier) NotifyNewReview(review ReviewModel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok, err := s.postTemplate(TemplateNewReview, newReviewData(review, s.run.URL), s.threadTS); ok || err != nil {
+		return err
+	}
+	blocks := []map[string]interface{}{
+		slackHeader("You have a new review!"),
+		slackFields("*App*\n"+slackEscape(review.AppName), "*Store*\n"+slackEscape(review.Store)),
+		slackSection(stars(review.Rating) + "  *" + slackEscape(review.Title) + "*\n@" + slackEscape(review.Username) + " · " + formatDate(review.RatedAt)),
+	}
+	if review.Body != "" {
+		blocks = append(blocks, slackSection(slackEscape(review.Body)))
+	}
+	blocks = append(blocks, s.storeButton(review)...)
+	text := fmt.Sprintf("New %s review of %s (%s): %s", stars(review.Rating), review.AppName, review.Store, review.Title)
+	_, err := s.post(slackMessage{Text: text, Blocks: blocks, ThreadTS: s.threadTS})
+	return err
+}
+
+// NotifyUpdatedReview see @Notifier
+func (s *SlackNotifier) NotifyUpdatedReview(edit ReviewEdit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok, err := s.postTemplate(TemplateUpdatedReview, updatedReviewData(edit, s.run.URL), ""); ok || err != nil {
+		return err
+	}
+	uu := NewUtils()
+	review := edit.Review
+	revision := edit.Revision
+	blocks := []map[string]interface{}{
+		slackHeader("A review was updated!"),
+		slackFields("*App*\n"+slackEscape(review.AppName), "*Store*\n"+slackEscape(review.Store)),
+		slackSection(stars(revision.Rating) + " → " + stars(review.Rating) + "  *" + slackEscape(review.Title) + "*\n@" +
+			slackEscape(review.Username) + " · " + formatDate(revision.RatedAt) + " → " + formatDate(review.RatedAt)),
+	}
+	if revision.Title != review.Title {
+		blocks = append(blocks, slackSection("Title: "+slackEscape(uu.DiffWords(revision.Title, review.Title))))
+	}
+	blocks = append(blocks, slackSection(slackEscape(uu.DiffWords(revision.Body, review.Body))))
+	blocks = append(blocks, s.storeButton(review)...)
+	text := fmt.Sprintf("Updated review of %s (%s): %s", review.AppName, review.Store, review.Title)
+	_, err := s.post(slackMessage{Text: text, Blocks: blocks})
+	return err
+}
+
+// NotifyReviewCount see @Notifier
+// the new reviews of the run are replied to it
+func (s *SlackNotifier) NotifyReviewCount(current, last ReviewCountsModel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ts, ok, err := s.postTemplate(TemplateRating, ratingData(current, last), ""); ok || err != nil {
+		s.threadTS = ts
+		return err
+	}
+	fields := []string{"*Now* " + formatDate(current.CreatedAt) + "\n" + strings.Join(ratingLines(current), "\n")}
+	if last.Total > 0 {
+		fields = append(fields, "*Before* "+formatDate(last.CreatedAt)+"\n"+strings.Join(ratingLines(last), "\n"))
+	}
+	blocks := []map[string]interface{}{
+		slackHeader("You have a new rating!"),
+		slackFields("*App*\n"+slackEscape(current.AppName), "*Store*\n"+slackEscape(current.Store)),
+		slackFields(fields...),
+	}
+	text := fmt.Sprintf("New rating of %s (%s): %.2f of %d reviews", current.AppName, current.Store, NewUtils().AverageRating(current), current.Total)
+	ts, err := s.post(slackMessage{Text: text, Blocks: blocks})
+	if err != nil {
+		return err
+	}
+	s.threadTS = ts
+	return nil
+}
+
+// NotifyError see @Notifier
+func (s *SlackNotifier) NotifyError(appName, store string, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok, templateErr := s.postTemplate(TemplateError, errorData(appName, store, err), ""); ok || templateErr != nil {
+		return templateErr
+	}
+	blocks := []map[string]interface{}{
+		slackHeader("Scraping reviews failed!"),
+		slackFields("*App*\n"+slackEscape(appName), "*Store*\n"+slackEscape(store)),
+		slackSection("```" + slackEscape(err.Error()) + "```"),
+	}
+	text := fmt.Sprintf("Scraping reviews of %s (%s) failed", appName, store)
+	_, postErr := s.post(slackMessage{Text: text, Blocks: blocks})
+	return postErr
+}
+
+// NotifyDigest see @DigestNotifier
+func (s *SlackNotifier) NotifyDigest(digest Digest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok, err := s.postTemplate(TemplateDigest, digestData(digest), ""); ok || err != nil {
+		return err
+	}
+	blocks := []map[string]interface{}{
+		slackHeader(digest.Title()),
+		slackFields("*App*\n"+slackEscape(digest.AppName), "*Store*\n"+slackEscape(digest.Store)),
+		slackSection(strings.Join(digest.SummaryLines(), "\n")),
+	}
+	if len(digest.TopWords) > 0 {
+		blocks = append(blocks, slackSection("*Top words*\n"+slackEscape(digest.WordsLine())))
+	}
+	for _, review := range digest.Worst {
+		blocks = append(blocks, slackSection(stars(review.Rating)+"  *"+slackEscape(review.Title)+"*\n_@"+slackEscape(review.Username)+" · "+formatDate(review.RatedAt)+"_\n"+slackEscape(review.Body)))
+	}
+	if len(digest.Edits) > 0 {
+		edits := []string{}
+		for _, edit := range digest.Edits {
+			edits = append(edits, slackEscape(EditLine(edit)))
+		}
+		blocks = append(blocks, slackSection("*Edited reviews*\n"+strings.Join(edits, "\n")))
+	}
+	// Slack allows 50 blocks
+	if len(blocks) > 50 {
+		blocks = blocks[:50]
+	}
+	text := fmt.Sprintf("%s of %s (%s): %d new reviews", digest.Title(), digest.AppName, digest.Store, digest.Total)
+	_, err := s.post(slackMessage{Text: text, Blocks: blocks})
+	return err
+}
+
+// postTemplate posts the template of the event as its text, when the channel has one, and returns its ts
+// ok is false when there is none, and the event is posted as its blocks, see @Templates.Render
+func (s *SlackNotifier) postTemplate(event string, data TemplateData, threadTS string) (string, bool, error) {
+	rendered, ok, err := s.templates.Render(ChannelSlack, event, data)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	blocks := []map[string]interface{}{
+		slackHeader(rendered.Title),
+		slackFields("*App*\n"+slackEscape(data.AppName), "*Store*\n"+slackEscape(data.Store)),
+		slackSection(rendered.Body),
+	}
+	text := rendered.Title + " " + rendered.Subject + " " + rendered.Subtitle
+	ts, err := s.post(slackMessage{Text: text, Blocks: blocks, ThreadTS: threadTS})
+	return ts, true, err
+}
+
+// storeButton returns the "View in store" button of the review, none when the url of the run isn't known
+func (s *SlackNotifier) storeButton(review ReviewModel) []map[string]interface{} {
+	link := reviewStoreURL(s.run.URL, review)
+	if link == "" {
+		return nil
+	}
+	return []map[string]interface{}{{
+		"type": "actions",
+		"elements": []map[string]interface{}{{
+			"type": "button",
+			"text": map[string]interface{}{"type": "plain_text", "text": "View in store"},
+			"url":  link,
+		}},
+	}}
+}
+
+// post sends the message and returns its ts, which is empty with the webhook
+func (s *SlackNotifier) post(message slackMessage) (string, error) {
+	endpoint := s.WebhookURL
+	if s.BotToken != "" {
+		baseURL := s.BaseURL
+		if baseURL == "" {
+			baseURL = SlackBaseURL
+		}
+		endpoint = strings.TrimRight(baseURL, "/") + "/chat.postMessage"
+		message.Channel = s.ChannelID
+	} else {
+		// webhook can't reply
+		message.ThreadTS = ""
+	}
+	b, err := json.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if s.BotToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.BotToken)
+	}
+
+	log.Println("[info] Sending to Slack")
+	client := &http.Client{Transport: s.Transport, Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("[error] Slack responded with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if s.BotToken == "" {
+		return "", nil
+	}
+	res := slackResponse{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", fmt.Errorf("[error] unable to parse Slack response: %w", err)
+	}
+	if !res.OK {
+		return "", fmt.Errorf("[error] Slack responded with %s", res.Error)
+	}
+	return res.TS, nil
+}
+
+func slackHeader(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "header",
+		"text": map[string]interface{}{"type": "plain_text", "text": text},
+	}
+}
+
+// slackSection is a block of mrkdwn text, cut to the limit of Slack
+func slackSection(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "section",
+		"text": map[string]interface{}{"type": "mrkdwn", "text": truncate(text, slackTextLimit)},
+	}
+}
+
+// slackFields is a block of mrkdwn texts shown side by side
+func slackFields(texts ...string) map[string]interface{} {
+	fields := []map[string]interface{}{}
+	for _, text := range texts {
+		fields = append(fields, map[string]interface{}{"type": "mrkdwn", "text": text})
+	}
+	return map[string]interface{}{
+		"type":   "section",
+		"fields": fields,
+	}
+}
+
+// slackEscape escapes the text from the users for mrkdwn
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"github.com/stretchr/testify/assert"
+)
+
+// slackServer is a stand-in for Slack, that records the posted messages
+func slackServer(t *testing.T, messages *[]slackMessage) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		message := slackMessage{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&message))
+		*messages = append(*messages, message)
+		switch r.URL.Path {
+		case "/hook":
+			_, _ = w.Write([]byte("ok"))
+		case "/api/chat.postMessage":
+			if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+				_, _ = w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+				return
+			}
+			if message.Channel != "#reviews" {
+				_, _ = w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`))
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"ok":true,"ts":"1700000000.%06d"}`, len(*messages))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("no_service"))
+		}
+	}))
+}
+
+// blocksText returns all the texts of the blocks, to assert on
+func blocksText(t *testing.T, message slackMessage) string {
+	b, err := json.Marshal(message.Blocks)
+	assert.Nil(t, err)
+	return string(b)
+}
+
+func TestSlackNotifierBot(t *testing.T) {
+	messages := []slackMessage{}
+	server := slackServer(t, &messages)
+	defer server.Close()
+
+	s := NewSlackBotNotifier("xoxb-test", "#reviews")
+	s.BaseURL = server.URL + "/api"
+	now := time.Now()
+	review := ReviewModel{
+		AppName:    "candy-crush",
+		Store:      StoreAndroid,
+		ExternalID: "gp:abc",
+		Username:   "sugar",
+		Title:      "Love <it>",
+		Body:       "So sweet & fun",
+		Rating:     4,
+		RatedAt:    &now,
+	}
+
+	// new reviews of the run are replied to its rating summary
+	s.BeginRun(NotifyRun{AppName: "candy-crush", Store: StoreAndroid, URL: "https://play.google.com/store/apps/details?id=com.king.candycrushsaga&hl=en"})
+	assert.Nil(t, s.NotifyReviewCount(ReviewCountsModel{AppName: "candy-crush", Store: StoreAndroid, Total: 10, Rating5Percentage: 100, CreatedAt: &now}, ReviewCountsModel{}))
+	assert.Nil(t, s.NotifyNewReview(review))
+	assert.Nil(t, s.NotifyNewReview(review))
+	assert.Equal(t, 3, len(messages))
+	assert.Equal(t, "#reviews", messages[0].Channel)
+	assert.Equal(t, "", messages[0].ThreadTS)
+	assert.Contains(t, blocksText(t, messages[0]), "Total reviews: 10")
+	assert.Equal(t, "1700000000.000001", messages[1].ThreadTS)
+	assert.Equal(t, "1700000000.000001", messages[2].ThreadTS)
+
+	text := blocksText(t, messages[1])
+	assert.Contains(t, text, "★★★★☆  *Love \\u0026lt;it\\u0026gt;*")
+	assert.Contains(t, text, "So sweet \\u0026amp; fun")
+	assert.Contains(t, text, "View in store")
+	assert.Contains(t, text, "reviewId=gp%3Aabc")
+	assert.Equal(t, "New ★★★★☆ review of candy-crush (android): Love <it>", messages[1].Text)
+
+	// next run isn't threaded without its rating summary
+	s.BeginRun(NotifyRun{AppName: "candy-crush", Store: StoreIOS})
+	review.Store = StoreIOS
+	assert.Nil(t, s.NotifyNewReview(review))
+	assert.Equal(t, "", messages[3].ThreadTS)
+	assert.NotContains(t, blocksText(t, messages[3]), "View in store")
+
+	revised := review
+	revised.Body = "So sweet"
+	revised.Rating = 5
+	assert.Nil(t, s.NotifyUpdatedReview(ReviewEdit{Review: revised, Revision: ReviewRevisionModel{Title: review.Title, Body: review.Body, Rating: 4, RatedAt: &now}}))
+	assert.Contains(t, blocksText(t, messages[4]), "★★★★☆ → ★★★★★")
+	assert.Contains(t, blocksText(t, messages[4]), "[-\\u0026amp; fun-]")
+
+	assert.Nil(t, s.NotifyError("candy-crush", StoreIOS, errors.New("[error] No reviews found")))
+	assert.Contains(t, blocksText(t, messages[5]), "```[error] No reviews found```")
+
+	// errors of Slack
+	s.ChannelID = "#none"
+	err := s.NotifyNewReview(review)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "channel_not_found")
+}
+
+func TestSlackNotifierWebhook(t *testing.T) {
+	messages := []slackMessage{}
+	server := slackServer(t, &messages)
+	defer server.Close()
+
+	s := NewSlackWebhookNotifier(server.URL + "/hook")
+	now := time.Now()
+	s.BeginRun(NotifyRun{AppName: "candy-crush", Store: StoreIOS, URL: "https://apps.apple.com/us/app/candy-crush-saga/id553834731?see-all=reviews"})
+	assert.Nil(t, s.NotifyReviewCount(ReviewCountsModel{AppName: "candy-crush", Store: StoreIOS, Total: 10}, ReviewCountsModel{Total: 9}))
+	assert.Nil(t, s.NotifyNewReview(ReviewModel{AppName: "candy-crush", Store: StoreIOS, Title: "Fun", Body: strings.Repeat("a", 4000), Rating: 9, RatedAt: &now}))
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, "", messages[0].Channel)
+	assert.Contains(t, blocksText(t, messages[0]), "*Before*")
+	// the webhook can't thread
+	assert.Equal(t, "", messages[1].ThreadTS)
+	assert.Contains(t, blocksText(t, messages[1]), "★★★★★  *Fun*")
+	assert.Contains(t, blocksText(t, messages[1]), strings.Repeat("a", slackTextLimit-1)+"…")
+	assert.Contains(t, blocksText(t, messages[1]), "https://apps.apple.com/us/app/candy-crush-saga/id553834731?see-all=reviews")
+
+	s.WebhookURL = server.URL + "/gone"
+	err := s.NotifyError("candy-crush", StoreIOS, errors.New("failed"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "404")
+}
+
+func TestSlackChannel(t *testing.T) {
+	notifiers, err := NewNotifiers(app.NotifyEntry{SlackWebhookURL: "https://hooks.slack.com/services/T/B/X"})
+	assert.Nil(t, err)
+	assert.Equal(t, ChannelSlack, notifiers[len(notifiers)-1].Channel())
+
+	notifiers, err = NewNotifiers(app.NotifyEntry{SlackWebhookURL: "https://hooks.slack.com/services/T/B/X", SlackBotToken: "xoxb-test", SlackChannel: "#reviews"})
+	assert.Nil(t, err)
+	assert.Equal(t, "xoxb-test", notifiers[len(notifiers)-1].(*SlackNotifier).BotToken)
+
+	_, err = NewNotifiers(app.NotifyEntry{SlackBotToken: "xoxb-test"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+)
+
+// ChannelTelegram sends the notifications with a Telegram bot, when its token and the chat are set
+const ChannelTelegram = "telegram"
+
+// TelegramBaseURL is the Telegram Bot API
+const TelegramBaseURL = "https://api.telegram.org"
+
+// telegramTextLimit is the maximum length of a message
+const telegramTextLimit = 4096
+
+func init() {
+	RegisterChannel(ChannelTelegram, func(settings app.NotifyEntry) (Notifier, bool, error) {
+		if settings.TelegramBotToken == "" {
+			return nil, false, nil
+		}
+		if settings.TelegramChatID == "" {
+			return nil, false, fmt.Errorf("[error] Telegram bot token is set without the chat id")
+		}
+		return NewTelegramNotifier(settings.TelegramBotToken, settings.TelegramChatID), true, nil
+	})
+}
+
+// TelegramNotifier sends the notifications to a chat with a Telegram bot, by sendMessage in HTML
+type TelegramNotifier struct {
+	BotToken string
+	// ChatID is the chat the bot sends to, its id or @channelusername
+	ChatID string
+	// BaseURL is the Telegram Bot API, default is TelegramBaseURL
+	BaseURL string
+	// Transport is the http transport the messages are sent with
+	// When nil, http.DefaultTransport is used
+	Transport http.RoundTripper
+
+	chatRun
+	templated
+}
+
+// NewTelegramNotifier creates a new TelegramNotifier
+func NewTelegramNotifier(botToken, chatID string) *TelegramNotifier {
+	return &TelegramNotifier{
+		BotToken: botToken,
+		ChatID:   chatID,
+		BaseURL:  TelegramBaseURL,
+	}
+}
+
+// Channel see @Notifier
+func (t *TelegramNotifier) Channel() string {
+	return ChannelTelegram
+}
+
+// NotifyNewReview see @Notifier
+func (t *TelegramNotifier) NotifyNewReview(review ReviewModel) error {
+	return t.send(TemplateNewReview, newReviewData(review, t.runURL()), newReviewChat(review, t.runURL()))
+}
+
+// NotifyUpdatedReview see @Notifier
+func (t *TelegramNotifier) NotifyUpdatedReview(edit ReviewEdit) error {
+	return t.send(TemplateUpdatedReview, updatedReviewData(edit, t.runURL()), updatedReviewChat(edit, t.runURL()))
+}
+
+// NotifyReviewCount see @Notifier
+func (t *TelegramNotifier) NotifyReviewCount(current, last ReviewCountsModel) error {
+	return t.send(TemplateRating, ratingData(current, last), reviewCountChat(current, last))
+}
+
+// NotifyError see @Notifier
+func (t *TelegramNotifier) NotifyError(appName, store string, err error) error {
+	return t.send(TemplateError, errorData(appName, store, err), errorChat(appName, store, err))
+}
+
+// NotifyDigest see @DigestNotifier
+func (t *TelegramNotifier) NotifyDigest(digest Digest) error {
+	return t.send(TemplateDigest, digestData(digest), digestChat(digest))
+}
+
+// send sends the content of the event, or its template when the channel has one, see @Templates.Render
+func (t *TelegramNotifier) send(event string, data TemplateData, content chatContent) error {
+	content, err := t.chat(ChannelTelegram, event, data, content)
+	if err != nil {
+		return err
+	}
+	baseURL := t.BaseURL
+	if baseURL == "" {
+		baseURL = TelegramBaseURL
+	}
+	log.Println("[info] Sending to Telegram")
+	body, err := postJSON(t.Transport, strings.TrimRight(baseURL, "/")+"/bot"+t.BotToken+"/sendMessage", map[string]interface{}{
+		"chat_id":                  t.ChatID,
+		"text":                     telegramRender(content),
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		// the token is in the url, which is in the error of the transport
+		return fmt.Errorf("%s", strings.ReplaceAll(err.Error(), t.BotToken, "***"))
+	}
+	res := struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return fmt.Errorf("[error] unable to parse Telegram response: %w", err)
+	}
+	if !res.OK {
+		return fmt.Errorf("[error] Telegram responded with %s", res.Description)
+	}
+	return nil
+}
+
+// telegramRender renders the content in the HTML of Telegram
+func telegramRender(content chatContent) string {
+	head := "<b>" + html.EscapeString(content.Title) + "</b>\n" +
+		"App (" + html.EscapeString(content.AppName) + ") · Store (" + html.EscapeString(content.Store) + ")"
+	if content.Text != "" {
+		return truncate(head+"\n\n"+content.Text, telegramTextLimit)
+	}
+	parts := []string{}
+	if content.Stars != "" {
+		parts = append(parts, content.Stars+"  <b>"+html.EscapeString(content.Heading)+"</b>\n<i>"+html.EscapeString(content.Byline)+"</i>")
+	}
+	for _, section := range content.Sections {
+		parts = append(parts, "<b>"+html.EscapeString(section.Name)+"</b>\n"+html.EscapeString(strings.Join(section.Lines, "\n")))
+	}
+	link := ""
+	if content.URL != "" {
+		link = "\n\n" + `<a href="` + html.EscapeString(content.URL) + `">View in store</a>`
+	}
+
+	// the body is cut to fit the limit, as the tags can't be cut
+	text := head
+	if len(parts) > 0 {
+		text += "\n\n" + strings.Join(parts, "\n\n")
+	}
+	if content.Body != "" {
+		limit := telegramTextLimit - len([]rune(text+link)) - len("\n\n<pre></pre>")
+		body := html.EscapeString(truncate(content.Body, max(limit, 1)))
+		if content.IsError {
+			body = "<pre>" + body + "</pre>"
+		}
+		text += "\n\n" + body
+	}
+	return text + link
+}
@@ -1,9 +1,12 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -12,34 +15,242 @@ func init() {
 }
 
 func TestNotify(t *testing.T) {
-	nn := NewNotify()
+	nn, err := NewNotify(app.NotifyEntry{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(nn.Notifiers))
+	assert.Equal(t, ChannelConsole, nn.Notifiers[0].Channel())
 	repo := NewReviewsRepository()
 	reviews := Reviews{
 		AppName: "test",
 		Store:   "test",
-		Usernames: []string{
-			"test",
-		},
-		Titles: []string{
-			"test",
-		},
-		Bodies: []string{
-			"test",
-		},
-		Ratings: []int{
-			5,
-		},
-		Datetimes: []time.Time{
-			time.Now(),
+		Items: []Review{
+			{
+				Username: "test",
+				Title:    "test",
+				Body:     "test",
+				Rating:   5,
+				RatedAt:  time.Now(),
+			},
 		},
 	}
-	newReviews, err := repo.FindOrNewReviews(reviews)
+	newReviews, _, err := repo.FindOrNewReviews(reviews)
 	assert.Nil(t, err)
 	err = nn.NotifyNewReviews(newReviews)
 	assert.Nil(t, err)
 
-	_, err = repo.FindLastReviewCount(reviews)
+	// the review is edited by the user
+	reviews.Items[0].Body = "test edited"
+	reviews.Items[0].Rating = 2
+	_, edits, err := repo.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(edits))
+	err = nn.NotifyUpdatedReviews(edits)
+	assert.Nil(t, err)
+
+	last, err := repo.FindLastReviewCount(reviews)
+	assert.Nil(t, err)
+	current, err := repo.FindOrNewReviewCount(reviews)
 	assert.Nil(t, err)
-	_, err = repo.FindOrNewReviewCount(reviews)
+	err = nn.NotifyReviewCount(current, last)
+	assert.Nil(t, err)
+
+	err = nn.NotifyError("test", "test", fmt.Errorf("[error] <no> reviews"))
+	assert.Nil(t, err)
+}
+
+// fakeNotifier records the notifications, and fails them all when err is set
+type fakeNotifier struct {
+	channel string
+	err     error
+	events  []string
+}
+
+func (f *fakeNotifier) Channel() string { return f.channel }
+func (f *fakeNotifier) NotifyNewReview(review ReviewModel) error {
+	f.events = append(f.events, "new "+review.Title)
+	return f.err
+}
+func (f *fakeNotifier) NotifyUpdatedReview(edit ReviewEdit) error {
+	f.events = append(f.events, "updated "+edit.Review.Title)
+	return f.err
+}
+func (f *fakeNotifier) NotifyReviewCount(current, last ReviewCountsModel) error {
+	f.events = append(f.events, fmt.Sprintf("rating %d", current.Total))
+	return f.err
+}
+func (f *fakeNotifier) NotifyError(appName, store string, err error) error {
+	f.events = append(f.events, "error "+err.Error())
+	return f.err
+}
+
+func TestNotifyFanOut(t *testing.T) {
+	failing := &fakeNotifier{channel: "failing", err: errors.New("unreachable")}
+	working := &fakeNotifier{channel: "working"}
+	nn := &Notify{Notifiers: []Notifier{failing, working}}
+
+	today := time.Now()
+	old := today.AddDate(0, 0, -3)
+	reviews := []ReviewModel{
+		{Title: "today", RatedAt: &today, CreatedAt: &today},
+		{Title: "old", RatedAt: &old, CreatedAt: &old},
+	}
+	err := nn.NotifyNewReviews(reviews)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "new review notification on failing failed: unreachable")
+	assert.NotContains(t, err.Error(), "working")
+
+	assert.NotNil(t, nn.NotifyUpdatedReviews([]ReviewEdit{{Review: ReviewModel{Title: "edited"}}}))
+	assert.NotNil(t, nn.NotifyReviewCount(ReviewCountsModel{Total: 10}, ReviewCountsModel{}))
+	assert.NotNil(t, nn.NotifyError("a", StoreIOS, errors.New("no reviews")))
+
+	// the failing channel doesn't stop the others
+	want := []string{"new today", "updated edited", "rating 10", "error no reviews"}
+	assert.Equal(t, want, failing.events)
+	assert.Equal(t, want, working.events)
+
+	// no errors when all channels are notified
+	nn = &Notify{Notifiers: []Notifier{working}}
+	assert.Nil(t, nn.NotifyReviewCount(ReviewCountsModel{Total: 11}, ReviewCountsModel{}))
+}
+
+func TestNotifyRulesFanOut(t *testing.T) {
+	teams := &fakeNotifier{channel: ChannelMSTeams}
+	console := &fakeNotifier{channel: ChannelConsole}
+	rules, err := NewNotifyRules([]app.NotifyRule{{Channels: []string{ChannelMSTeams}, MaxRating: 2}})
 	assert.Nil(t, err)
+	nn := &Notify{Notifiers: []Notifier{console, teams}, Rules: rules}
+
+	today := time.Now()
+	assert.Nil(t, nn.NotifyNewReviews([]ReviewModel{
+		{Title: "nice game", Rating: 5, RatedAt: &today},
+		{Title: "too many ads", Rating: 1, RatedAt: &today},
+	}))
+	assert.Nil(t, nn.NotifyUpdatedReviews([]ReviewEdit{{Review: ReviewModel{Title: "now nice", Rating: 4}}}))
+	assert.Nil(t, nn.NotifyReviewCount(ReviewCountsModel{Total: 10}, ReviewCountsModel{}))
+
+	assert.Equal(t, []string{"new nice game", "new too many ads", "updated now nice", "rating 10"}, console.events)
+	assert.Equal(t, []string{"new too many ads", "rating 10"}, teams.events)
+
+	_, err = NewNotify(app.NotifyEntry{Rules: []app.NotifyRule{{Regex: "("}}})
+	assert.NotNil(t, err)
+}
+
+func TestNotifyUndelivered(t *testing.T) {
+	down := &fakeNotifier{channel: "down", err: errors.New("unreachable")}
+	up := &fakeNotifier{channel: "up"}
+	nn := &Notify{Notifiers: []Notifier{down, up}, notifications: NewNotificationsRepository()}
+
+	now := time.Now()
+	reviews := Reviews{
+		AppName: "app-undelivered",
+		Store:   "store",
+		Items: []Review{
+			{ExternalID: "1", Username: "after downtime", Title: "late", Rating: 4, RatedAt: now.Add(-20 * time.Hour)},
+			{ExternalID: "2", Username: "old", Title: "old", Rating: 3, RatedAt: now.AddDate(0, 0, -3)},
+		},
+	}
+	repo := NewReviewsRepository()
+	found, _, err := repo.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	// the old review was scraped 3 days ago, and the late one now though it was rated before the previous run
+	assert.Nil(t, repo.db.Model(&found[1]).UpdateColumn("created_at", now.AddDate(0, 0, -3)).Error)
+
+	// the run fails halfway on the channel that is down
+	assert.NotNil(t, nn.NotifyUndelivered("app-undelivered", "store"))
+	assert.Equal(t, []string{"new late"}, up.events)
+	assert.Equal(t, []string{"new late"}, down.events)
+
+	// delivered on the next run on the channel that was down only
+	down.err = nil
+	assert.Nil(t, nn.NotifyUndelivered("app-undelivered", "store"))
+	assert.Equal(t, []string{"new late"}, up.events)
+	assert.Equal(t, []string{"new late", "new late"}, down.events)
+
+	// the edit is delivered once
+	reviews.Items[0].Title = "later"
+	_, _, err = repo.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Nil(t, nn.NotifyUndelivered("app-undelivered", "store"))
+	assert.Nil(t, nn.NotifyUndelivered("app-undelivered", "store"))
+	assert.Equal(t, []string{"new late", "updated later"}, up.events)
+
+	// a longer lookback delivers the older review
+	nn.Lookback = 96 * time.Hour
+	assert.Nil(t, nn.NotifyUndelivered("app-undelivered", "store"))
+	assert.Equal(t, []string{"new late", "updated later", "new old"}, up.events)
+
+	_, err = NewNotify(app.NotifyEntry{Lookback: "3 days"})
+	assert.NotNil(t, err)
+}
+
+func TestNotifyUndeliveredFirstScrape(t *testing.T) {
+	up := &fakeNotifier{channel: "up"}
+	nn := &Notify{Notifiers: []Notifier{up}, notifications: NewNotificationsRepository(), Lookback: 72 * time.Hour}
+
+	// the first scrape of the app has its older reviews, which aren't notified
+	now := time.Now()
+	reviews := Reviews{AppName: "app-first-scrape", Store: StoreAndroid}
+	for i := 0; i < 10; i++ {
+		reviews.Items = append(reviews.Items, Review{ExternalID: fmt.Sprint(i), Username: "u", Title: "backfill", Rating: 3, RatedAt: now.AddDate(0, 0, -4-i)})
+	}
+	_, _, err := NewReviewsRepository().FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Nil(t, nn.NotifyUndelivered("app-first-scrape", StoreAndroid))
+	assert.Empty(t, up.events)
+
+	// while the new ones of the next scrape are
+	reviews.Items = append(reviews.Items, Review{ExternalID: "new", Username: "u", Title: "new", Rating: 5, RatedAt: now.Add(-time.Hour)})
+	_, _, err = NewReviewsRepository().FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Nil(t, nn.NotifyUndelivered("app-first-scrape", StoreAndroid))
+	assert.Equal(t, []string{"new new"}, up.events)
+}
+
+// digestNotifier keeps the new reviews until the end of the run, and fails it when err is set
+type digestNotifier struct {
+	fakeNotifier
+	kept []string
+}
+
+func (d *digestNotifier) BeginRun(run NotifyRun) { d.kept = nil }
+func (d *digestNotifier) EndRun() error {
+	if d.err == nil {
+		d.events = append(d.events, d.kept...)
+	}
+	d.kept = nil
+	return d.err
+}
+func (d *digestNotifier) Buffered(notification string) bool {
+	return notification == NotificationNewReview
+}
+func (d *digestNotifier) NotifyNewReview(review ReviewModel) error {
+	d.kept = append(d.kept, "new "+review.Title)
+	return nil
+}
+
+func TestNotifyBuffered(t *testing.T) {
+	digest := &digestNotifier{fakeNotifier: fakeNotifier{channel: "digest", err: errors.New("unreachable")}}
+	nn := &Notify{Notifiers: []Notifier{digest}, notifications: NewNotificationsRepository()}
+	reviews := Reviews{
+		AppName: "app-buffered",
+		Store:   "store",
+		Items:   []Review{{ExternalID: "1", Username: "a", Title: "kept", Rating: 4, RatedAt: time.Now()}},
+	}
+	_, _, err := NewReviewsRepository().FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+
+	// the digest of the run isn't sent, so the review isn't recorded as delivered
+	nn.BeginRun(NotifyRun{AppName: "app-buffered", Store: "store"})
+	assert.Nil(t, nn.NotifyUndelivered("app-buffered", "store"))
+	assert.NotNil(t, nn.EndRun())
+	assert.Empty(t, digest.events)
+
+	// it is sent on the next run, once
+	digest.err = nil
+	for i := 0; i < 2; i++ {
+		nn.BeginRun(NotifyRun{AppName: "app-buffered", Store: "store"})
+		assert.Nil(t, nn.NotifyUndelivered("app-buffered", "store"))
+		assert.Nil(t, nn.EndRun())
+	}
+	assert.Equal(t, []string{"new kept"}, digest.events)
 }
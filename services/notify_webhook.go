@@ -0,0 +1,309 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+)
+
+// ChannelWebhook sends the notifications as signed JSON to the webhook URLs, when they are set
+const ChannelWebhook = "webhook"
+
+// WebhookPayloadVersion is the version of WebhookPayload, raised on breaking changes
+const WebhookPayloadVersion = 1
+
+// Events of WebhookPayload
+const (
+	WebhookEventReviewCreated = "review.created"
+	WebhookEventReviewUpdated = "review.updated"
+	WebhookEventRatingChanged = "rating.changed"
+	WebhookEventScrapeFailed  = "scrape.failed"
+	WebhookEventDigest        = "digest.created"
+)
+
+// Headers of the webhook requests
+const (
+	WebhookHeaderEvent     = "X-Reviews-Event"
+	WebhookHeaderDelivery  = "X-Reviews-Delivery"
+	WebhookHeaderSignature = "X-Reviews-Signature"
+)
+
+func init() {
+	RegisterChannel(ChannelWebhook, func(settings app.NotifyEntry) (Notifier, bool, error) {
+		if len(settings.WebhookURLs) == 0 {
+			return nil, false, nil
+		}
+		if settings.WebhookSecret == "" {
+			return nil, false, fmt.Errorf("[error] webhook URLs are set without the secret")
+		}
+		return NewWebhookNotifier(settings.WebhookURLs, settings.WebhookSecret), true, nil
+	})
+}
+
+// WebhookPayload is the JSON sent to the webhooks
+// Only the items of the event are set, eg. review for review.created
+type WebhookPayload struct {
+	Version int    `json:"version"`
+	Event   string `json:"event"`
+	AppName string `json:"app_name"`
+	Store   string `json:"store"`
+	SentAt  string `json:"sent_at"`
+	// Review is the new or the updated review
+	Review *ReviewModel `json:"review,omitempty"`
+	// Revision is the review before the update
+	Revision *ReviewRevisionModel `json:"revision,omitempty"`
+	// ReviewCount is the new rating summary, and PreviousReviewCount the last one when there is
+	ReviewCount         *ReviewCountsModel `json:"review_count,omitempty"`
+	PreviousReviewCount *ReviewCountsModel `json:"previous_review_count,omitempty"`
+	// Error is why the scrape failed
+	Error string `json:"error,omitempty"`
+	// Digest is the daily or weekly digest
+	Digest *Digest `json:"digest,omitempty"`
+}
+
+// WebhookNotifier POSTs the notifications as WebhookPayload to the URLs
+// The body is signed with HMAC-SHA256 of the secret, in the X-Reviews-Signature header as sha256={hex}
+// A delivery is tried again with backoff on 5xx and on network errors, up to MaxAttempts, until the context is done, see @SetContext
+// Every delivery is recorded in DB, so the failed ones can be replayed, see @WebhookNotifier.Replay
+// and a notification is sent once its deliveries are recorded, so that the other URLs don't get it again when one fails
+type WebhookNotifier struct {
+	URLs   []string
+	Secret string
+	// MaxAttempts is the number of attempts of a delivery, default is 5
+	MaxAttempts int
+	// Backoff is the wait after the first failed attempt, doubled after each one, default is 1s
+	Backoff time.Duration
+	// Transport is the http transport the payloads are sent with
+	// When nil, http.DefaultTransport is used
+	Transport http.RoundTripper
+
+	repo *WebhookDeliveriesRepository
+	ctx  context.Context
+}
+
+// NewWebhookNotifier creates a new WebhookNotifier
+func NewWebhookNotifier(urls []string, secret string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URLs:        urls,
+		Secret:      secret,
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+		repo:        NewWebhookDeliveriesRepository(),
+	}
+}
+
+// SetContext see @ContextNotifier
+func (w *WebhookNotifier) SetContext(ctx context.Context) {
+	w.ctx = ctx
+}
+
+// Channel see @Notifier
+func (w *WebhookNotifier) Channel() string {
+	return ChannelWebhook
+}
+
+// NotifyNewReview see @Notifier
+func (w *WebhookNotifier) NotifyNewReview(review ReviewModel) error {
+	return w.send(WebhookPayload{
+		Event:   WebhookEventReviewCreated,
+		AppName: review.AppName,
+		Store:   review.Store,
+		Review:  &review,
+	})
+}
+
+// NotifyUpdatedReview see @Notifier
+func (w *WebhookNotifier) NotifyUpdatedReview(edit ReviewEdit) error {
+	return w.send(WebhookPayload{
+		Event:    WebhookEventReviewUpdated,
+		AppName:  edit.Review.AppName,
+		Store:    edit.Review.Store,
+		Review:   &edit.Review,
+		Revision: &edit.Revision,
+	})
+}
+
+// NotifyReviewCount see @Notifier
+func (w *WebhookNotifier) NotifyReviewCount(current, last ReviewCountsModel) error {
+	payload := WebhookPayload{
+		Event:       WebhookEventRatingChanged,
+		AppName:     current.AppName,
+		Store:       current.Store,
+		ReviewCount: &current,
+	}
+	if last.Total > 0 {
+		payload.PreviousReviewCount = &last
+	}
+	return w.send(payload)
+}
+
+// NotifyError see @Notifier
+func (w *WebhookNotifier) NotifyError(appName, store string, err error) error {
+	return w.send(WebhookPayload{
+		Event:   WebhookEventScrapeFailed,
+		AppName: appName,
+		Store:   store,
+		Error:   err.Error(),
+	})
+}
+
+// NotifyDigest see @DigestNotifier
+func (w *WebhookNotifier) NotifyDigest(digest Digest) error {
+	return w.send(WebhookPayload{
+		Event:   WebhookEventDigest,
+		AppName: digest.AppName,
+		Store:   digest.Store,
+		Digest:  &digest,
+	})
+}
+
+// Replay sends the failed delivery again, as it was sent, with its attempts
+func (w *WebhookNotifier) Replay(ctx context.Context, delivery WebhookDeliveryModel) error {
+	return w.deliver(ctx, &delivery)
+}
+
+// send records the payload as a delivery to each URL and delivers them
+// The notification is sent once its deliveries are recorded, and the ones that fail are left to webhook-replay
+// so that a URL never gets the notification twice under another delivery id, eg. when another URL failed
+func (w *WebhookNotifier) send(payload WebhookPayload) error {
+	payload.Version = WebhookPayloadVersion
+	payload.SentAt = time.Now().UTC().Format(time.RFC3339)
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	signature := w.Sign(b)
+	ctx := w.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// all the deliveries are recorded before any is sent, so that none is sent again when another can't be recorded
+	deliveries := []WebhookDeliveryModel{}
+	for _, url := range w.URLs {
+		deliveryID, err := newDeliveryID()
+		if err != nil {
+			return err
+		}
+		deliveries = append(deliveries, WebhookDeliveryModel{
+			DeliveryID: deliveryID,
+			URL:        url,
+			Event:      payload.Event,
+			Payload:    string(b),
+			Signature:  signature,
+			Status:     WebhookDeliveryPending,
+		})
+	}
+	if len(deliveries) > 0 {
+		if err := w.repo.InsertDeliveries(deliveries); err != nil {
+			return err
+		}
+	}
+	for i := range deliveries {
+		// the failed and the stopped deliveries are replayed, see @WebhookDeliveriesRepository.FindFailedDeliveries
+		if err := w.deliver(ctx, &deliveries[i]); err != nil {
+			log.Printf("[warn] %s, it is sent again by webhook-replay\n", err)
+		}
+	}
+	return nil
+}
+
+// Sign returns the signature of the body, as in the X-Reviews-Signature header
+func (w *WebhookNotifier) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver attempts the delivery until it is delivered, or it fails for good
+// every attempt is saved to the delivery
+// When ctx is done the delivery is stopped and left pending, so that it is replayed, see @FindFailedDeliveries
+func (w *WebhookNotifier) deliver(ctx context.Context, delivery *WebhookDeliveryModel) error {
+	maxAttempts := w.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	backoff := w.Backoff
+	for attempt := 1; ; attempt++ {
+		log.Printf("[info] Sending %s to webhook %s\n", delivery.Event, delivery.URL)
+		statusCode, err := w.post(ctx, delivery)
+		delivery.Attempts++
+		delivery.LastStatusCode = statusCode
+		delivery.LastError = ""
+		if err != nil {
+			delivery.LastError = err.Error()
+		}
+		retry := err != nil && (statusCode == 0 || statusCode >= 500) && attempt < maxAttempts
+		switch {
+		case err == nil:
+			now := time.Now()
+			delivery.Status = WebhookDeliveryDelivered
+			delivery.DeliveredAt = &now
+		case retry:
+			delivery.Status = WebhookDeliveryPending
+		default:
+			delivery.Status = WebhookDeliveryFailed
+		}
+		if saveErr := w.repo.SaveDelivery(delivery); saveErr != nil {
+			return saveErr
+		}
+		if !retry {
+			if err != nil {
+				return fmt.Errorf("[error] webhook delivery %d to %s failed after %d attempts: %w", delivery.ID, delivery.URL, delivery.Attempts, err)
+			}
+			return nil
+		}
+		log.Printf("[warn] webhook delivery %d to %s failed, trying again in %s: %s\n", delivery.ID, delivery.URL, backoff, err)
+		if !sleepContext(ctx, backoff) {
+			return fmt.Errorf("[error] webhook delivery %d to %s stopped after %d attempts: %w", delivery.ID, delivery.URL, delivery.Attempts, ctx.Err())
+		}
+		backoff *= 2
+	}
+}
+
+// post sends the delivery once, and returns the status code of the response
+// 0 is returned when there is no response
+func (w *WebhookNotifier) post(ctx context.Context, delivery *WebhookDeliveryModel) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-app-reviews-scraper")
+	req.Header.Set(WebhookHeaderEvent, delivery.Event)
+	req.Header.Set(WebhookHeaderDelivery, delivery.DeliveryID)
+	req.Header.Set(WebhookHeaderSignature, delivery.Signature)
+
+	client := &http.Client{Transport: w.Transport, Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("[error] webhook responded with %s: %s", resp.Status, strings.TrimSpace(string(bytes.ToValidUTF8(body, nil))))
+	}
+	return resp.StatusCode, nil
+}
+
+// newDeliveryID returns a random id for a delivery
+func newDeliveryID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"github.com/stretchr/testify/assert"
+)
+
+// webhookServer is a receiver of the webhook, that responds with the status codes in order, and 200 after them
+type webhookServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newWebhookServer(statuses ...int) *webhookServer {
+	s := &webhookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, b)
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func (s *webhookServer) received() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func newTestWebhookNotifier(urls ...string) *WebhookNotifier {
+	w := NewWebhookNotifier(urls, "secret")
+	w.Backoff = time.Millisecond
+	w.MaxAttempts = 3
+	return w
+}
+
+func lastDelivery(t *testing.T) WebhookDeliveryModel {
+	delivery := WebhookDeliveryModel{}
+	assert.Nil(t, NewWebhookDeliveriesRepository().db.Order("id DESC").First(&delivery).Error)
+	return delivery
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	server := newWebhookServer()
+	defer server.Close()
+	w := newTestWebhookNotifier(server.URL + "/reviews")
+
+	now := time.Now()
+	review := ReviewModel{ID: 7, AppName: "candy-crush", Store: StoreIOS, ExternalID: "123", Title: "Sweet", Rating: 5, RatedAt: &now}
+	assert.Nil(t, w.NotifyNewReview(review))
+	assert.Equal(t, 1, server.received())
+
+	r := server.requests[0]
+	body := server.bodies[0]
+	assert.Equal(t, "/reviews", r.URL.Path)
+	assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+	assert.Equal(t, WebhookEventReviewCreated, r.Header.Get(WebhookHeaderEvent))
+	assert.Equal(t, w.Sign(body), r.Header.Get(WebhookHeaderSignature))
+	assert.Equal(t, "sha256=", r.Header.Get(WebhookHeaderSignature)[:7])
+	assert.NotEqual(t, NewWebhookNotifier(nil, "other").Sign(body), r.Header.Get(WebhookHeaderSignature))
+
+	payload := WebhookPayload{}
+	assert.Nil(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, WebhookPayloadVersion, payload.Version)
+	assert.Equal(t, WebhookEventReviewCreated, payload.Event)
+	assert.Equal(t, "candy-crush", payload.AppName)
+	assert.Equal(t, StoreIOS, payload.Store)
+	assert.Equal(t, 7, payload.Review.ID)
+	assert.Equal(t, "Sweet", payload.Review.Title)
+	assert.Nil(t, payload.ReviewCount)
+
+	delivery := lastDelivery(t)
+	assert.Equal(t, r.Header.Get(WebhookHeaderDelivery), delivery.DeliveryID)
+	assert.Equal(t, WebhookDeliveryDelivered, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusOK, delivery.LastStatusCode)
+	assert.NotNil(t, delivery.DeliveredAt)
+
+	// rating and error events
+	assert.Nil(t, w.NotifyReviewCount(ReviewCountsModel{AppName: "candy-crush", Store: StoreIOS, Total: 10}, ReviewCountsModel{Total: 9}))
+	assert.Nil(t, json.Unmarshal(server.bodies[1], &payload))
+	assert.Equal(t, WebhookEventRatingChanged, payload.Event)
+	assert.Equal(t, 10, payload.ReviewCount.Total)
+	assert.Equal(t, 9, payload.PreviousReviewCount.Total)
+	assert.Nil(t, w.NotifyError("candy-crush", StoreIOS, errors.New("[error] No reviews found")))
+	payload = WebhookPayload{}
+	assert.Nil(t, json.Unmarshal(server.bodies[2], &payload))
+	assert.Equal(t, WebhookEventScrapeFailed, payload.Event)
+	assert.Equal(t, "[error] No reviews found", payload.Error)
+	assert.Nil(t, payload.Review)
+}
+
+func TestWebhookNotifierRetry(t *testing.T) {
+	// retried on 5xx
+	server := newWebhookServer(http.StatusServiceUnavailable, http.StatusBadGateway)
+	defer server.Close()
+	w := newTestWebhookNotifier(server.URL)
+	assert.Nil(t, w.NotifyError("candy-crush", StoreAndroid, errors.New("failed")))
+	assert.Equal(t, 3, server.received())
+	delivery := lastDelivery(t)
+	assert.Equal(t, WebhookDeliveryDelivered, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	// the same delivery on every attempt
+	assert.Equal(t, server.requests[0].Header.Get(WebhookHeaderDelivery), server.requests[2].Header.Get(WebhookHeaderDelivery))
+
+	// not retried on 4xx, and left to be replayed
+	server = newWebhookServer(http.StatusBadRequest)
+	defer server.Close()
+	w = newTestWebhookNotifier(server.URL)
+	assert.Nil(t, w.NotifyError("candy-crush", StoreAndroid, errors.New("failed")))
+	assert.Equal(t, 1, server.received())
+	delivery = lastDelivery(t)
+	assert.Equal(t, WebhookDeliveryFailed, delivery.Status)
+	assert.Contains(t, delivery.LastError, "400")
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusBadRequest, delivery.LastStatusCode)
+}
+
+func TestWebhookNotifierStop(t *testing.T) {
+	server := newWebhookServer(http.StatusServiceUnavailable)
+	defer server.Close()
+	w := newTestWebhookNotifier(server.URL)
+	w.Backoff = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	w.SetContext(ctx)
+	go func() {
+		for server.received() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	// the backoff is stopped, and the delivery is left pending to be replayed
+	assert.Nil(t, w.NotifyError("candy-crush", StoreAndroid, errors.New("failed")))
+	assert.Equal(t, 1, server.received())
+	delivery := lastDelivery(t)
+	assert.Equal(t, WebhookDeliveryPending, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+
+	repo := NewWebhookDeliveriesRepository()
+	failed, err := repo.FindFailedDeliveries()
+	assert.Nil(t, err)
+	for _, f := range failed {
+		assert.NotEqual(t, delivery.ID, f.ID)
+	}
+	stale := time.Now().Add(-WebhookPendingTimeout - time.Minute)
+	assert.Nil(t, repo.db.Model(&delivery).UpdateColumn("updated_at", stale).Error)
+	failed, err = repo.FindFailedDeliveries()
+	assert.Nil(t, err)
+	assert.Equal(t, delivery.ID, failed[len(failed)-1].ID)
+	assert.Nil(t, w.Replay(context.Background(), failed[len(failed)-1]))
+	assert.Equal(t, 2, server.received())
+}
+
+func TestWebhookNotifierURLs(t *testing.T) {
+	ok := newWebhookServer()
+	defer ok.Close()
+	down := newWebhookServer(http.StatusBadRequest)
+	defer down.Close()
+	w := newTestWebhookNotifier(ok.URL, down.URL)
+	nn := &Notify{Notifiers: []Notifier{w}, notifications: NewNotificationsRepository()}
+	reviews := Reviews{
+		AppName: "app-webhook-urls",
+		Store:   StoreIOS,
+		Items:   []Review{{ExternalID: "1", Username: "a", Title: "once", Rating: 5, RatedAt: time.Now()}},
+	}
+	_, _, err := NewReviewsRepository().FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+
+	// the notification is delivered once its deliveries are recorded, so the next run doesn't send it again
+	assert.Nil(t, nn.NotifyUndelivered("app-webhook-urls", StoreIOS))
+	assert.Nil(t, nn.NotifyUndelivered("app-webhook-urls", StoreIOS))
+	assert.Equal(t, 1, ok.received())
+	assert.Equal(t, 1, down.received())
+
+	// and the failed delivery is replayed to its URL only, with the same delivery id
+	delivery := lastDelivery(t)
+	assert.Equal(t, down.URL, delivery.URL)
+	assert.Equal(t, WebhookDeliveryFailed, delivery.Status)
+	assert.Nil(t, w.Replay(context.Background(), delivery))
+	assert.Equal(t, 1, ok.received())
+	assert.Equal(t, 2, down.received())
+	assert.Equal(t, down.requests[0].Header.Get(WebhookHeaderDelivery), down.requests[1].Header.Get(WebhookHeaderDelivery))
+}
+
+func TestWebhookNotifierReplay(t *testing.T) {
+	server := newWebhookServer(http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+	defer server.Close()
+	w := newTestWebhookNotifier(server.URL)
+	assert.Nil(t, w.NotifyError("farm-heroes", StoreIOS, errors.New("failed")))
+	assert.Equal(t, 3, server.received())
+
+	repo := NewWebhookDeliveriesRepository()
+	failed, err := repo.FindFailedDeliveries()
+	assert.Nil(t, err)
+	delivery := failed[len(failed)-1]
+	assert.Equal(t, WebhookDeliveryFailed, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Equal(t, http.StatusInternalServerError, delivery.LastStatusCode)
+	assert.Contains(t, delivery.LastError, "500")
+
+	// replayed as it was sent, without the secret
+	replayer := NewWebhookNotifier(nil, "")
+	assert.Nil(t, replayer.Replay(context.Background(), delivery))
+	assert.Equal(t, 4, server.received())
+	assert.Equal(t, server.bodies[0], server.bodies[3])
+	assert.Equal(t, server.requests[0].Header.Get(WebhookHeaderSignature), server.requests[3].Header.Get(WebhookHeaderSignature))
+	assert.Equal(t, server.requests[0].Header.Get(WebhookHeaderDelivery), server.requests[3].Header.Get(WebhookHeaderDelivery))
+
+	replayed, found, err := repo.FindDelivery(delivery.ID)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, WebhookDeliveryDelivered, replayed.Status)
+	assert.Equal(t, 4, replayed.Attempts)
+	failed, err = repo.FindFailedDeliveries()
+	assert.Nil(t, err)
+	for _, f := range failed {
+		assert.NotEqual(t, delivery.ID, f.ID)
+	}
+
+	_, found, err = repo.FindDelivery(-1)
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+func TestWebhookChannel(t *testing.T) {
+	notifiers, err := NewNotifiers(app.NotifyEntry{WebhookURLs: []string{"https://example.com/a", "https://example.com/b"}, WebhookSecret: "secret"})
+	assert.Nil(t, err)
+	w := notifiers[len(notifiers)-1].(*WebhookNotifier)
+	assert.Equal(t, []string{"https://example.com/a", "https://example.com/b"}, w.URLs)
+
+	_, err = NewNotifiers(app.NotifyEntry{WebhookURLs: []string{"https://example.com/a"}})
+	assert.NotNil(t, err)
+}
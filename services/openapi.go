@@ -0,0 +1,210 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// openAPISchemas are the schemas of the spec by their name, generated from the JSON of their types
+var openAPISchemas = []struct {
+	name string
+	v    interface{}
+}{
+	{name: "App", v: AppSummary{}},
+	{name: "Review", v: ReviewModel{}},
+	{name: "ReviewRevision", v: ReviewRevisionModel{}},
+	{name: "DeveloperResponse", v: DeveloperResponseModel{}},
+	{name: "ReviewsPage", v: APIPage{}},
+	{name: "ReviewDetail", v: APIReview{}},
+	{name: "Rating", v: APIRating{}},
+	{name: "Scrape", v: APIScrape{}},
+	{name: "Error", v: APIError{}},
+}
+
+// OpenAPI returns the OpenAPI 3 spec of the API, see @API
+// The schemas are generated from the JSON of the responses, so that the spec follows the models
+func OpenAPI() map[string]interface{} {
+	refs := map[reflect.Type]string{}
+	for _, s := range openAPISchemas {
+		refs[reflect.TypeOf(s.v)] = s.name
+	}
+	schemas := map[string]interface{}{}
+	for _, s := range openAPISchemas {
+		schemas[s.name] = openAPISchema(reflect.TypeOf(s.v), refs, true)
+	}
+
+	dateParams := []map[string]interface{}{
+		openAPIParam("from", "query", "string", "From the date, inclusive, eg. 2006-01-02 or 2006-01-02T15:04:05Z"),
+		openAPIParam("to", "query", "string", "To the date, the whole day when it is a date, eg. 2006-01-02 or 2006-01-02T15:04:05Z"),
+	}
+	appParam := openAPIParam("app", "path", "string", "The app name")
+	appParam["required"] = true
+	idParam := openAPIParam("id", "path", "integer", "The review id")
+	idParam["required"] = true
+	feedParams := []map[string]interface{}{
+		appParam,
+		openAPIParam("store", "query", "string", "Only the reviews on the store"),
+		openAPIParam("rating", "query", "integer", "Only the reviews of the rating, 1 to 5"),
+		openAPIParam("min_rating", "query", "integer", "Only the reviews of the rating or above"),
+		openAPIParam("max_rating", "query", "integer", "Only the reviews of the rating or below"),
+		openAPIParam("q", "query", "string", "Only the reviews with the text in the title or the body, case insensitive"),
+		openAPIParam("key", "query", "string", "The API key, for the feed readers that can't set the headers"),
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "go-app-reviews-scraper",
+			"description": "The stored reviews and rating summaries of the apps",
+			"version":     "1",
+		},
+		"security": []map[string]interface{}{{"bearer": []string{}}, {"apiKey": []string{}}},
+		"paths": map[string]interface{}{
+			"/api/apps": map[string]interface{}{
+				"get": openAPIOperation("List the apps on each store with stored reviews", nil, openAPIOK("App", true)),
+			},
+			"/api/reviews": map[string]interface{}{
+				"get": openAPIOperation("List the reviews, newest first", append([]map[string]interface{}{
+					openAPIParam("app_name", "query", "string", "Only the reviews of the app"),
+					openAPIParam("store", "query", "string", "Only the reviews on the store, eg. android or ios"),
+					openAPIParam("rating", "query", "integer", "Only the reviews of the rating, 1 to 5"),
+					openAPIParam("min_rating", "query", "integer", "Only the reviews of the rating or above"),
+					openAPIParam("max_rating", "query", "integer", "Only the reviews of the rating or below"),
+					openAPIParam("q", "query", "string", "Only the reviews with the text in the title or the body, case insensitive"),
+					openAPIParam("page", "query", "integer", "The page, from 1"),
+					openAPIParam("per_page", "query", "integer", "The reviews of a page, default 50, maximum 500"),
+				}, dateParams...), map[string]interface{}{"200": openAPIResponse("ReviewsPage", false)}),
+			},
+			"/api/reviews/{id}": map[string]interface{}{
+				"get": openAPIOperation("Get the review, with its edits and the developer's reply", []map[string]interface{}{idParam},
+					map[string]interface{}{"200": openAPIResponse("ReviewDetail", false), "404": openAPIResponse("Error", false)}),
+			},
+			"/api/apps/{app}/ratings": map[string]interface{}{
+				"get": openAPIOperation("List the rating summaries of the app, oldest first", append([]map[string]interface{}{
+					appParam,
+					openAPIParam("store", "query", "string", "Only the rating summaries on the store"),
+				}, dateParams...), openAPIOK("Rating", true)),
+			},
+			"/api/apps/{app}/reviews.atom": map[string]interface{}{
+				"get": openAPIOperation("The newest reviews of the app as an Atom feed", feedParams, openAPIFeed(FeedAtom)),
+			},
+			"/api/apps/{app}/reviews.rss": map[string]interface{}{
+				"get": openAPIOperation("The newest reviews of the app as an RSS feed", feedParams, openAPIFeed(FeedRSS)),
+			},
+			"/api/apps/{app}/scrape": map[string]interface{}{
+				"post": openAPIOperation("Scrape the app now, in the background", []map[string]interface{}{appParam},
+					map[string]interface{}{
+						"202": openAPIResponse("Scrape", false),
+						"404": openAPIResponse("Error", false),
+						"409": openAPIResponse("Scrape", false),
+					}),
+			},
+		},
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+	}
+}
+
+func openAPIOperation(summary string, params []map[string]interface{}, responses map[string]interface{}) map[string]interface{} {
+	responses["401"] = openAPIResponse("Error", false)
+	operation := map[string]interface{}{"summary": summary, "responses": responses}
+	if len(params) > 0 {
+		operation["parameters"] = params
+	}
+	return operation
+}
+
+func openAPIParam(name, in, typ, description string) map[string]interface{} {
+	return map[string]interface{}{"name": name, "in": in, "description": description, "schema": map[string]interface{}{"type": typ}}
+}
+
+// openAPIResponse is the JSON response of the schema, in {"data": [...]} when list
+func openAPIResponse(schema string, list bool) map[string]interface{} {
+	s := map[string]interface{}{"$ref": "#/components/schemas/" + schema}
+	if list {
+		s = map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"data": map[string]interface{}{"type": "array", "items": s}},
+		}
+	}
+	return map[string]interface{}{
+		"description": schema,
+		"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": s}},
+	}
+}
+
+// openAPIOK is the 200 response of the schema, see @openAPIResponse
+func openAPIOK(schema string, list bool) map[string]interface{} {
+	return map[string]interface{}{"200": openAPIResponse(schema, list)}
+}
+
+// openAPIFeed is the 200 response of the feed of the format, see @Feed
+func openAPIFeed(format string) map[string]interface{} {
+	contentType, _, _ := strings.Cut(FeedContentType(format), ";")
+	return map[string]interface{}{"200": map[string]interface{}{
+		"description": format + " feed",
+		"content":     map[string]interface{}{contentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}},
+	}}
+}
+
+// openAPISchema returns the schema of the JSON of the type
+// The types of refs are referenced by their name, but when top, which is the schema of the type itself
+func openAPISchema(t reflect.Type, refs map[reflect.Type]string, top bool) map[string]interface{} {
+	if name, ok := refs[t]; ok && !top {
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		schema := openAPISchema(t.Elem(), refs, false)
+		if _, ok := schema["$ref"]; ok {
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]interface{}{"type": "array", "items": openAPISchema(t.Elem(), refs, false)}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": openAPISchema(t.Elem(), refs, false)}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.Struct:
+		properties := map[string]interface{}{}
+		openAPIProperties(t, refs, properties)
+		return map[string]interface{}{"type": "object", "properties": properties}
+	}
+	return map[string]interface{}{}
+}
+
+// openAPIProperties adds the JSON fields of the struct to the properties, along with the fields of its embedded structs
+func openAPIProperties(t reflect.Type, refs map[reflect.Type]string, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			openAPIProperties(field.Type, refs, properties)
+			continue
+		}
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = openAPISchema(field.Type, refs, false)
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimitTransport limits the requests per host with a token bucket for each host
+// so that the stores don't throttle the scrapers, eg. apps.apple.com and play.google.com
+// A request waits for a token of its host, or until its context is done
+// Set it as the Transport of the scrapers, and share it between them for the limit to be per host
+type RateLimitTransport struct {
+	// Rate is the number of requests per second for each host
+	Rate float64
+	// Burst is the number of requests for each host that can be sent at once
+	Burst int
+	// Next is the transport the requests are sent with
+	// When nil, http.DefaultTransport is used
+	Next http.RoundTripper
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	// now and sleep are the clock of the buckets, see @sleepContext
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) bool
+}
+
+// NewRateLimitTransport creates a new RateLimitTransport
+// rate is the requests per second and burst the requests at once, for each host
+func NewRateLimitTransport(rate float64, burst int, next http.RoundTripper) *RateLimitTransport {
+	return &RateLimitTransport{
+		Rate:    rate,
+		Burst:   burst,
+		Next:    next,
+		buckets: map[string]*tokenBucket{},
+		now:     time.Now,
+		sleep:   sleepContext,
+	}
+}
+
+// RoundTrip sends the request after a token of the request's host
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sleep := t.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	if err := t.bucket(req.URL.Host).wait(req.Context(), sleep); err != nil {
+		return nil, err
+	}
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
+
+// bucket returns the token bucket of the host, a new full one for the first request of the host
+func (t *RateLimitTransport) bucket(host string) *tokenBucket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.buckets == nil {
+		t.buckets = map[string]*tokenBucket{}
+	}
+	b, ok := t.buckets[host]
+	if !ok {
+		now := t.now
+		if now == nil {
+			now = time.Now
+		}
+		b = newTokenBucket(t.Rate, t.Burst, now)
+		t.buckets[host] = b
+	}
+	return b
+}
+
+// tokenBucket refills rate tokens per second, up to burst tokens
+// and every request takes a token
+type tokenBucket struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a new full tokenBucket
+// A rate of 0 or less is no limit, and a burst of less than 1 is 1
+func newTokenBucket(rate float64, burst int, now func() time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		now:    now,
+		tokens: float64(burst),
+		last:   now(),
+	}
+}
+
+// reserve takes a token and returns how long to wait for it
+// The token is taken in advance, so the waiting requests are sent in order
+func (b *tokenBucket) reserve() time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel gives back a token that was reserved but not used
+func (b *tokenBucket) cancel() {
+	if b.rate <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens++
+}
+
+// wait waits for a token with sleep, see @sleepContext, or returns the error of the context when it is done first
+func (b *tokenBucket) wait(ctx context.Context, sleep func(ctx context.Context, d time.Duration) bool) error {
+	delay := b.reserve()
+	if delay == 0 {
+		return nil
+	}
+	if !sleep(ctx, delay) {
+		b.cancel()
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newTokenBucket(1, 2, func() time.Time { return now })
+
+	// burst is sent at once, then one per second
+	assert.Equal(t, time.Duration(0), b.reserve())
+	assert.Equal(t, time.Duration(0), b.reserve())
+	assert.Equal(t, time.Second, b.reserve())
+	assert.Equal(t, 2*time.Second, b.reserve())
+
+	// refills after the reserved tokens, up to the burst
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, time.Duration(0), b.reserve())
+	assert.Equal(t, time.Duration(0), b.reserve())
+	assert.Equal(t, time.Second, b.reserve())
+
+	// cancelled token is given back
+	b.cancel()
+	assert.Equal(t, time.Second, b.reserve())
+
+	// no limit
+	b = newTokenBucket(0, 0, func() time.Time { return now })
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, time.Duration(0), b.reserve())
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	var requests int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	})
+	server1 := httptest.NewServer(handler)
+	defer server1.Close()
+	server2 := httptest.NewServer(handler)
+	defer server2.Close()
+
+	// the clock only moves when the requests wait, so the waits are asserted instead of the time they took
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	waits := []time.Duration{}
+	transport := NewRateLimitTransport(20, 1, nil)
+	transport.now = func() time.Time { return now }
+	transport.sleep = func(ctx context.Context, d time.Duration) bool {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return true
+	}
+	client := &http.Client{Transport: transport}
+	get := func(ctx context.Context, url string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		assert.Nil(t, err)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	// 1 at once, then 1 every 50ms
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, get(context.Background(), server1.URL))
+	}
+	ms50 := 50 * time.Millisecond
+	assert.Equal(t, []time.Duration{ms50, ms50, ms50, ms50}, waits)
+
+	// the other host has its own limit
+	waits = []time.Duration{}
+	assert.Nil(t, get(context.Background(), server2.URL))
+	assert.Empty(t, waits)
+
+	// waiting request is cancelled with its context, and its token is given back
+	ctx, cancel := context.WithCancel(context.Background())
+	transport.sleep = func(ctx context.Context, d time.Duration) bool {
+		waits = append(waits, d)
+		cancel()
+		return false
+	}
+	err := get(ctx, server1.URL)
+	assert.NotNil(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []time.Duration{ms50}, waits)
+	assert.Equal(t, ms50, transport.bucket(serverHost(t, server1)).reserve())
+	assert.Equal(t, int32(6), atomic.LoadInt32(&requests))
+}
+
+// serverHost returns the host of the test server, the key of its bucket
+func serverHost(t *testing.T, server *httptest.Server) string {
+	u, err := url.Parse(server.URL)
+	assert.Nil(t, err)
+	return u.Host
+}
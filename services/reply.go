@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Replier posts the developer's reply to a review on the store
+// Each store's developer API is a Replier, see @AppStoreConnect and @GooglePlayDeveloper
+type Replier interface {
+	// Store is the store name of the reviews the Replier can reply to, same as the Scraper's
+	Store() string
+	// Reply posts the text as the reply to the review
+	// and returns the date of the reply as saved by the store
+	Reply(ctx context.Context, review ReviewModel, text string) (time.Time, error)
+}
+
+// Responder replies to the stored reviews and records the replies locally
+type Responder struct {
+	repo     *ReviewsRepository
+	repliers map[string]Replier
+}
+
+// NewResponder creates a new Responder with the repliers of the stores
+// A review of a store without a replier cannot be replied to
+func NewResponder(repliers ...Replier) *Responder {
+	r := &Responder{
+		repo:     NewReviewsRepository(),
+		repliers: map[string]Replier{},
+	}
+	for _, replier := range repliers {
+		r.repliers[replier.Store()] = replier
+	}
+	return r
+}
+
+// Reply posts the text as the reply to the stored review of the reviewID
+// and saves the reply to developer_responses, replacing the previous reply
+// The review must have the store's review ID, the reviews with a hash or legacy ID cannot be replied to
+func (r *Responder) Reply(ctx context.Context, reviewID int, text string) (DeveloperResponseModel, error) {
+	if strings.TrimSpace(text) == "" {
+		return DeveloperResponseModel{}, fmt.Errorf("[error] reply text is empty")
+	}
+	review, err := r.repo.FindReview(reviewID)
+	if err != nil {
+		return DeveloperResponseModel{}, fmt.Errorf("[error] unable to find review %d: %w", reviewID, err)
+	}
+	if review.ExternalID == "" ||
+		strings.HasPrefix(review.ExternalID, legacyExternalIDPrefix) ||
+		strings.HasPrefix(review.ExternalID, hashExternalIDPrefix) {
+		return DeveloperResponseModel{}, fmt.Errorf("[error] review %d has no store review ID, scrape it again to reply", reviewID)
+	}
+	replier, ok := r.repliers[review.Store]
+	if !ok {
+		return DeveloperResponseModel{}, fmt.Errorf("[error] no replier for store %s", review.Store)
+	}
+
+	respondedAt, err := replier.Reply(ctx, review, text)
+	if err != nil {
+		return DeveloperResponseModel{}, err
+	}
+	return r.repo.SaveDeveloperResponse(review.ID, text, respondedAt)
+}
+
+// signJWT returns the signed JWT of the claims
+// ES256 is signed with an ECDSA P-256 key and RS256 with an RSA key, which are the ones used by the stores
+// kid is optional and is not set in the header when empty
+func signJWT(key crypto.Signer, kid string, claims map[string]interface{}) (string, error) {
+	header := map[string]string{"typ": "JWT"}
+	switch key.(type) {
+	case *ecdsa.PrivateKey:
+		header["alg"] = "ES256"
+	case *rsa.PrivateKey:
+		header["alg"] = "RS256"
+	default:
+		return "", fmt.Errorf("[error] unsupported key type %T", key)
+	}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		// JWT wants the raw r || s of 32 bytes each, not the ASN.1 of ecdsa.SignASN1
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return "", err
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", err
+		}
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// AppStoreConnectBaseURL is the base URL of the App Store Connect API
+	AppStoreConnectBaseURL = "https://api.appstoreconnect.apple.com"
+
+	// appStoreConnectAudience is the aud claim of the JWT for the App Store Connect API
+	appStoreConnectAudience = "appstoreconnect-v1"
+	// appStoreConnectTokenTTL is how long the JWT is valid, App Store Connect allows up to 20 minutes
+	appStoreConnectTokenTTL = 10 * time.Minute
+)
+
+// AppStoreConnect replies to the App Store reviews with the App Store Connect customer reviews API
+// The API key is created in App Store Connect > Users and Access > Integrations, with a .p8 private key
+// https://developer.apple.com/documentation/appstoreconnectapi/customer_review_responses
+type AppStoreConnect struct {
+	// BaseURL is the App Store Connect API, see @AppStoreConnectBaseURL
+	BaseURL  string
+	IssuerID string
+	KeyID    string
+	// PrivateKey is the key of the .p8 file, signs the JWT with ES256
+	PrivateKey *ecdsa.PrivateKey
+	// Transport is the http transport used to call the API
+	// When nil, http.DefaultTransport is used
+	Transport http.RoundTripper
+}
+
+// NewAppStoreConnect creates a new AppStoreConnect from the API key
+// privateKeyPEM is the content of the .p8 file
+func NewAppStoreConnect(issuerID, keyID string, privateKeyPEM []byte) (*AppStoreConnect, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("[error] unable to decode the App Store Connect private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("[error] unable to parse the App Store Connect private key: %w", err)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("[error] App Store Connect private key is not an ECDSA key")
+	}
+	return &AppStoreConnect{
+		BaseURL:    AppStoreConnectBaseURL,
+		IssuerID:   issuerID,
+		KeyID:      keyID,
+		PrivateKey: ecKey,
+	}, nil
+}
+
+// Store returns the store name for iOS
+func (a *AppStoreConnect) Store() string {
+	return StoreIOS
+}
+
+// appStoreConnectResource is a resource of the App Store Connect API, as type and ID
+type appStoreConnectResource struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+}
+
+// appStoreConnectResponse is the request and response body of customerReviewResponses
+type appStoreConnectResponse struct {
+	Data struct {
+		appStoreConnectResource
+		Attributes struct {
+			ResponseBody     string `json:"responseBody"`
+			LastModifiedDate string `json:"lastModifiedDate,omitempty"`
+		} `json:"attributes"`
+		Relationships struct {
+			Review struct {
+				Data appStoreConnectResource `json:"data"`
+			} `json:"review"`
+		} `json:"relationships"`
+	} `json:"data"`
+}
+
+// Reply creates the response to the customer review of the review's store review ID
+// App Store Connect replaces the previous response of the review
+// The date of the reply is the lastModifiedDate, and is now when it is not given back
+func (a *AppStoreConnect) Reply(ctx context.Context, review ReviewModel, text string) (time.Time, error) {
+	token, err := a.token(time.Now())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	payload := appStoreConnectResponse{}
+	payload.Data.Type = "customerReviewResponses"
+	payload.Data.Attributes.ResponseBody = text
+	payload.Data.Relationships.Review.Data = appStoreConnectResource{Type: "customerReviews", ID: review.ExternalID}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	url := strings.TrimSuffix(a.BaseURL, "/") + "/v1/customerReviewResponses"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return time.Time{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Transport: a.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("[error] App Store Connect responded with %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	result := appStoreConnectResponse{}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return time.Time{}, err
+	}
+	respondedAt, err := time.Parse(time.RFC3339, result.Data.Attributes.LastModifiedDate)
+	if err != nil {
+		return time.Now(), nil
+	}
+	return respondedAt, nil
+}
+
+// token returns the JWT for the App Store Connect API, signed with the private key
+func (a *AppStoreConnect) token(now time.Time) (string, error) {
+	claims := map[string]interface{}{
+		"iss": a.IssuerID,
+		"iat": now.Unix(),
+		"exp": now.Add(appStoreConnectTokenTTL).Unix(),
+		"aud": appStoreConnectAudience,
+	}
+	return signJWT(a.PrivateKey, a.KeyID, claims)
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// GooglePlayBaseURL is the base URL of the Google Play Developer API
+	GooglePlayBaseURL = "https://androidpublisher.googleapis.com"
+
+	// googlePlayScope is the OAuth scope of the Google Play Developer API
+	googlePlayScope = "https://www.googleapis.com/auth/androidpublisher"
+	// googlePlayTokenURI is the OAuth token endpoint, when the service account doesn't have one
+	googlePlayTokenURI = "https://oauth2.googleapis.com/token"
+	// googlePlayTokenTTL is how long the JWT assertion is valid, Google allows up to an hour
+	googlePlayTokenTTL = time.Hour
+)
+
+// googleServiceAccount is the .json key file of a Google Cloud service account
+type googleServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// GooglePlayDeveloper replies to the Play Store reviews with the Google Play Developer reviews.reply API
+// The service account must be invited to the Play Console with the permission to reply to reviews
+// https://developers.google.com/android-publisher/api-ref/rest/v3/reviews/reply
+type GooglePlayDeveloper struct {
+	// BaseURL is the Google Play Developer API, see @GooglePlayBaseURL
+	BaseURL string
+	// PackageName is the app the reviews are of, eg. com.king.candycrushsaga
+	PackageName string
+	// ClientEmail and TokenURI are of the service account
+	ClientEmail string
+	TokenURI    string
+	// PrivateKey is the key of the service account, signs the JWT with RS256
+	PrivateKey *rsa.PrivateKey
+	// Transport is the http transport used to call the API and the token endpoint
+	// When nil, http.DefaultTransport is used
+	Transport http.RoundTripper
+}
+
+// NewGooglePlayDeveloper creates a new GooglePlayDeveloper for the app of packageName
+// serviceAccountJSON is the content of the service account's .json key file
+func NewGooglePlayDeveloper(packageName string, serviceAccountJSON []byte) (*GooglePlayDeveloper, error) {
+	account := googleServiceAccount{}
+	if err := json.Unmarshal(serviceAccountJSON, &account); err != nil {
+		return nil, fmt.Errorf("[error] unable to parse the Google Play service account: %w", err)
+	}
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("[error] unable to decode the Google Play service account private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("[error] unable to parse the Google Play service account private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("[error] Google Play service account private key is not an RSA key")
+	}
+	tokenURI := account.TokenURI
+	if tokenURI == "" {
+		tokenURI = googlePlayTokenURI
+	}
+	return &GooglePlayDeveloper{
+		BaseURL:     GooglePlayBaseURL,
+		PackageName: packageName,
+		ClientEmail: account.ClientEmail,
+		TokenURI:    tokenURI,
+		PrivateKey:  rsaKey,
+	}, nil
+}
+
+// Store returns the store name for Android
+func (g *GooglePlayDeveloper) Store() string {
+	return StoreAndroid
+}
+
+// googlePlayReplyResponse is the response body of reviews.reply
+type googlePlayReplyResponse struct {
+	Result struct {
+		ReplyText  string `json:"replyText"`
+		LastEdited struct {
+			Seconds string `json:"seconds"`
+		} `json:"lastEdited"`
+	} `json:"result"`
+}
+
+// Reply replies to the review of the review's store review ID
+// Google Play replaces the previous reply of the review
+// The date of the reply is the lastEdited, and is now when it is not given back
+func (g *GooglePlayDeveloper) Reply(ctx context.Context, review ReviewModel, text string) (time.Time, error) {
+	if g.PackageName == "" {
+		return time.Time{}, fmt.Errorf("[error] Google Play package name is empty")
+	}
+	accessToken, err := g.accessToken(ctx, time.Now())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	body, err := json.Marshal(map[string]string{"replyText": text})
+	if err != nil {
+		return time.Time{}, err
+	}
+	endpoint := fmt.Sprintf("%s/androidpublisher/v3/applications/%s/reviews/%s:reply",
+		strings.TrimSuffix(g.BaseURL, "/"),
+		url.PathEscape(g.PackageName),
+		url.PathEscape(review.ExternalID),
+	)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return time.Time{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	respBody, err := g.do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	result := googlePlayReplyResponse{}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return time.Time{}, err
+	}
+	// int64 are strings in the Google APIs
+	seconds, err := strconv.ParseInt(result.Result.LastEdited.Seconds, 10, 64)
+	if err != nil || seconds == 0 {
+		return time.Now(), nil
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// accessToken exchanges the JWT assertion signed with the service account's key for an OAuth access token
+func (g *GooglePlayDeveloper) accessToken(ctx context.Context, now time.Time) (string, error) {
+	claims := map[string]interface{}{
+		"iss":   g.ClientEmail,
+		"scope": googlePlayScope,
+		"aud":   g.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(googlePlayTokenTTL).Unix(),
+	}
+	assertion, err := signJWT(g.PrivateKey, "", claims)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	respBody, err := g.do(req)
+	if err != nil {
+		return "", err
+	}
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.Unmarshal(respBody, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("[error] Google OAuth responded without an access token")
+	}
+	return token.AccessToken, nil
+}
+
+// do sends the request and returns the response body, or an error when the response is not 200
+func (g *GooglePlayDeveloper) do(req *http.Request) ([]byte, error) {
+	client := &http.Client{Transport: g.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("[error] %s responded with %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// jwtClaims verifies the signature of the JWT and returns its header and claims
+// nil is returned when the signature doesn't match the key
+func jwtClaims(t *testing.T, token string, key crypto.PublicKey) (map[string]interface{}, map[string]interface{}) {
+	parts := strings.Split(token, ".")
+	if !assert.Equal(t, 3, len(parts)) {
+		return nil, nil
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	assert.Nil(t, err)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 || !ecdsa.Verify(k, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+			return nil, nil
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) != nil {
+			return nil, nil
+		}
+	}
+
+	header := map[string]interface{}{}
+	claims := map[string]interface{}{}
+	for i, v := range []map[string]interface{}{header, claims} {
+		b, err := base64.RawURLEncoding.DecodeString(parts[i])
+		assert.Nil(t, err)
+		assert.Nil(t, json.Unmarshal(b, &v))
+	}
+	return header, claims
+}
+
+// pkcs8PEM returns the key as it is in the .p8 file and the service account
+func pkcs8PEM(t *testing.T, key crypto.Signer) []byte {
+	b, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b})
+}
+
+func TestAppStoreConnectReply(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v1/customerReviewResponses", r.URL.Path)
+
+		header, claims := jwtClaims(t, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), &key.PublicKey)
+		if header == nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "ES256", header["alg"])
+		assert.Equal(t, "KEY123", header["kid"])
+		assert.Equal(t, "issuer-1", claims["iss"])
+		assert.Equal(t, "appstoreconnect-v1", claims["aud"])
+
+		payload := appStoreConnectResponse{}
+		body, _ := io.ReadAll(r.Body)
+		assert.Nil(t, json.Unmarshal(body, &payload))
+		assert.Equal(t, "customerReviewResponses", payload.Data.Type)
+		assert.Equal(t, "customerReviews", payload.Data.Relationships.Review.Data.Type)
+		if payload.Data.Relationships.Review.Data.ID != "10643476458" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[{"status":"404","code":"NOT_FOUND"}]}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"data":{"type":"customerReviewResponses","id":"resp-1","attributes":{"responseBody":"` +
+			payload.Data.Attributes.ResponseBody + `","lastModifiedDate":"2024-01-02T03:04:05Z","state":"PENDING_PUBLISH"}}}`))
+	}))
+	defer server.Close()
+
+	a, err := NewAppStoreConnect("issuer-1", "KEY123", pkcs8PEM(t, key))
+	assert.Nil(t, err)
+	assert.Equal(t, AppStoreConnectBaseURL, a.BaseURL)
+	assert.Equal(t, StoreIOS, a.Store())
+	a.BaseURL = server.URL
+
+	respondedAt, err := a.Reply(context.Background(), ReviewModel{ExternalID: "10643476458"}, "Thanks!")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), respondedAt.UTC())
+	assert.Equal(t, 1, requests)
+
+	_, err = a.Reply(context.Background(), ReviewModel{ExternalID: "1"}, "Thanks!")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "NOT_FOUND")
+
+	// signed with another key
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	a.PrivateKey = other
+	_, err = a.Reply(context.Background(), ReviewModel{ExternalID: "10643476458"}, "Thanks!")
+	assert.NotNil(t, err)
+
+	// not a .p8 key
+	_, err = NewAppStoreConnect("issuer-1", "KEY123", []byte("not a key"))
+	assert.NotNil(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	_, err = NewAppStoreConnect("issuer-1", "KEY123", pkcs8PEM(t, rsaKey))
+	assert.NotNil(t, err)
+}
+
+func TestGooglePlayDeveloperReply(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		switch r.URL.Path {
+		case "/token":
+			assert.Nil(t, r.ParseForm())
+			assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.PostForm.Get("grant_type"))
+			header, claims := jwtClaims(t, r.PostForm.Get("assertion"), &key.PublicKey)
+			if header == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+			assert.Equal(t, "RS256", header["alg"])
+			assert.Equal(t, "replier@project.iam.gserviceaccount.com", claims["iss"])
+			assert.Equal(t, "https://www.googleapis.com/auth/androidpublisher", claims["scope"])
+			assert.Equal(t, server.URL+"/token", claims["aud"])
+			_, _ = w.Write([]byte(`{"access_token":"token-1","expires_in":3599,"token_type":"Bearer"}`))
+		case "/androidpublisher/v3/applications/com.king.candycrushsaga/reviews/gp:AOqpTOE2:reply":
+			assert.Equal(t, "Bearer token-1", r.Header.Get("Authorization"))
+			payload := map[string]string{}
+			body, _ := io.ReadAll(r.Body)
+			assert.Nil(t, json.Unmarshal(body, &payload))
+			_, _ = w.Write([]byte(`{"result":{"replyText":"` + payload["replyText"] + `","lastEdited":{"seconds":"1704164645","nanos":0}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	account, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "replier@project.iam.gserviceaccount.com",
+		"private_key":  string(pkcs8PEM(t, key)),
+		"token_uri":    server.URL + "/token",
+	})
+	assert.Nil(t, err)
+	g, err := NewGooglePlayDeveloper("com.king.candycrushsaga", account)
+	assert.Nil(t, err)
+	assert.Equal(t, GooglePlayBaseURL, g.BaseURL)
+	assert.Equal(t, StoreAndroid, g.Store())
+	g.BaseURL = server.URL
+
+	respondedAt, err := g.Reply(context.Background(), ReviewModel{ExternalID: "gp:AOqpTOE2"}, "Sorry, fixed!")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Unix(1704164645, 0), respondedAt)
+
+	_, err = g.Reply(context.Background(), ReviewModel{ExternalID: "gp:unknown"}, "Sorry, fixed!")
+	assert.NotNil(t, err)
+
+	// signed with another key
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	g.PrivateKey = other
+	_, err = g.Reply(context.Background(), ReviewModel{ExternalID: "gp:AOqpTOE2"}, "Sorry, fixed!")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid_grant")
+
+	_, err = NewGooglePlayDeveloper("com.king.candycrushsaga", []byte(`{"private_key":"not a key"}`))
+	assert.NotNil(t, err)
+}
+
+// fakeReplier replies to every review with the same date
+type fakeReplier struct {
+	store   string
+	replies []string
+}
+
+func (f *fakeReplier) Store() string {
+	return f.store
+}
+
+func (f *fakeReplier) Reply(_ context.Context, review ReviewModel, text string) (time.Time, error) {
+	f.replies = append(f.replies, review.ExternalID+": "+text)
+	return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), nil
+}
+
+func TestResponderReply(t *testing.T) {
+	repo := NewReviewsRepository()
+	now := time.Now()
+	reviews := Reviews{
+		AppName: "app-reply",
+		Store:   "fake-reply",
+		Items: []Review{
+			{ExternalID: "1", Username: "username", Title: "title", Body: "body", Rating: 1, RatedAt: now},
+			{Username: "no id", Title: "title", Body: "body", Rating: 1, RatedAt: now},
+		},
+	}
+	newReviews, _, err := repo.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(newReviews))
+
+	replier := &fakeReplier{store: "fake-reply"}
+	r := NewResponder(replier)
+
+	response, err := r.Reply(context.Background(), newReviews[0].ID, "Thanks for the review")
+	assert.Nil(t, err)
+	assert.Equal(t, newReviews[0].ID, response.ReviewID)
+	assert.Equal(t, "Thanks for the review", response.Body)
+	assert.Equal(t, []string{"1: Thanks for the review"}, replier.replies)
+
+	// reply is recorded locally, so the review is no longer unanswered
+	saved, found, err := repo.FindDeveloperResponse(newReviews[0].ID)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "Thanks for the review", saved.Body)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), saved.RespondedAt.UTC())
+	unanswered, err := repo.FindUnansweredReviews("app-reply", "", 2, now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(unanswered))
+
+	// reply again replaces the previous reply
+	_, err = r.Reply(context.Background(), newReviews[0].ID, "Fixed in the next version")
+	assert.Nil(t, err)
+	saved, _, err = repo.FindDeveloperResponse(newReviews[0].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Fixed in the next version", saved.Body)
+
+	// review without the store's review ID
+	_, err = r.Reply(context.Background(), newReviews[1].ID, "Thanks")
+	assert.NotNil(t, err)
+	// no such review
+	_, err = r.Reply(context.Background(), 0, "Thanks")
+	assert.NotNil(t, err)
+	// empty reply
+	_, err = r.Reply(context.Background(), newReviews[0].ID, " ")
+	assert.NotNil(t, err)
+	// no replier for the store
+	_, err = NewResponder().Reply(context.Background(), newReviews[0].ID, "Thanks")
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, len(replier.replies))
+}
@@ -9,23 +9,65 @@ import (
 // This is the data that is stored in the database
 // This is the data that is returned from the scraper
 // AppName and Store are set by cli args
-// The arrays example: Ratings, Usernames, Titles, Body, Datetimes have items in the same order for reviews
-// Non array fields are used to set the overall ratings such as Total, Rating1Percentage, Rating2Percentage..
+// Items are the written reviews, one per review card on the page
+// The embedded ReviewsSummary is the overall ratings such as Total, Rating1Percentage, Rating2Percentage..
 type Reviews struct {
 	AppName string
 	Store   string
 
-	// Ratings is an array of ratings for all the written reviews on the page
-	Ratings []int
-	// Usernames is an array of username for all the written reviews on the page
-	Usernames []string
-	// Titles is an array of titles for all the written reviews on the page
-	Titles []string
-	// Datetimes is an array of datetimes for all the written reviews on the page
-	Datetimes []time.Time
-	// Bodies is an array of bodies for all the written reviews on the page
-	Bodies []string
+	// Items are all the written reviews on the page
+	Items []Review
 
+	ReviewsSummary
+}
+
+// Review is a single written review as scraped from one review card
+// ExternalID, AppVersion, VoteSum, VoteCount and the developer response are optional
+// and are empty when the store doesn't provide them
+type Review struct {
+	// ExternalID is the store's own review ID
+	ExternalID string
+	Username   string
+	Title      string
+	Body       string
+	Rating     int
+	RatedAt    time.Time
+
+	// AppVersion is the app version that was reviewed
+	AppVersion string
+	// VoteSum is the number of users who found the review helpful
+	VoteSum int
+	// VoteCount is the number of users who voted on the review
+	VoteCount int
+
+	// Country and Language are of the reviews page that the review was scraped from, see @Utils.GetLocale
+	// Country is empty for the Play Store URLs without gl, and Language for the App Store
+	Country  string
+	Language string
+
+	// Response is the developer's reply to the review, shown under the review
+	Response string
+	// RespondedAt is the date of the developer's reply
+	RespondedAt time.Time
+}
+
+// Verify checks if all the required items of the review were scraped
+// A review that fails is dropped by the scraper, without affecting the other reviews
+func (r Review) Verify() error {
+	if r.Username == "" {
+		return fmt.Errorf("[error] review is missing the username")
+	}
+	if r.Rating < 1 || r.Rating > 5 {
+		return fmt.Errorf("[error] review has an invalid rating %d", r.Rating)
+	}
+	if r.RatedAt.IsZero() {
+		return fmt.Errorf("[error] review is missing the datetime")
+	}
+	return nil
+}
+
+// ReviewsSummary is the overall ratings of the app
+type ReviewsSummary struct {
 	// Total is the total number of reviews
 	// In case of apple it is displayed as 2.5 M reviews or 200 reviews
 	// This is also subjected to locale, eg. in Japanese it is 2.5万
@@ -41,13 +83,10 @@ type Reviews struct {
 	Rating5Percentage int
 }
 
-// VerifyReviews checks if the reviews surfed for all items equally
+// VerifyReviews checks if the overall ratings were surfed along with the reviews
 func VerifyReviews(reviews *Reviews) error {
 	// check if reviews were success but total and percentages are not set
-	if len(reviews.Usernames) != 0 ||
-		len(reviews.Titles) != 0 ||
-		len(reviews.Datetimes) != 0 ||
-		len(reviews.Ratings) != 0 {
+	if len(reviews.Items) != 0 {
 		//but overall is not set
 		if reviews.Total == 0 ||
 			(reviews.Rating1Percentage+
@@ -58,12 +97,11 @@ func VerifyReviews(reviews *Reviews) error {
 			return fmt.Errorf("[error] fetched counts do not match up. Ratings or Total counts are missing")
 		}
 	}
-	// check if all data was fetched successfully
-	if len(reviews.Usernames) != len(reviews.Bodies) ||
-		len(reviews.Usernames) != len(reviews.Titles) ||
-		len(reviews.Usernames) != len(reviews.Datetimes) ||
-		len(reviews.Usernames) != len(reviews.Ratings) {
-		return fmt.Errorf("[error] fetched counts do not match up. All counts must be equal")
+	// check if all reviews were fetched successfully
+	for _, review := range reviews.Items {
+		if err := review.Verify(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -71,9 +109,14 @@ func VerifyReviews(reviews *Reviews) error {
 type ReviewModel struct {
 	ID int `json:"id" gorm:"column:id;primary_key;AUTO_INCREMENT"`
 	// AppName is not fetched by scraper but from cli args by the user
-	AppName string `json:"app_name" gorm:"column:app_name;type:varchar(64); NOT NULL"`
+	AppName string `json:"app_name" gorm:"column:app_name;type:varchar(64); NOT NULL;uniqueIndex:idx_reviews_app_store_external_id,priority:1"`
 	// Store is not fetched or judged from the URL or by scraper but from cli args by the user
-	Store string `json:"store" gorm:"column:store;type:varchar(16); NOT NULL"`
+	Store string `json:"store" gorm:"column:store;type:varchar(16); NOT NULL;uniqueIndex:idx_reviews_app_store_external_id,priority:2"`
+
+	// ExternalID is the store's own review ID, unique per app and store
+	// Reviews scraped without an ID get a hash of username and rated_at, see @ReviewExternalID
+	// Rows from before the ID was stored are backfilled as legacy-{id}, see @migrateExternalIDs
+	ExternalID string `json:"external_id" gorm:"column:external_id;type:varchar(191);NOT NULL;default:'';uniqueIndex:idx_reviews_app_store_external_id,priority:3"`
 
 	// Following items are fetched by scraper
 	Username string     `json:"username" gorm:"column:username;type:string; NOT NULL"`
@@ -81,6 +124,49 @@ type ReviewModel struct {
 	Body     string     `json:"body" gorm:"column:body;type:string; NOT NULL"`
 	Rating   int        `json:"rating" gorm:"column:rating;type:tinyint(1); NOT NULL"`
 	RatedAt  *time.Time `json:"rated_at" gorm:"type:timestamp; NOT NULL"`
+	// Country and Language are of the reviews page it was first scraped from
+	// empty for the reviews scraped before they were stored
+	Country  string `json:"country" gorm:"column:country;type:varchar(8);NOT NULL;default:''"`
+	Language string `json:"language" gorm:"column:language;type:varchar(16);NOT NULL;default:''"`
+
+	// Basic timestamps
+	CreatedAt *time.Time `json:"created_at,omitempty" gorm:"type:timestamp null"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty" gorm:"type:timestamp null"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"type:timestamp null"`
+}
+
+// ReviewRevisionModel is a previous version of a review that was edited by the user
+// The review row always has the latest version, and a revision is added for every edit
+type ReviewRevisionModel struct {
+	ID int `json:"id" gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	// ReviewID is the id of the edited review in the reviews table
+	ReviewID int `json:"review_id" gorm:"column:review_id;type:integer; NOT NULL;index:idx_review_revisions_review_id"`
+
+	// Following items are the review before the edit
+	Title   string     `json:"title" gorm:"column:title;type:string; NOT NULL"`
+	Body    string     `json:"body" gorm:"column:body;type:string; NOT NULL"`
+	Rating  int        `json:"rating" gorm:"column:rating;type:tinyint(1); NOT NULL"`
+	RatedAt *time.Time `json:"rated_at" gorm:"type:timestamp; NOT NULL"`
+
+	// RevisedAt is when the edit was scraped, which is when this version was replaced
+	RevisedAt *time.Time `json:"revised_at" gorm:"type:timestamp; NOT NULL"`
+
+	// Basic timestamps
+	CreatedAt *time.Time `json:"created_at,omitempty" gorm:"type:timestamp null"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty" gorm:"type:timestamp null"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"type:timestamp null"`
+}
+
+// DeveloperResponseModel is the developer's reply to a review, one per review
+// The reply is updated when the developer edits it
+type DeveloperResponseModel struct {
+	ID int `json:"id" gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	// ReviewID is the id of the replied review in the reviews table
+	ReviewID int `json:"review_id" gorm:"column:review_id;type:integer; NOT NULL;uniqueIndex:idx_developer_responses_review_id"`
+
+	// Following items are fetched by scraper
+	Body        string     `json:"body" gorm:"column:body;type:string; NOT NULL"`
+	RespondedAt *time.Time `json:"responded_at" gorm:"type:timestamp null"`
 
 	// Basic timestamps
 	CreatedAt *time.Time `json:"created_at,omitempty" gorm:"type:timestamp null"`
@@ -88,12 +174,62 @@ type ReviewModel struct {
 	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"type:timestamp null"`
 }
 
+// ReviewEdit is a review that was edited by the user since it was last scraped
+// Review is the updated review and Revision is the version before the edit
+type ReviewEdit struct {
+	Review   ReviewModel
+	Revision ReviewRevisionModel
+}
+
 func (ReviewModel) TableName() string {
 	return "reviews"
 }
+func (ReviewRevisionModel) TableName() string {
+	return "review_revisions"
+}
+func (DeveloperResponseModel) TableName() string {
+	return "developer_responses"
+}
 func (ReviewCountsModel) TableName() string {
 	return "review_counts"
 }
+func (WebhookDeliveryModel) TableName() string {
+	return "webhook_deliveries"
+}
+func (NotificationModel) TableName() string {
+	return "notifications"
+}
+
+// Status of a WebhookDeliveryModel
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookDeliveryModel is a payload sent to a webhook, see @WebhookNotifier
+// The payload and its signature are kept as sent, so that a failed delivery can be replayed as it was
+type WebhookDeliveryModel struct {
+	ID int `json:"id" gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	// DeliveryID is sent in the header, the same on replays so the receiver can skip duplicates
+	DeliveryID string `json:"delivery_id" gorm:"column:delivery_id;type:varchar(64); NOT NULL;uniqueIndex:idx_webhook_deliveries_delivery_id"`
+	URL        string `json:"url" gorm:"column:url;type:string; NOT NULL"`
+	Event      string `json:"event" gorm:"column:event;type:varchar(32); NOT NULL"`
+	Payload    string `json:"payload" gorm:"column:payload;type:text; NOT NULL"`
+	Signature  string `json:"signature" gorm:"column:signature;type:varchar(128); NOT NULL"`
+
+	// Following items are of the attempts to deliver
+	Status         string     `json:"status" gorm:"column:status;type:varchar(16); NOT NULL;index:idx_webhook_deliveries_status"`
+	Attempts       int        `json:"attempts" gorm:"column:attempts;type:integer; NOT NULL"`
+	LastStatusCode int        `json:"last_status_code" gorm:"column:last_status_code;type:integer; NOT NULL"`
+	LastError      string     `json:"last_error" gorm:"column:last_error;type:text"`
+	DeliveredAt    *time.Time `json:"delivered_at" gorm:"type:timestamp null"`
+
+	// Basic timestamps
+	CreatedAt *time.Time `json:"created_at,omitempty" gorm:"type:timestamp null"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty" gorm:"type:timestamp null"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"type:timestamp null"`
+}
 
 type ReviewCountsModel struct {
 	ID int `json:"id" gorm:"column:id;primary_key;AUTO_INCREMENT"`
@@ -115,3 +251,29 @@ type ReviewCountsModel struct {
 	UpdatedAt *time.Time `json:"updated_at,omitempty" gorm:"type:timestamp null"`
 	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"type:timestamp null"`
 }
+
+// Events of a NotificationModel
+const (
+	NotificationNewReview     = "new_review"
+	NotificationUpdatedReview = "updated_review"
+)
+
+// NotificationModel is a review or its edit that was delivered on a channel, see @Notify
+// so that it is delivered once on every channel, even when the run failed halfway
+type NotificationModel struct {
+	ID      int    `json:"id" gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	AppName string `json:"app_name" gorm:"column:app_name;type:varchar(64); NOT NULL"`
+	Store   string `json:"store" gorm:"column:store;type:varchar(16); NOT NULL"`
+	Channel string `json:"channel" gorm:"column:channel;type:varchar(32); NOT NULL;uniqueIndex:idx_notifications_delivery,priority:1"`
+	Event   string `json:"event" gorm:"column:event;type:varchar(32); NOT NULL;uniqueIndex:idx_notifications_delivery,priority:2"`
+	// ReviewID is the id of the review in the reviews table
+	ReviewID int `json:"review_id" gorm:"column:review_id;type:integer; NOT NULL;uniqueIndex:idx_notifications_delivery,priority:3"`
+	// RevisionID is the id of the revision of the edit, 0 for a new review
+	RevisionID  int        `json:"revision_id" gorm:"column:revision_id;type:integer; NOT NULL;default:0;uniqueIndex:idx_notifications_delivery,priority:4"`
+	DeliveredAt *time.Time `json:"delivered_at" gorm:"type:timestamp; NOT NULL"`
+
+	// Basic timestamps
+	CreatedAt *time.Time `json:"created_at,omitempty" gorm:"type:timestamp null"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty" gorm:"type:timestamp null"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"type:timestamp null"`
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/kevincobain2000/go-app-reviews-scraper/app"
@@ -21,45 +22,519 @@ func NewReviewsRepository() *ReviewsRepository {
 	}
 }
 
-// FindOrNewReviews finds the review count or creates a new one
-// looks for existing review by store, app name, username with it's rating date
+// FindOrNewReviews finds the reviews or creates the new ones
+// looks for existing review by store, app name and the store's review ID, see @findReview
+// or by username when the review without the store's review ID was edited, see @findEditedHashReview
+// A found review with a different title, body or rating was edited by the user,
+// it is updated to the scraped version and the previous version is kept, see @updateEditedReview
+// The developer's reply of the new and found reviews is saved, see @SaveDeveloperResponse
+func (r *ReviewsRepository) FindOrNewReviews(reviews Reviews) ([]ReviewModel, []ReviewEdit, error) {
+	uu := NewUtils()
+	newReviews := []ReviewModel{}
+	editedReviews := []ReviewEdit{}
+	for _, item := range reviews.Items {
+		if item.ExternalID == "" {
+			item.ExternalID = uu.ReviewExternalID(item.Username, item.RatedAt)
+		}
+
+		review, found, err := r.findReview(reviews.AppName, reviews.Store, item)
+		if err != nil {
+			return newReviews, editedReviews, err
+		}
+		if found {
+			edit, edited, err := r.updateEditedReview(review, item)
+			if err != nil {
+				return newReviews, editedReviews, err
+			}
+			if edited {
+				editedReviews = append(editedReviews, edit)
+			}
+		} else {
+			review, err = r.insertReview(reviews.AppName, reviews.Store, item)
+			if err != nil {
+				return newReviews, editedReviews, err
+			}
+			newReviews = append(newReviews, review)
+		}
+
+		if item.Response != "" {
+			if _, err := r.SaveDeveloperResponse(review.ID, item.Response, item.RespondedAt); err != nil {
+				return newReviews, editedReviews, err
+			}
+		}
+	}
+
+	return newReviews, editedReviews, nil
+}
+
+// findReview finds the stored review of the scraped item by store, app name and the store's review ID
+// When the store doesn't give review IDs, the ID is a hash of username with it's rating date
 // username and rating_date are scraped from the review page from the review card
-func (r *ReviewsRepository) FindOrNewReviews(reviews Reviews) ([]ReviewModel, error) {
+// A legacy or a hash row of the same username and rating date is the same review, and is given the ID of the item
+// so that it isn't inserted again once the store gives its review ID
+// soft deleted reviews are also found, so they are not inserted again
+// returns false when the review is not found, see @findEditedHashReview for the edits of the hash rows
+func (r *ReviewsRepository) findReview(appName, store string, item Review) (ReviewModel, bool, error) {
 	query := `app_name = ?
+		AND store = ?
+		AND external_id = ?`
+	placeholderQuery := `app_name = ?
 		AND store = ?
 		AND username = ?
 		AND rated_at = ?
+		AND (external_id LIKE ? OR external_id LIKE ?)
 		AND deleted_at IS NULL`
 
-	newReviews := []ReviewModel{}
-	for i := 0; i < len(reviews.Ratings); i++ {
-		var review = ReviewModel{}
-		result := r.db.Where(
-			query,
-			reviews.AppName,
-			reviews.Store,
-			reviews.Usernames[i],
-			reviews.Datetimes[i],
-		).First(&review)
-
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			review, err := r.insertReview(
-				reviews.AppName,
-				reviews.Store,
-				reviews.Usernames[i],
-				reviews.Titles[i],
-				reviews.Bodies[i],
-				reviews.Ratings[i],
-				reviews.Datetimes[i],
-			)
-			if err != nil {
-				return newReviews, err
-			}
-			newReviews = append(newReviews, review)
+	var review = ReviewModel{}
+	result := r.db.Where(
+		query,
+		appName,
+		store,
+		item.ExternalID,
+	).First(&review)
+	if result.Error == nil {
+		return review, true, nil
+	}
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return review, false, result.Error
+	}
+
+	result = r.db.Where(
+		placeholderQuery,
+		appName,
+		store,
+		item.Username,
+		item.RatedAt,
+		legacyExternalIDPrefix+"%",
+		hashExternalIDPrefix+"%",
+	).First(&review)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		if !strings.HasPrefix(item.ExternalID, hashExternalIDPrefix) {
+			return review, false, nil
+		}
+		edited, found, err := r.findEditedHashReview(appName, store, item)
+		if !found || err != nil {
+			return edited, false, err
+		}
+		review = edited
+	} else if result.Error != nil {
+		return review, false, result.Error
+	}
+	// the column only, as changing the ID isn't an edit of the review
+	result = r.db.Model(&review).UpdateColumn("external_id", item.ExternalID)
+	if result.Error != nil {
+		return review, false, result.Error
+	}
+	review.ExternalID = item.ExternalID
+	return review, true, nil
+}
+
+// findEditedHashReview finds the hash row of the item by username, as the hash changes with the rating date when the user edits the review
+// The latest review of the username rated before the item is the one that was edited, see @updateEditedReview
+// returns false when the username has no earlier review
+func (r *ReviewsRepository) findEditedHashReview(appName, store string, item Review) (ReviewModel, bool, error) {
+	query := `app_name = ?
+		AND store = ?
+		AND username = ?
+		AND rated_at < ?
+		AND external_id LIKE ?
+		AND deleted_at IS NULL`
+
+	var review = ReviewModel{}
+	result := r.db.Where(
+		query,
+		appName,
+		store,
+		item.Username,
+		item.RatedAt,
+		hashExternalIDPrefix+"%",
+	).Order("rated_at DESC").Take(&review)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return review, false, nil
+	}
+	return review, result.Error == nil, result.Error
+}
+
+// updateEditedReview updates the review when the scraped item has a different title, body or rating
+// The version before the edit is inserted to review_revisions in the same transaction
+// Soft deleted reviews and changes to only the rating date are not edits, as the stores reformat the dates
+// returns false when the review was not edited
+func (r *ReviewsRepository) updateEditedReview(review ReviewModel, item Review) (ReviewEdit, bool, error) {
+	edit := ReviewEdit{}
+	if review.DeletedAt != nil {
+		return edit, false, nil
+	}
+	if review.Title == item.Title && review.Body == item.Body && review.Rating == item.Rating {
+		return edit, false, nil
+	}
+
+	now := time.Now()
+	ratedAt := item.RatedAt
+	revision := ReviewRevisionModel{
+		ReviewID:  review.ID,
+		Title:     review.Title,
+		Body:      review.Body,
+		Rating:    review.Rating,
+		RatedAt:   review.RatedAt,
+		RevisedAt: &now,
+		CreatedAt: &now,
+		UpdatedAt: &now,
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+		return tx.Model(&review).Updates(map[string]interface{}{
+			"title":      item.Title,
+			"body":       item.Body,
+			"rating":     item.Rating,
+			"rated_at":   &ratedAt,
+			"updated_at": &now,
+		}).Error
+	})
+	if err != nil {
+		return edit, false, err
+	}
+	review.Title = item.Title
+	review.Body = item.Body
+	review.Rating = item.Rating
+	review.RatedAt = &ratedAt
+	review.UpdatedAt = &now
+
+	edit.Review = review
+	edit.Revision = revision
+	return edit, true, nil
+}
+
+// SaveDeveloperResponse inserts the developer's reply to the review
+// or updates it when the developer edited the reply
+// respondedAt is optional and is saved as NULL when zero
+// A reply that is no longer scraped is kept as it is, as the stores don't always show the replies
+func (r *ReviewsRepository) SaveDeveloperResponse(reviewID int, body string, respondedAt time.Time) (DeveloperResponseModel, error) {
+	now := time.Now()
+	var respondedAtPtr *time.Time
+	if !respondedAt.IsZero() {
+		respondedAtPtr = &respondedAt
+	}
+
+	var response = DeveloperResponseModel{}
+	result := r.db.Where("review_id = ?", reviewID).First(&response)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		response = DeveloperResponseModel{
+			ReviewID:    reviewID,
+			Body:        body,
+			RespondedAt: respondedAtPtr,
+			CreatedAt:   &now,
+			UpdatedAt:   &now,
+		}
+		result = r.db.Create(&response)
+		return response, result.Error
+	}
+	if result.Error != nil {
+		return response, result.Error
+	}
+	if response.Body == body {
+		return response, nil
+	}
+	result = r.db.Model(&response).Updates(map[string]interface{}{
+		"body":         body,
+		"responded_at": respondedAtPtr,
+		"updated_at":   &now,
+	})
+	response.Body = body
+	response.RespondedAt = respondedAtPtr
+	response.UpdatedAt = &now
+	return response, result.Error
+}
+
+// FindReview finds the review by its id
+func (r *ReviewsRepository) FindReview(id int) (ReviewModel, error) {
+	var review = ReviewModel{}
+	query := `id = ?
+		AND deleted_at IS NULL`
+	result := r.db.Where(query, id).First(&review)
+	return review, result.Error
+}
+
+// FindDeveloperResponse finds the developer's reply to the review
+// returns false when the review has no reply
+func (r *ReviewsRepository) FindDeveloperResponse(reviewID int) (DeveloperResponseModel, bool, error) {
+	var response = DeveloperResponseModel{}
+	query := `review_id = ?
+		AND deleted_at IS NULL`
+	result := r.db.Where(query, reviewID).First(&response)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return response, false, nil
+	}
+	return response, result.Error == nil, result.Error
+}
+
+// FindUnansweredReviews finds the reviews without a developer reply
+// that are rated maxRating or below, and were rated before olderThan, oldest first
+// appName and store are optional and all the apps and stores are looked up when empty
+func (r *ReviewsRepository) FindUnansweredReviews(appName, store string, maxRating int, olderThan time.Time) ([]ReviewModel, error) {
+	reviews := []ReviewModel{}
+	tx := r.db.Model(&ReviewModel{}).
+		Joins("LEFT JOIN developer_responses ON developer_responses.review_id = reviews.id AND developer_responses.deleted_at IS NULL").
+		Where(`developer_responses.id IS NULL
+			AND reviews.rating <= ?
+			AND reviews.rated_at < ?
+			AND reviews.deleted_at IS NULL`, maxRating, olderThan)
+	if appName != "" {
+		tx = tx.Where("reviews.app_name = ?", appName)
+	}
+	if store != "" {
+		tx = tx.Where("reviews.store = ?", store)
+	}
+	result := tx.Order("reviews.rated_at ASC").Find(&reviews)
+	return reviews, result.Error
+}
+
+// FindReviews finds the reviews of the app that were rated since the time, newest first
+// appName and store are optional and all the apps and stores are looked up when empty
+func (r *ReviewsRepository) FindReviews(appName, store string, since time.Time) ([]ReviewModel, error) {
+	reviews := []ReviewModel{}
+	tx := r.db.Where("rated_at >= ? AND deleted_at IS NULL", since)
+	if appName != "" {
+		tx = tx.Where("app_name = ?", appName)
+	}
+	if store != "" {
+		tx = tx.Where("store = ?", store)
+	}
+	result := tx.Order("rated_at DESC").Find(&reviews)
+	return reviews, result.Error
+}
+
+// FindNewReviews finds the new reviews of the app on the store since the time, oldest first
+// that is the reviews first scraped since then and rated within the lookback before they were scraped, see @IsNewReview
+func (r *ReviewsRepository) FindNewReviews(appName, store string, since time.Time, lookback time.Duration) ([]ReviewModel, error) {
+	reviews := []ReviewModel{}
+	// rated_at is filtered by the earliest it can be, and then by when each review was scraped
+	query := `app_name = ?
+		AND store = ?
+		AND created_at >= ?
+		AND rated_at >= ?
+		AND deleted_at IS NULL`
+	result := r.db.Where(query, appName, store, since, since.Add(-lookback)).Order("created_at ASC").Order("id ASC").Find(&reviews)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	found := []ReviewModel{}
+	for _, review := range reviews {
+		if IsNewReview(review, since, lookback) {
+			found = append(found, review)
+		}
+	}
+	return found, nil
+}
+
+// ReviewsQuery filters the stored reviews, the empty fields don't filter, see @SearchReviews
+type ReviewsQuery struct {
+	AppName string
+	Store   string
+	// MinRating and MaxRating are inclusive, 0 is any
+	MinRating int
+	MaxRating int
+	// From is inclusive and To exclusive, of the rated_at
+	From time.Time
+	To   time.Time
+	// Text is searched in the title and the body, case insensitive
+	Text string
+	// Page starts at 1, and PerPage is the reviews of a page, 0 is all of them
+	Page    int
+	PerPage int
+}
+
+// SearchReviews finds the page of the reviews of the query, newest first, and the total of all the pages
+func (r *ReviewsRepository) SearchReviews(query ReviewsQuery) ([]ReviewModel, int64, error) {
+	reviews := []ReviewModel{}
+	tx := r.db.Model(&ReviewModel{}).Where("deleted_at IS NULL")
+	if query.AppName != "" {
+		tx = tx.Where("app_name = ?", query.AppName)
+	}
+	if query.Store != "" {
+		tx = tx.Where("store = ?", query.Store)
+	}
+	if query.MinRating > 0 {
+		tx = tx.Where("rating >= ?", query.MinRating)
+	}
+	if query.MaxRating > 0 {
+		tx = tx.Where("rating <= ?", query.MaxRating)
+	}
+	if !query.From.IsZero() {
+		tx = tx.Where("rated_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		tx = tx.Where("rated_at < ?", query.To)
+	}
+	if query.Text != "" {
+		// ! escapes the wildcards of LIKE, the same on sqlite and mysql
+		like := "%" + strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(strings.ToLower(query.Text)) + "%"
+		tx = tx.Where("(LOWER(title) LIKE ? ESCAPE '!' OR LOWER(body) LIKE ? ESCAPE '!')", like, like)
+	}
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return reviews, 0, err
+	}
+	tx = tx.Order("rated_at DESC").Order("id DESC")
+	if query.PerPage > 0 {
+		tx = tx.Offset((max(query.Page, 1) - 1) * query.PerPage).Limit(query.PerPage)
+	}
+	result := tx.Find(&reviews)
+	return reviews, total, result.Error
+}
+
+// FindExportRows finds the next rows of the table of the query after the id, by their id, into rows, see @Exporter.Export
+// rows is a pointer to a slice of the model of the table, eg. *[]ReviewModel
+func (r *ReviewsRepository) FindExportRows(query ExportQuery, afterID, limit int, rows interface{}) error {
+	dateColumn := "rated_at"
+	if query.Table == ExportReviewCounts {
+		dateColumn = "created_at"
+	}
+	tx := r.db.Table(query.Table).Where("id > ?", afterID).Where("deleted_at IS NULL")
+	if len(query.AppNames) > 0 {
+		tx = tx.Where("app_name IN ?", query.AppNames)
+	}
+	if len(query.Stores) > 0 {
+		tx = tx.Where("store IN ?", query.Stores)
+	}
+	if !query.From.IsZero() {
+		tx = tx.Where(dateColumn+" >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		tx = tx.Where(dateColumn+" < ?", query.To)
+	}
+	return tx.Order("id").Limit(limit).Find(rows).Error
+}
+
+// AppSummary is an app on a store that has stored reviews, see @FindApps
+type AppSummary struct {
+	AppName string `json:"app_name"`
+	Store   string `json:"store"`
+	// Reviews are the stored reviews, and LastRatedAt is of the newest of them
+	Reviews     int64      `json:"reviews"`
+	LastRatedAt *time.Time `json:"last_rated_at"`
+	// Total and Average are of the last rating summary, 0 when there is none
+	Total   int     `json:"total"`
+	Average float64 `json:"average"`
+}
+
+// FindApps finds the apps on each store that have stored reviews, by name
+func (r *ReviewsRepository) FindApps() ([]AppSummary, error) {
+	apps := []AppSummary{}
+	result := r.db.Model(&ReviewModel{}).
+		Select("app_name, store, COUNT(*) AS reviews").
+		Where("deleted_at IS NULL").
+		Group("app_name, store").
+		Order("app_name ASC, store ASC").
+		Scan(&apps)
+	if result.Error != nil {
+		return apps, result.Error
+	}
+	for i, a := range apps {
+		last := ReviewModel{}
+		if err := r.db.Where("app_name = ? AND store = ? AND deleted_at IS NULL", a.AppName, a.Store).Order("rated_at DESC").First(&last).Error; err != nil {
+			return apps, err
+		}
+		apps[i].LastRatedAt = last.RatedAt
+		count, err := r.FindReviewCountAt(a.AppName, a.Store, time.Now())
+		if err != nil {
+			return apps, err
+		}
+		apps[i].Total = count.Total
+		apps[i].Average = NewUtils().AverageRating(count)
+	}
+	return apps, nil
+}
+
+// FindReviewCounts finds the rating summaries of the app on the store created between from and to, oldest first
+// from and to are optional, and store is optional and all the stores are looked up when empty
+func (r *ReviewsRepository) FindReviewCounts(appName, store string, from, to time.Time) ([]ReviewCountsModel, error) {
+	counts := []ReviewCountsModel{}
+	tx := r.db.Where("app_name = ? AND deleted_at IS NULL", appName)
+	if store != "" {
+		tx = tx.Where("store = ?", store)
+	}
+	if !from.IsZero() {
+		tx = tx.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		tx = tx.Where("created_at < ?", to)
+	}
+	result := tx.Order("created_at ASC").Order("id ASC").Find(&counts)
+	return counts, result.Error
+}
+
+// reviewEditRow is a revision joined with its review and the next revision, see @FindReviewEdits
+type reviewEditRow struct {
+	ReviewModel `gorm:"embedded"`
+	Revision    ReviewRevisionModel `gorm:"embedded;embeddedPrefix:revision_"`
+	NextID      *int
+	NextTitle   *string
+	NextBody    *string
+	NextRating  *int
+	NextRatedAt *time.Time
+}
+
+// FindReviewEdits finds the edits of the reviews of the app on the store that were scraped since the time, oldest first
+// The review of an edit is as it was after the edit, which is the next revision when it was edited again
+func (r *ReviewsRepository) FindReviewEdits(appName, store string, since time.Time) ([]ReviewEdit, error) {
+	rows := []reviewEditRow{}
+	result := r.db.Table("review_revisions").
+		Select(`reviews.*,
+			review_revisions.id AS revision_id,
+			review_revisions.review_id AS revision_review_id,
+			review_revisions.title AS revision_title,
+			review_revisions.body AS revision_body,
+			review_revisions.rating AS revision_rating,
+			review_revisions.rated_at AS revision_rated_at,
+			review_revisions.revised_at AS revision_revised_at,
+			review_revisions.created_at AS revision_created_at,
+			review_revisions.updated_at AS revision_updated_at,
+			review_revisions.deleted_at AS revision_deleted_at,
+			next.id AS next_id,
+			next.title AS next_title,
+			next.body AS next_body,
+			next.rating AS next_rating,
+			next.rated_at AS next_rated_at`).
+		Joins("JOIN reviews ON reviews.id = review_revisions.review_id").
+		Joins(`LEFT JOIN review_revisions next ON next.id = (
+			SELECT MIN(later.id) FROM review_revisions later
+			WHERE later.review_id = review_revisions.review_id
+				AND later.id > review_revisions.id
+				AND later.deleted_at IS NULL)`).
+		Where(`reviews.app_name = ?
+			AND reviews.store = ?
+			AND review_revisions.revised_at >= ?
+			AND review_revisions.deleted_at IS NULL
+			AND reviews.deleted_at IS NULL`, appName, store, since).
+		Order("review_revisions.id ASC").
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	edits := []ReviewEdit{}
+	for _, row := range rows {
+		review := row.ReviewModel
+		if row.NextID != nil {
+			review.Title = *row.NextTitle
+			review.Body = *row.NextBody
+			review.Rating = *row.NextRating
+			review.RatedAt = row.NextRatedAt
 		}
+		edits = append(edits, ReviewEdit{Review: review, Revision: row.Revision})
 	}
+	return edits, nil
+}
 
-	return newReviews, nil
+// FindReviewRevisions finds the previous versions of the review, oldest first
+func (r *ReviewsRepository) FindReviewRevisions(reviewID int) ([]ReviewRevisionModel, error) {
+	revisions := []ReviewRevisionModel{}
+	query := `review_id = ?
+		AND deleted_at IS NULL`
+	result := r.db.Where(query, reviewID).Order("id ASC").Find(&revisions)
+	return revisions, result.Error
 }
 
 // FindLastReviewCount finds the last review count
@@ -83,6 +558,21 @@ func (r *ReviewsRepository) FindLastReviewCount(reviews Reviews) (ReviewCountsMo
 	return reviewCount, nil
 }
 
+// FindReviewCountAt finds the review count of the app on the store as it was at the time
+// which is the last one created until then, empty when there is none
+func (r *ReviewsRepository) FindReviewCountAt(appName, store string, at time.Time) (ReviewCountsModel, error) {
+	var reviewCount = ReviewCountsModel{}
+	query := `app_name = ?
+		AND store = ?
+		AND created_at <= ?
+		AND deleted_at IS NULL`
+	result := r.db.Where(query, appName, store, at).Order("id DESC").First(&reviewCount)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return reviewCount, nil
+	}
+	return reviewCount, result.Error
+}
+
 // FindOrNewReviewCount finds the review count or creates a new one
 // looks for existing review count by store, app name, with all the ratings and total fetched by scraping
 // if not found a match, it creates a new one
@@ -121,18 +611,22 @@ func (r *ReviewsRepository) FindOrNewReviewCount(reviews Reviews) (ReviewCountsM
 // insertReview inserts a new review
 // that's it
 // DELETED_AT is NULL by default
-func (r *ReviewsRepository) insertReview(appName, store, username, title, body string, rating int, rated_at time.Time) (ReviewModel, error) {
+func (r *ReviewsRepository) insertReview(appName, store string, item Review) (ReviewModel, error) {
 	now := time.Now()
+	ratedAt := item.RatedAt
 	review := ReviewModel{
-		AppName:   appName,
-		Store:     store,
-		Username:  username,
-		Title:     title,
-		Body:      body,
-		Rating:    rating,
-		RatedAt:   &rated_at,
-		CreatedAt: &now,
-		UpdatedAt: &now,
+		AppName:    appName,
+		Store:      store,
+		ExternalID: item.ExternalID,
+		Username:   item.Username,
+		Title:      item.Title,
+		Body:       item.Body,
+		Rating:     item.Rating,
+		RatedAt:    &ratedAt,
+		Country:    item.Country,
+		Language:   item.Language,
+		CreatedAt:  &now,
+		UpdatedAt:  &now,
 	}
 	result := r.db.Create(&review)
 	return review, result.Error
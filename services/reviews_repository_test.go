@@ -1,6 +1,7 @@
 package services
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -17,10 +18,18 @@ func TestInsertReview(t *testing.T) {
 	now := time.Now()
 
 	rating := 5
-	review, err := r.insertReview("app_name", "store", "username", "title", "body", rating, now)
+	review, err := r.insertReview("app_name", "store", Review{
+		ExternalID: "external_id",
+		Username:   "username",
+		Title:      "title",
+		Body:       "body",
+		Rating:     rating,
+		RatedAt:    now,
+	})
 	assert.Nil(t, err)
 	assert.Equal(t, "app_name", review.AppName)
 	assert.Equal(t, "store", review.Store)
+	assert.Equal(t, "external_id", review.ExternalID)
 	assert.Equal(t, "username", review.Username)
 	assert.Equal(t, "title", review.Title)
 	assert.Equal(t, "body", review.Body)
@@ -40,15 +49,15 @@ func TestFindOrNewReviewCount(t *testing.T) {
 
 	now := time.Now()
 	reviews := Reviews{
-		AppName:           "app",
-		Store:             "store",
-		Usernames:         []string{"username"},
-		Titles:            []string{"title"},
-		Bodies:            []string{"body"},
-		Ratings:           []int{1},
-		Datetimes:         []time.Time{now},
-		Rating1Percentage: 10,
-		Rating2Percentage: 0,
+		AppName: "app",
+		Store:   "store",
+		Items: []Review{
+			{Username: "username", Title: "title", Body: "body", Rating: 1, RatedAt: now},
+		},
+		ReviewsSummary: ReviewsSummary{
+			Rating1Percentage: 10,
+			Rating2Percentage: 0,
+		},
 	}
 	ReviewCountsModel, err = r.FindOrNewReviewCount(reviews)
 	assert.Nil(t, err)
@@ -62,15 +71,15 @@ func TestFindLastReviewCount(t *testing.T) {
 	now := time.Now()
 
 	reviews := Reviews{
-		AppName:           "app",
-		Store:             "store",
-		Usernames:         []string{"username"},
-		Titles:            []string{"title"},
-		Bodies:            []string{"body"},
-		Ratings:           []int{1},
-		Datetimes:         []time.Time{now},
-		Rating1Percentage: 20,
-		Rating2Percentage: 0,
+		AppName: "app",
+		Store:   "store",
+		Items: []Review{
+			{Username: "username", Title: "title", Body: "body", Rating: 1, RatedAt: now},
+		},
+		ReviewsSummary: ReviewsSummary{
+			Rating1Percentage: 20,
+			Rating2Percentage: 0,
+		},
 	}
 
 	reviewCount, err := r.FindLastReviewCount(reviews)
@@ -100,23 +109,434 @@ func TestFindOrNewReviews(t *testing.T) {
 	r := NewReviewsRepository()
 	assert.NotNil(t, r)
 	now := time.Now()
-	newReviews, err := r.FindOrNewReviews(Reviews{})
+	newReviews, _, err := r.FindOrNewReviews(Reviews{})
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(newReviews))
 	reviews := Reviews{
-		AppName:           "app",
-		Store:             "store",
-		Usernames:         []string{"username"},
-		Titles:            []string{"title"},
-		Bodies:            []string{"body"},
-		Ratings:           []int{1},
-		Datetimes:         []time.Time{now},
-		Rating1Percentage: 20,
-		Rating2Percentage: 0,
+		AppName: "app",
+		Store:   "store",
+		Items: []Review{
+			{Username: "username", Title: "title", Body: "body", Rating: 1, RatedAt: now},
+		},
+		ReviewsSummary: ReviewsSummary{
+			Rating1Percentage: 20,
+			Rating2Percentage: 0,
+		},
 	}
 
-	newReviews, err = r.FindOrNewReviews(reviews)
+	newReviews, _, err = r.FindOrNewReviews(reviews)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(newReviews))
 
+	// same review scraped again
+	newReviews, _, err = r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(newReviews))
+}
+
+func TestFindOrNewReviewsExternalID(t *testing.T) {
+	r := NewReviewsRepository()
+	now := time.Now()
+	reviews := Reviews{
+		AppName: "app-external-id",
+		Store:   "store",
+		Items: []Review{
+			{ExternalID: "1", Username: "Anonymous", Title: "title", Body: "body", Rating: 1, RatedAt: now},
+			{ExternalID: "2", Username: "Anonymous", Title: "title", Body: "body", Rating: 5, RatedAt: now},
+		},
+	}
+
+	// same username on the same date are different reviews
+	newReviews, _, err := r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(newReviews))
+	assert.Equal(t, "1", newReviews[0].ExternalID)
+	assert.Equal(t, "2", newReviews[1].ExternalID)
+
+	// store reformats the date of the same review
+	reviews.Items[0].RatedAt = now.Add(time.Hour)
+	reviews.Items[1].RatedAt = now.Add(time.Hour)
+	newReviews, _, err = r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(newReviews))
+}
+
+func TestFindOrNewReviewsEdited(t *testing.T) {
+	r := NewReviewsRepository()
+	now := time.Now()
+	reviews := Reviews{
+		AppName: "app-edited",
+		Store:   "store",
+		Items: []Review{
+			{ExternalID: "1", Username: "username", Title: "title", Body: "love it", Rating: 5, RatedAt: now},
+			{ExternalID: "2", Username: "other", Title: "title", Body: "body", Rating: 3, RatedAt: now},
+		},
+	}
+	newReviews, edits, err := r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(newReviews))
+	assert.Equal(t, 0, len(edits))
+	id := newReviews[0].ID
+
+	// user edits the first review, the store shows the date of the edit
+	editedAt := now.Add(24 * time.Hour)
+	reviews.Items[0].Title = "not anymore"
+	reviews.Items[0].Body = "too many ads"
+	reviews.Items[0].Rating = 1
+	reviews.Items[0].RatedAt = editedAt
+	newReviews, edits, err = r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(newReviews))
+	assert.Equal(t, 1, len(edits))
+	assert.Equal(t, id, edits[0].Review.ID)
+	assert.Equal(t, "too many ads", edits[0].Review.Body)
+	assert.Equal(t, 1, edits[0].Review.Rating)
+	assert.Equal(t, id, edits[0].Revision.ReviewID)
+	assert.Equal(t, "title", edits[0].Revision.Title)
+	assert.Equal(t, "love it", edits[0].Revision.Body)
+	assert.Equal(t, 5, edits[0].Revision.Rating)
+	assert.Equal(t, now.Unix(), edits[0].Revision.RatedAt.Unix())
+
+	review := ReviewModel{}
+	assert.Nil(t, r.db.First(&review, id).Error)
+	assert.Equal(t, "not anymore", review.Title)
+	assert.Equal(t, "too many ads", review.Body)
+	assert.Equal(t, 1, review.Rating)
+	assert.Equal(t, editedAt.Unix(), review.RatedAt.Unix())
+
+	// scraped again without another edit
+	_, edits, err = r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(edits))
+
+	// edited a second time, only the rating
+	reviews.Items[0].Rating = 2
+	_, edits, err = r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(edits))
+
+	revisions, err := r.FindReviewRevisions(id)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(revisions))
+	assert.Equal(t, 5, revisions[0].Rating)
+	assert.Equal(t, 1, revisions[1].Rating)
+	assert.Equal(t, "too many ads", revisions[1].Body)
+
+	// both edits, as the review was after each of them
+	found, err := r.FindReviewEdits("app-edited", "store", now.Add(-time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(found))
+	assert.Equal(t, revisions[0].ID, found[0].Revision.ID)
+	assert.Equal(t, id, found[0].Revision.ReviewID)
+	assert.Equal(t, 5, found[0].Revision.Rating)
+	assert.Equal(t, id, found[0].Review.ID)
+	assert.Equal(t, "app-edited", found[0].Review.AppName)
+	assert.Equal(t, 1, found[0].Review.Rating)
+	assert.Equal(t, "too many ads", found[0].Review.Body)
+	assert.Equal(t, editedAt.Unix(), found[0].Review.RatedAt.Unix())
+	assert.Equal(t, revisions[1].ID, found[1].Revision.ID)
+	assert.Equal(t, 1, found[1].Revision.Rating)
+	assert.Equal(t, 2, found[1].Review.Rating)
+	found, err = r.FindReviewEdits("app-edited", "store", now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(found))
+
+	// the other review was not edited
+	other := ReviewModel{}
+	assert.Nil(t, r.db.Where("app_name = ? AND external_id = ?", "app-edited", "2").First(&other).Error)
+	revisions, err = r.FindReviewRevisions(other.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(revisions))
+}
+
+func TestDeveloperResponses(t *testing.T) {
+	r := NewReviewsRepository()
+	now := time.Now()
+	reviews := Reviews{
+		AppName: "app-responses",
+		Store:   "store",
+		Items: []Review{
+			{ExternalID: "1", Username: "answered", Title: "title", Body: "body", Rating: 1, RatedAt: now.AddDate(0, 0, -10),
+				Response: "sorry", RespondedAt: now.AddDate(0, 0, -9)},
+			{ExternalID: "2", Username: "unanswered", Title: "title", Body: "body", Rating: 2, RatedAt: now.AddDate(0, 0, -5)},
+			{ExternalID: "3", Username: "recent", Title: "title", Body: "body", Rating: 1, RatedAt: now.AddDate(0, 0, -1)},
+			{ExternalID: "4", Username: "positive", Title: "title", Body: "body", Rating: 5, RatedAt: now.AddDate(0, 0, -10)},
+			{ExternalID: "5", Username: "oldest", Title: "title", Body: "body", Rating: 1, RatedAt: now.AddDate(0, 0, -20)},
+		},
+	}
+	newReviews, _, err := r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(newReviews))
+
+	response, found, err := r.FindDeveloperResponse(newReviews[0].ID)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "sorry", response.Body)
+	assert.Equal(t, now.AddDate(0, 0, -9).Unix(), response.RespondedAt.Unix())
+	_, found, err = r.FindDeveloperResponse(newReviews[1].ID)
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	unanswered, err := r.FindUnansweredReviews("app-responses", "", 2, now.AddDate(0, 0, -3))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(unanswered))
+	assert.Equal(t, "oldest", unanswered[0].Username)
+	assert.Equal(t, "unanswered", unanswered[1].Username)
+
+	unanswered, err = r.FindUnansweredReviews("app-responses", "other-store", 2, now.AddDate(0, 0, -3))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(unanswered))
+
+	// developer replies to a review, and edits the other reply
+	reviews.Items[1].Response = "we are on it"
+	reviews.Items[1].RespondedAt = now
+	reviews.Items[0].Response = "sorry, fixed in the next version"
+	newReviews, _, err = r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(newReviews))
+
+	unanswered, err = r.FindUnansweredReviews("app-responses", "store", 2, now.AddDate(0, 0, -3))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(unanswered))
+	assert.Equal(t, "oldest", unanswered[0].Username)
+
+	review := ReviewModel{}
+	assert.Nil(t, r.db.Where("app_name = ? AND external_id = ?", "app-responses", "1").First(&review).Error)
+	response, _, err = r.FindDeveloperResponse(review.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "sorry, fixed in the next version", response.Body)
+
+	// reply is not scraped anymore, it is kept
+	reviews.Items[0].Response = ""
+	_, _, err = r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	_, found, err = r.FindDeveloperResponse(review.ID)
+	assert.Nil(t, err)
+	assert.True(t, found)
+}
+
+func TestFindReviews(t *testing.T) {
+	r := NewReviewsRepository()
+	now := time.Now()
+	_, _, err := r.FindOrNewReviews(Reviews{
+		AppName: "app-find",
+		Store:   "store",
+		Items: []Review{
+			{ExternalID: "1", Username: "old", Rating: 1, RatedAt: now.AddDate(0, 0, -40)},
+			{ExternalID: "2", Username: "recent", Rating: 2, RatedAt: now.AddDate(0, 0, -2), Country: "jp", Language: "ja"},
+			{ExternalID: "3", Username: "latest", Rating: 5, RatedAt: now.AddDate(0, 0, -1)},
+		},
+	})
+	assert.Nil(t, err)
+
+	reviews, err := r.FindReviews("app-find", "", now.AddDate(0, 0, -30))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(reviews))
+	assert.Equal(t, "latest", reviews[0].Username)
+	assert.Equal(t, "recent", reviews[1].Username)
+	assert.Equal(t, "jp", reviews[1].Country)
+	assert.Equal(t, "ja", reviews[1].Language)
+
+	reviews, err = r.FindReviews("app-find", "store", time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(reviews))
+}
+
+func TestMigrateExternalIDs(t *testing.T) {
+	r := NewReviewsRepository()
+	now := time.Now()
+
+	// rows from before the external IDs
+	legacy, err := r.insertReview("app-legacy", "store", Review{Username: "username", Title: "title", Body: "body", Rating: 3, RatedAt: now})
+	assert.Nil(t, err)
+	assert.Nil(t, migrateExternalIDs(r.db))
+	other, err := r.insertReview("app-legacy", "store", Review{Username: "other", Title: "title", Body: "body", Rating: 3, RatedAt: now})
+	assert.Nil(t, err)
+	assert.Nil(t, migrateExternalIDs(r.db))
+
+	review := ReviewModel{}
+	assert.Nil(t, r.db.First(&review, legacy.ID).Error)
+	assert.Equal(t, fmt.Sprintf("legacy-%d", legacy.ID), review.ExternalID)
+	assert.True(t, legacy.UpdatedAt.Equal(*review.UpdatedAt))
+	otherReview := ReviewModel{}
+	assert.Nil(t, r.db.First(&otherReview, other.ID).Error)
+	assert.Equal(t, fmt.Sprintf("legacy-%d", other.ID), otherReview.ExternalID)
+
+	// migration can run again
+	assert.Nil(t, migrateExternalIDs(r.db))
+
+	// scraped again with the store's review ID, the legacy row gets the ID instead of a duplicate
+	reviews := Reviews{
+		AppName: "app-legacy",
+		Store:   "store",
+		Items: []Review{
+			{ExternalID: "100", Username: "username", Title: "title", Body: "body", Rating: 3, RatedAt: now},
+		},
+	}
+	newReviews, _, err := r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(newReviews))
+	assert.Nil(t, r.db.First(&review, legacy.ID).Error)
+	assert.Equal(t, "100", review.ExternalID)
+}
+
+func TestFindReviewHashRow(t *testing.T) {
+	r := NewReviewsRepository()
+	ratedAt := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	reviews := Reviews{
+		AppName: "app-hash",
+		Store:   StoreIOS,
+		Items: []Review{
+			{Username: "amy", Title: "title", Body: "body", Rating: 4, RatedAt: ratedAt},
+		},
+	}
+	newReviews, _, err := r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(newReviews))
+	assert.Equal(t, NewUtils().ReviewExternalID("amy", ratedAt), newReviews[0].ExternalID)
+
+	// the store gives its review ID later, the hash row gets the ID instead of a duplicate
+	reviews.Items[0].ExternalID = "200"
+	again, edited, err := r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(again))
+	assert.Equal(t, 0, len(edited))
+	review := ReviewModel{}
+	assert.Nil(t, r.db.First(&review, newReviews[0].ID).Error)
+	assert.Equal(t, "200", review.ExternalID)
+	assert.True(t, newReviews[0].UpdatedAt.Equal(*review.UpdatedAt))
+}
+
+func TestFindOrNewReviewsHashEdit(t *testing.T) {
+	r := NewReviewsRepository()
+	ratedAt := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	reviews := Reviews{
+		AppName: "app-hash-edit",
+		Store:   StoreIOS,
+		Items: []Review{
+			{Username: "bob", Title: "Bad", Body: "Crashes", Rating: 1, RatedAt: ratedAt},
+		},
+	}
+	newReviews, _, err := r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(newReviews))
+
+	// edited two days later, so the hash of the username and the rating date changed
+	editedAt := ratedAt.AddDate(0, 0, 2)
+	reviews.Items[0] = Review{Username: "bob", Title: "Fixed", Body: "Works now", Rating: 4, RatedAt: editedAt}
+	again, edited, err := r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(again))
+	assert.Equal(t, 1, len(edited))
+	assert.Equal(t, newReviews[0].ID, edited[0].Review.ID)
+	assert.Equal(t, NewUtils().ReviewExternalID("bob", editedAt), edited[0].Review.ExternalID)
+	assert.Equal(t, "Bad", edited[0].Revision.Title)
+	assert.Equal(t, "Fixed", edited[0].Review.Title)
+
+	// scraped again, the row is found by its new hash
+	again, edited, err = r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(again))
+	assert.Equal(t, 0, len(edited))
+
+	// another username is a new review
+	reviews.Items[0].Username = "carol"
+	again, _, err = r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(again))
+}
+
+func TestSearchReviews(t *testing.T) {
+	r := NewReviewsRepository()
+	now := time.Now()
+	_, _, err := r.FindOrNewReviews(Reviews{
+		AppName: "app-search",
+		Store:   StoreAndroid,
+		Items: []Review{
+			{ExternalID: "1", Username: "a", Title: "Crash", Body: "It CRASHES on start", Rating: 1, RatedAt: now.AddDate(0, 0, -3)},
+			{ExternalID: "2", Username: "b", Title: "Fun", Body: "100% fun", Rating: 5, RatedAt: now.AddDate(0, 0, -2)},
+			{ExternalID: "3", Username: "c", Title: "Ads", Body: "Too many ads", Rating: 2, RatedAt: now.AddDate(0, 0, -1)},
+		},
+	})
+	assert.Nil(t, err)
+	_, _, err = r.FindOrNewReviews(Reviews{
+		AppName: "app-search",
+		Store:   StoreIOS,
+		Items:   []Review{{ExternalID: "4", Username: "d", Title: "Okay", Body: "Fine", Rating: 3, RatedAt: now}},
+	})
+	assert.Nil(t, err)
+
+	reviews, total, err := r.SearchReviews(ReviewsQuery{AppName: "app-search"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), total)
+	assert.Equal(t, 4, len(reviews))
+	assert.Equal(t, "d", reviews[0].Username)
+
+	reviews, total, err = r.SearchReviews(ReviewsQuery{AppName: "app-search", Page: 2, PerPage: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), total)
+	assert.Equal(t, 1, len(reviews))
+	assert.Equal(t, "a", reviews[0].Username)
+
+	reviews, total, err = r.SearchReviews(ReviewsQuery{AppName: "app-search", Store: StoreAndroid, MaxRating: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, "c", reviews[0].Username)
+
+	reviews, _, err = r.SearchReviews(ReviewsQuery{AppName: "app-search", MinRating: 3, From: now.AddDate(0, 0, -2).Add(-time.Minute), To: now})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(reviews))
+	assert.Equal(t, "b", reviews[0].Username)
+
+	// the text is case insensitive, and its wildcards are literal
+	reviews, _, err = r.SearchReviews(ReviewsQuery{AppName: "app-search", Text: "crash"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(reviews))
+	assert.Equal(t, "a", reviews[0].Username)
+	reviews, _, err = r.SearchReviews(ReviewsQuery{AppName: "app-search", Text: "0%"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(reviews))
+	assert.Equal(t, "b", reviews[0].Username)
+	reviews, _, err = r.SearchReviews(ReviewsQuery{AppName: "app-search", Text: "_"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(reviews))
+}
+
+func TestFindApps(t *testing.T) {
+	r := NewReviewsRepository()
+	now := time.Now()
+	reviews := Reviews{
+		AppName: "app-apps",
+		Store:   StoreAndroid,
+		Items: []Review{
+			{ExternalID: "1", Username: "a", Rating: 1, RatedAt: now.AddDate(0, 0, -3)},
+			{ExternalID: "2", Username: "b", Rating: 5, RatedAt: now.AddDate(0, 0, -1)},
+		},
+		ReviewsSummary: ReviewsSummary{Total: 20, Rating5Percentage: 50, Rating1Percentage: 50},
+	}
+	_, _, err := r.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	_, err = r.InsertReviewCount(reviews)
+	assert.Nil(t, err)
+
+	apps, err := r.FindApps()
+	assert.Nil(t, err)
+	found := AppSummary{}
+	for _, a := range apps {
+		if a.AppName == "app-apps" {
+			found = a
+		}
+	}
+	assert.Equal(t, StoreAndroid, found.Store)
+	assert.Equal(t, int64(2), found.Reviews)
+	assert.Equal(t, now.AddDate(0, 0, -1).Unix(), found.LastRatedAt.Unix())
+	assert.Equal(t, 20, found.Total)
+	assert.Equal(t, 3.0, found.Average)
+
+	counts, err := r.FindReviewCounts("app-apps", StoreAndroid, time.Time{}, time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(counts))
+	counts, err = r.FindReviewCounts("app-apps", "", now.Add(time.Hour), time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(counts))
 }
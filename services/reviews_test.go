@@ -15,25 +15,21 @@ func TestVerifyReviews(t *testing.T) {
 	reviews := Reviews{
 		AppName: "test",
 		Store:   "test",
-		Usernames: []string{
-			"test",
-			"test2",
-		},
-		Titles: []string{
-			"test",
-			"test2",
-		},
-		Bodies: []string{
-			"test",
-			"test2",
-		},
-		Ratings: []int{
-			5,
-			3,
-		},
-		Datetimes: []time.Time{
-			time.Now(),
-			time.Now(),
+		Items: []Review{
+			{
+				Username: "test",
+				Title:    "test",
+				Body:     "test",
+				Rating:   5,
+				RatedAt:  time.Now(),
+			},
+			{
+				Username: "test2",
+				Title:    "test2",
+				Body:     "test2",
+				Rating:   3,
+				RatedAt:  time.Now(),
+			},
 		},
 	}
 	reviews.Total = 2
@@ -46,24 +42,59 @@ func TestVerifyReviewsError(t *testing.T) {
 	reviews := Reviews{
 		AppName: "test",
 		Store:   "test",
-		Usernames: []string{
-			"test",
-			"test2",
+		Items: []Review{
+			{
+				Username: "test",
+				Title:    "test",
+				Body:     "test",
+				Rating:   5,
+				RatedAt:  time.Now(),
+			},
 		},
-		Titles: []string{
-			"test",
+	}
+	// overall ratings are missing
+	err := VerifyReviews(&reviews)
+	assert.NotNil(t, err)
+
+	// review is missing the datetime
+	reviews.Total = 1
+	reviews.Rating5Percentage = 100
+	reviews.Items = append(reviews.Items, Review{Username: "test2", Rating: 3})
+	err = VerifyReviews(&reviews)
+	assert.NotNil(t, err)
+}
+
+func TestReviewVerify(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		review  Review
+		wantErr bool
+	}{
+		{
+			review:  Review{Username: "test", Rating: 1, RatedAt: now},
+			wantErr: false,
+		},
+		{
+			review:  Review{Username: "", Rating: 1, RatedAt: now},
+			wantErr: true,
 		},
-		Bodies: []string{
-			"test",
-			"test2",
+		{
+			review:  Review{Username: "test", Rating: 0, RatedAt: now},
+			wantErr: true,
 		},
-		Ratings: []int{
-			5,
+		{
+			review:  Review{Username: "test", Rating: 6, RatedAt: now},
+			wantErr: true,
 		},
-		Datetimes: []time.Time{
-			time.Now(),
+		{
+			review:  Review{Username: "test", Rating: 5},
+			wantErr: true,
 		},
 	}
-	err := VerifyReviews(&reviews)
-	assert.NotNil(t, err)
+	for _, test := range tests {
+		t.Run("verify test", func(t *testing.T) {
+			err := test.review.Verify()
+			assert.Equal(t, test.wantErr, err != nil)
+		})
+	}
 }
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+)
+
+// NotifyRule is a rule of the notify settings, ready to match the reviews, see @app.NotifyRule
+type NotifyRule struct {
+	app.NotifyRule
+	regex *regexp.Regexp
+}
+
+// NotifyRules decide which reviews are notified on which channel, see @NotifyRules.Allow
+type NotifyRules []*NotifyRule
+
+// NewNotifyRules checks the rules of the notify settings and returns them ready to match
+// Rules without a name are named rule {n}
+func NewNotifyRules(entries []app.NotifyRule) (NotifyRules, error) {
+	rules := NotifyRules{}
+	for i, entry := range entries {
+		if entry.Name == "" {
+			entry.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if entry.MinRating < 0 || entry.MinRating > 5 || entry.MaxRating < 0 || entry.MaxRating > 5 {
+			return nil, fmt.Errorf("[error] %s has a rating out of 1 to 5", entry.Name)
+		}
+		if entry.MaxRating > 0 && entry.MinRating > entry.MaxRating {
+			return nil, fmt.Errorf("[error] %s has min_rating above max_rating", entry.Name)
+		}
+		for _, channel := range entry.Channels {
+			found := false
+			for _, name := range Channels() {
+				found = found || name == channel
+			}
+			if !found {
+				return nil, fmt.Errorf("[error] %s has an unknown channel %s, use one of %s", entry.Name, channel, strings.Join(Channels(), ", "))
+			}
+		}
+		rule := &NotifyRule{NotifyRule: entry}
+		if entry.Regex != "" {
+			regex, err := regexp.Compile(entry.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("[error] %s has an invalid regex: %w", entry.Name, err)
+			}
+			rule.regex = regex
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Allow returns true when the review is notified on the channel
+// that is when the channel has no rules, or the review matches any of them
+func (rules NotifyRules) Allow(channel string, review ReviewModel) bool {
+	allow := true
+	for _, rule := range rules {
+		if !rule.AppliesTo(channel) {
+			continue
+		}
+		if rule.Match(review) {
+			return true
+		}
+		allow = false
+	}
+	return allow
+}
+
+// AppliesTo returns true when the rule is for the channel
+func (rule *NotifyRule) AppliesTo(channel string) bool {
+	return len(rule.Channels) == 0 || contains(rule.Channels, channel)
+}
+
+// Match returns true when the review matches all the fields of the rule that are set
+// The languages are only of the stores that scrape by language, so the reviews without one, eg. of the App Store, skip them
+func (rule *NotifyRule) Match(review ReviewModel) bool {
+	if rule.MinRating > 0 && review.Rating < rule.MinRating {
+		return false
+	}
+	if rule.MaxRating > 0 && review.Rating > rule.MaxRating {
+		return false
+	}
+	if len(rule.Stores) > 0 && !contains(rule.Stores, review.Store) {
+		return false
+	}
+	if len(rule.Countries) > 0 && !contains(rule.Countries, review.Country) {
+		return false
+	}
+	if len(rule.Languages) > 0 && review.Language != "" && !contains(rule.Languages, review.Language) {
+		return false
+	}
+	if rule.MinLength > 0 && len([]rune(strings.TrimSpace(review.Body))) < rule.MinLength {
+		return false
+	}
+	text := review.Title + "\n" + review.Body
+	if len(rule.Keywords) > 0 {
+		found := false
+		for _, keyword := range rule.Keywords {
+			found = found || strings.Contains(strings.ToLower(text), strings.ToLower(keyword))
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.regex != nil && !rule.regex.MatchString(text) {
+		return false
+	}
+	return true
+}
+
+// contains returns true when the list has the item, case insensitively, eg. US and us
+func contains(list []string, item string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, item) {
+			return true
+		}
+	}
+	return false
+}
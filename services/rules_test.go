@@ -0,0 +1,71 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyRule(t *testing.T) {
+	review := ReviewModel{Store: StoreAndroid, Country: "us", Language: "en", Title: "Crashes", Body: "The game crashes on level 10", Rating: 1}
+	tests := []struct {
+		rule app.NotifyRule
+		want bool
+	}{
+		{rule: app.NotifyRule{}, want: true},
+		{rule: app.NotifyRule{MaxRating: 2}, want: true},
+		{rule: app.NotifyRule{MinRating: 2}, want: false},
+		{rule: app.NotifyRule{Keywords: []string{"ads", "CRASH"}}, want: true},
+		{rule: app.NotifyRule{Keywords: []string{"ads"}}, want: false},
+		{rule: app.NotifyRule{Regex: `level \d+`}, want: true},
+		{rule: app.NotifyRule{Regex: `^level`}, want: false},
+		{rule: app.NotifyRule{Stores: []string{StoreIOS}}, want: false},
+		{rule: app.NotifyRule{Countries: []string{"US", "jp"}}, want: true},
+		{rule: app.NotifyRule{Languages: []string{"ja"}}, want: false},
+		{rule: app.NotifyRule{MinLength: 28}, want: true},
+		{rule: app.NotifyRule{MinLength: 29}, want: false},
+		// all the fields have to match
+		{rule: app.NotifyRule{MaxRating: 2, Keywords: []string{"ads"}}, want: false},
+	}
+	for _, test := range tests {
+		rules, err := NewNotifyRules([]app.NotifyRule{test.rule})
+		assert.Nil(t, err)
+		assert.Equal(t, test.want, rules[0].Match(review), "%+v", test.rule)
+	}
+
+	// the App Store reviews have no language, so the languages are skipped but not the other fields
+	rules, err := NewNotifyRules([]app.NotifyRule{{Languages: []string{"ja"}, MaxRating: 2}})
+	assert.Nil(t, err)
+	assert.True(t, rules[0].Match(ReviewModel{Store: StoreIOS, Country: "jp", Rating: 1}))
+	assert.False(t, rules[0].Match(ReviewModel{Store: StoreIOS, Country: "jp", Rating: 5}))
+}
+
+func TestNotifyRules(t *testing.T) {
+	rules, err := NewNotifyRules([]app.NotifyRule{
+		{Channels: []string{ChannelMSTeams}, MaxRating: 2},
+		{Name: "crashes", Channels: []string{ChannelMSTeams}, Keywords: []string{"crash"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "rule 1", rules[0].Name)
+
+	negative := ReviewModel{Rating: 1, Body: "bad"}
+	crash := ReviewModel{Rating: 4, Body: "fun but crashes"}
+	positive := ReviewModel{Rating: 5, Body: "nice game"}
+	assert.True(t, rules.Allow(ChannelMSTeams, negative))
+	assert.True(t, rules.Allow(ChannelMSTeams, crash))
+	assert.False(t, rules.Allow(ChannelMSTeams, positive))
+	// no rules for the channel
+	assert.True(t, rules.Allow(ChannelConsole, positive))
+	assert.True(t, NotifyRules{}.Allow(ChannelMSTeams, positive))
+
+	for _, rule := range []app.NotifyRule{
+		{MinRating: 6},
+		{MinRating: 4, MaxRating: 2},
+		{Regex: "(crash"},
+		{Channels: []string{"pager"}},
+	} {
+		_, err := NewNotifyRules([]app.NotifyRule{rule})
+		assert.NotNil(t, err, "%+v", rule)
+	}
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ParseSchedule parses a cron expression or an interval
+// Cron is the standard 5 fields or a descriptor, eg. "0 */6 * * *", "@hourly" or "@every 30m"
+// Interval is a duration, eg. "30m", which is the same as "@every 30m"
+func ParseSchedule(spec string) (cron.Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("[error] schedule is empty")
+	}
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("[error] schedule interval %s must be more than 0", spec)
+		}
+		return cron.Every(d), nil
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("[error] unable to parse schedule %s: %w", spec, err)
+	}
+	return schedule, nil
+}
+
+// scheduledJob is a job of the Scheduler, see @Scheduler.Add
+type scheduledJob struct {
+	name     string
+	schedule cron.Schedule
+	run      func(ctx context.Context) error
+}
+
+// Scheduler runs each job on its own schedule, until it is stopped
+// A job is never run again while it is still running, the runs missed meanwhile are skipped
+// A random jitter up to Jitter is added to every run, so that the jobs on the same schedule don't start at once
+// A job that fails is logged and runs again on its next schedule
+type Scheduler struct {
+	// Jitter is the maximum random delay added to every run
+	Jitter time.Duration
+
+	jobs []scheduledJob
+	// now and sleep are replaced in the tests
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) bool
+}
+
+// NewScheduler creates a new Scheduler
+func NewScheduler(jitter time.Duration) *Scheduler {
+	return &Scheduler{
+		Jitter: jitter,
+		now:    time.Now,
+		sleep:  sleepContext,
+	}
+}
+
+// Add adds the job to run on the schedule, see @ParseSchedule
+func (s *Scheduler) Add(name, spec string, run func(ctx context.Context) error) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("%w of %s", err, name)
+	}
+	s.jobs = append(s.jobs, scheduledJob{name: name, schedule: schedule, run: run})
+	return nil
+}
+
+// Run runs the jobs until the context is done
+// and then waits for the running jobs to return before it returns
+// The context is given to the jobs, so they should stop what can be stopped, eg. scraping,
+// and finish what shouldn't be, eg. writing to DB
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func(job scheduledJob) {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+}
+
+// loop runs the job on its schedule until the context is done
+// The next run is scheduled after the run returns, so the runs of a job never overlap
+func (s *Scheduler) loop(ctx context.Context, job scheduledJob) {
+	for {
+		next := job.schedule.Next(s.now())
+		if s.Jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(s.Jitter))))
+		}
+		log.Printf("[info] next run of %s at %s\n", job.name, next.Format(time.RFC3339))
+		if !s.sleep(ctx, next.Sub(s.now())) {
+			return
+		}
+
+		start := s.now()
+		log.Println("[info] running", job.name)
+		if err := s.runJob(ctx, job); err != nil {
+			log.Printf("[error] run of %s failed after %s: %s\n", job.name, s.now().Sub(start).Round(time.Second), err)
+		} else {
+			log.Printf("[info] run of %s finished after %s\n", job.name, s.now().Sub(start).Round(time.Second))
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// runJob runs the job once, a panic of the job is returned as an error so the other runs go on
+func (s *Scheduler) runJob(ctx context.Context, job scheduledJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("[error] panic: %v", r)
+		}
+	}()
+	return job.run(ctx)
+}
+
+// sleepContext sleeps for d, and returns false when the context is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchedule(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)
+	tests := []struct {
+		spec     string
+		nextWant time.Time
+	}{
+		{spec: "30m", nextWant: now.Add(30 * time.Minute)},
+		{spec: "@every 1h", nextWant: now.Add(time.Hour)},
+		{spec: "0 */6 * * *", nextWant: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{spec: "@hourly", nextWant: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		// bad schedules following
+		{spec: ""},
+		{spec: "0s"},
+		{spec: "-1h"},
+		{spec: "every hour"},
+		{spec: "61 * * * *"},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			schedule, err := ParseSchedule(test.spec)
+			if test.nextWant.IsZero() {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.nextWant, schedule.Next(now))
+		})
+	}
+}
+
+// fakeClock never moves, and sleeps are recorded instead
+// ctx is cancelled once the sleeps reach the limit
+type fakeClock struct {
+	mu     sync.Mutex
+	sleeps []time.Duration
+	limit  int
+	cancel context.CancelFunc
+}
+
+func (c *fakeClock) now() time.Time {
+	return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	if len(c.sleeps) >= c.limit {
+		c.cancel()
+	}
+	return ctx.Err() == nil
+}
+
+func TestScheduler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	clock := &fakeClock{limit: 10, cancel: cancel}
+	s := NewScheduler(time.Minute)
+	s.now = clock.now
+	s.sleep = clock.sleep
+
+	var running, overlaps, runs int32
+	assert.Nil(t, s.Add("fails", "1h", func(ctx context.Context) error {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		defer atomic.AddInt32(&running, -1)
+		if atomic.AddInt32(&runs, 1)%2 == 0 {
+			panic("scrape panicked")
+		}
+		return fmt.Errorf("[error] scrape failed")
+	}))
+	assert.NotNil(t, s.Add("bad", "every hour", func(ctx context.Context) error { return nil }))
+
+	s.Run(ctx)
+
+	// failed and panicked runs didn't stop the schedule, and never overlapped
+	assert.Equal(t, int32(9), atomic.LoadInt32(&runs))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&overlaps))
+	for _, d := range clock.sleeps {
+		assert.GreaterOrEqual(t, d, time.Hour)
+		assert.Less(t, d, time.Hour+time.Minute)
+	}
+}
+
+func TestSchedulerStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewScheduler(0)
+	started := make(chan bool)
+	release := make(chan bool)
+	finished := false
+	s.sleep = func(ctx context.Context, d time.Duration) bool {
+		return ctx.Err() == nil
+	}
+	assert.Nil(t, s.Add("write", "@every 1h", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		// in-flight write is finished after the stop, once the test releases it
+		<-release
+		finished = true
+		return nil
+	}))
+
+	done := make(chan bool)
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	<-started
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("scheduler stopped before the write finished")
+	default:
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduler didn't stop")
+	}
+	assert.True(t, finished)
+}
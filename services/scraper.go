@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+)
+
+// Scraper is a store from where the reviews are scraped
+// Every store is a self contained file which registers itself with RegisterScraper in init()
+// Third parties can register their own store from Go code the same way
+type Scraper interface {
+	// Store is the unique store name that is saved along with the reviews in DB
+	// Example: ios, android
+	Store() string
+	// Match returns true if the given reviews URL belongs to this store
+	Match(u *url.URL) bool
+	// Surf scrapes the reviews for the given reviews URL
+	Surf(ctx context.Context, urlStr string) (Reviews, error)
+}
+
+// ConfigurableScraper is a Scraper with options per app in the config file, see @app.StoreEntry
+// A registered scraper that isn't configurable scrapes only the url of the entry, and rejects any option
+type ConfigurableScraper interface {
+	Scraper
+	// Configure returns a new scraper for the entry, which sends its requests with the transport
+	// and the urls of the entry to scrape, eg. one per country
+	Configure(entry app.StoreEntry, transport http.RoundTripper) (Scraper, []string, error)
+}
+
+var (
+	scrapersMu sync.RWMutex
+	// scrapers are kept in the order of registration
+	// so that matching a URL is deterministic
+	scrapers []Scraper
+)
+
+// RegisterScraper registers a scraper for its store
+// Registering a scraper for an already registered store replaces the previous one
+func RegisterScraper(scraper Scraper) {
+	scrapersMu.Lock()
+	defer scrapersMu.Unlock()
+	for i, s := range scrapers {
+		if s.Store() == scraper.Store() {
+			scrapers[i] = scraper
+			return
+		}
+	}
+	scrapers = append(scrapers, scraper)
+}
+
+// Scrapers returns all the registered scrapers in the order of registration
+func Scrapers() []Scraper {
+	scrapersMu.RLock()
+	defer scrapersMu.RUnlock()
+	return append([]Scraper{}, scrapers...)
+}
+
+// Stores returns the store names of all the registered scrapers
+func Stores() []string {
+	stores := []string{}
+	for _, s := range Scrapers() {
+		stores = append(stores, s.Store())
+	}
+	return stores
+}
+
+// GetScraper returns the registered scraper for the given store name
+func GetScraper(store string) (Scraper, error) {
+	for _, s := range Scrapers() {
+		if s.Store() == store {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("[error] No scraper registered for store %s", store)
+}
+
+// FindScraper returns the registered scraper that matches the given reviews URL
+// The error is returned when the URL is not valid
+// The error is returned when no registered scraper matches the URL
+func FindScraper(urlStr string) (Scraper, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range Scrapers() {
+		if s.Match(u) {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("[error] Unable to fetch store from the given Review URL %s", urlStr)
+}
+
+// NewAppScraper returns the scraper of the store for the entry of an app in the config file, and the urls to scrape
+// The store is of a registered scraper, see @GetScraper, and the url of the entry must be of that store
+func NewAppScraper(store string, entry app.StoreEntry, transport http.RoundTripper) (Scraper, []string, error) {
+	scraper, err := GetScraper(store)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err := url.Parse(entry.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !scraper.Match(u) {
+		return nil, nil, fmt.Errorf("[error] %s is not a url of the store %s", entry.URL, store)
+	}
+	if configurable, ok := scraper.(ConfigurableScraper); ok {
+		return configurable.Configure(entry, transport)
+	}
+	if len(entry.Countries) > 0 || len(entry.Languages) > 0 || entry.Backend != "" {
+		return nil, nil, fmt.Errorf("[error] the store %s has no countries, languages or backend", store)
+	}
+	return scraper, []string{entry.URL}, nil
+}
+
+// contextTransport attaches the context to every request
+// Used for http clients that don't accept a context themselves, such as the headless browser
+type contextTransport struct {
+	ctx  context.Context
+	next http.RoundTripper
+}
+
+// RoundTrip executes a single HTTP transaction bound to the context
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req.WithContext(t.ctx))
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeScraper struct {
+	store string
+	host  string
+}
+
+func (f *fakeScraper) Store() string {
+	return f.store
+}
+
+func (f *fakeScraper) Match(u *url.URL) bool {
+	return u.Host == f.host
+}
+
+func (f *fakeScraper) Surf(_ context.Context, _ string) (Reviews, error) {
+	return Reviews{Store: f.store, ReviewsSummary: ReviewsSummary{Total: 1}}, nil
+}
+
+func TestDefaultScrapers(t *testing.T) {
+	assert.Contains(t, Stores(), StoreIOS)
+	assert.Contains(t, Stores(), StoreAndroid)
+
+	s, err := GetScraper(StoreIOS)
+	assert.Nil(t, err)
+	assert.Equal(t, StoreIOS, s.Store())
+
+	s, err = FindScraper("https://play.google.com/store/apps/details?id=com.king.candycrushsaga&hl=en&gl=US")
+	assert.Nil(t, err)
+	assert.Equal(t, StoreAndroid, s.Store())
+
+	_, err = GetScraper("not-registered")
+	assert.NotNil(t, err)
+	_, err = FindScraper("https://example.com/apps/candy-crush-saga")
+	assert.NotNil(t, err)
+}
+
+// restoreScrapers removes the scrapers registered by the test from the registry once it ends
+func restoreScrapers(t *testing.T) {
+	registered := Scrapers()
+	t.Cleanup(func() {
+		scrapersMu.Lock()
+		defer scrapersMu.Unlock()
+		scrapers = registered
+	})
+}
+
+func TestRegisterScraper(t *testing.T) {
+	restoreScrapers(t)
+	RegisterScraper(&fakeScraper{store: "fake", host: "fake.example.com"})
+	assert.Contains(t, Stores(), "fake")
+
+	s, err := FindScraper("https://fake.example.com/app/1")
+	assert.Nil(t, err)
+	assert.Equal(t, "fake", s.Store())
+
+	reviews, err := s.Surf(context.Background(), "https://fake.example.com/app/1")
+	assert.Nil(t, err)
+	assert.Equal(t, "fake", reviews.Store)
+
+	// registering again replaces the scraper for the same store
+	count := len(Scrapers())
+	RegisterScraper(&fakeScraper{store: "fake", host: "other.example.com"})
+	assert.Equal(t, count, len(Scrapers()))
+	_, err = FindScraper("https://fake.example.com/app/1")
+	assert.NotNil(t, err)
+	s, err = FindScraper("https://other.example.com/app/1")
+	assert.Nil(t, err)
+	assert.Equal(t, "fake", s.Store())
+
+	uu := NewUtils()
+	store, err := uu.GetStoreFromURL("https://other.example.com/app/1")
+	assert.Nil(t, err)
+	assert.Equal(t, "fake", store)
+}
+
+func TestNewAppScraper(t *testing.T) {
+	restoreScrapers(t)
+	transport := http.DefaultTransport
+	scraper, urls, err := NewAppScraper(StoreIOS, app.StoreEntry{URL: "https://apps.apple.com/us/app/a/id1", Countries: []string{"us", "jp"}, Backend: AppleBackendFeed}, transport)
+	assert.Nil(t, err)
+	assert.Equal(t, &SurfAppStore{Transport: transport, Backend: AppleBackendFeed}, scraper)
+	assert.Equal(t, []string{"https://apps.apple.com/us/app/a/id1", "https://apps.apple.com/jp/app/a/id1"}, urls)
+	scraper, urls, err = NewAppScraper(StoreAndroid, app.StoreEntry{URL: "https://play.google.com/store/apps/details?id=a", Languages: []string{"ja"}}, transport)
+	assert.Nil(t, err)
+	assert.Equal(t, StoreAndroid, scraper.Store())
+	assert.Equal(t, 1, len(urls))
+	assert.Contains(t, urls[0], "hl=ja")
+
+	// a registered store is configured with its name
+	RegisterScraper(&fakeScraper{store: "fake", host: "fake.example.com"})
+	scraper, urls, err = NewAppScraper("fake", app.StoreEntry{URL: "https://fake.example.com/app/1"}, transport)
+	assert.Nil(t, err)
+	assert.Equal(t, "fake", scraper.Store())
+	assert.Equal(t, []string{"https://fake.example.com/app/1"}, urls)
+
+	tests := []struct {
+		store string
+		entry app.StoreEntry
+	}{
+		{store: "not-registered", entry: app.StoreEntry{URL: "https://fake.example.com/app/1"}},
+		{store: "fake", entry: app.StoreEntry{URL: "https://fake.example.com/app/1", Countries: []string{"us"}}},
+		{store: StoreIOS, entry: app.StoreEntry{URL: "https://play.google.com/store/apps/details?id=a"}},
+		{store: StoreIOS, entry: app.StoreEntry{URL: "https://apps.apple.com/us/app/a/id1", Languages: []string{"en"}}},
+		{store: StoreIOS, entry: app.StoreEntry{URL: "https://apps.apple.com/us/app/a/id1", Backend: "api"}},
+		{store: StoreAndroid, entry: app.StoreEntry{URL: "https://play.google.com/store/apps/details?id=a", Countries: []string{"us"}}},
+		{store: StoreAndroid, entry: app.StoreEntry{URL: "https://play.google.com/store/apps/details?id=a", Backend: AppleBackendFeed}},
+	}
+	for _, test := range tests {
+		_, _, err := NewAppScraper(test.store, test.entry, transport)
+		assert.NotNil(t, err, test)
+	}
+}
@@ -1,7 +1,11 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -12,10 +16,34 @@ import (
 	"github.com/headzoo/surf/agent"
 	"github.com/headzoo/surf/browser"
 	"github.com/headzoo/surf/jar"
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
 )
 
+const (
+	// StoreIOS is the store name for iOS
+	StoreIOS = "ios"
+	// AppStoreHost is the hostname for the App Store
+	AppStoreHost = "apps.apple.com"
+
+	// AppleBackendHTML scrapes the reviews from the "see-all=reviews" HTML page
+	AppleBackendHTML = "html"
+	// AppleBackendFeed reads the reviews from the customer reviews JSON feed
+	// and falls back to AppleBackendHTML when the feed fails
+	AppleBackendFeed = "feed"
+)
+
+func init() {
+	RegisterScraper(NewSurfAppStore())
+}
+
 // SurfAppStore for dui
 type SurfAppStore struct {
+	// Transport is the http transport used by the headless browser
+	// When nil, http.DefaultTransport is used
+	Transport http.RoundTripper
+	// Backend is where the written reviews are scraped from
+	// AppleBackendHTML (default) or AppleBackendFeed
+	Backend string
 }
 
 // NewSurfAppStore returns a new SurfAppStore instance
@@ -23,6 +51,41 @@ func NewSurfAppStore() *SurfAppStore {
 	return &SurfAppStore{}
 }
 
+// Configure returns a new SurfAppStore of the backend of the entry, and the url of each of its countries
+func (s *SurfAppStore) Configure(entry app.StoreEntry, transport http.RoundTripper) (Scraper, []string, error) {
+	if len(entry.Languages) > 0 {
+		return nil, nil, fmt.Errorf("[error] the store %s has countries, not languages", StoreIOS)
+	}
+	switch entry.Backend {
+	case "", AppleBackendHTML, AppleBackendFeed:
+	default:
+		return nil, nil, fmt.Errorf("[error] unknown %s backend %s, html or feed", StoreIOS, entry.Backend)
+	}
+	urls := []string{entry.URL}
+	if len(entry.Countries) > 0 {
+		urls = []string{}
+		uu := NewUtils()
+		for _, country := range entry.Countries {
+			urlStr, err := uu.SetAppleCountry(entry.URL, country)
+			if err != nil {
+				return nil, nil, err
+			}
+			urls = append(urls, urlStr)
+		}
+	}
+	return &SurfAppStore{Transport: transport, Backend: entry.Backend}, urls, nil
+}
+
+// Store returns the store name for iOS
+func (s *SurfAppStore) Store() string {
+	return StoreIOS
+}
+
+// Match returns true for the App Store URLs
+func (s *SurfAppStore) Match(u *url.URL) bool {
+	return strings.HasPrefix(u.Host, AppStoreHost)
+}
+
 // getBrowser returns a new browser instance
 // with a custom User-Agent
 // and a cookie jar
@@ -39,6 +102,15 @@ func (s *SurfAppStore) getBrowser() *browser.Browser {
 }
 
 const (
+	// ratingReviewCardClass is the css class of the card of each written review
+	// All the css classes of a review below are looked up within its card
+	// Example:
+	// ★★★☆☆
+	// John Doe 2021/12/02
+	// Great App
+	// Hi, this is a great application..
+	ratingReviewCardClass = ".we-customer-review"
+
 	// ratingReviewUserClass is the css class where the Total number of reviews on the left side of ★ bars are shown
 	// Example: 278 is fetched
 	// 276件の評価 ★★★★★　----
@@ -110,19 +182,59 @@ const (
 	// Great App
 	// Hi, this is a great application..
 	ratingReviewBodyClass = ".we-customer-review__body"
+
+	// ratingReviewResponseClass is the css class where the developer's reply is shown, under the body of the review
+	// The reply has its own date and body with the same css classes as the review, see @parseReviewCard
+	// Example: "Thanks for the review.." and its date 2021/12/03 are fetched
+	// ★★★☆☆
+	// John Doe 2021/12/02
+	// Great App
+	// Hi, this is a great application..
+	// Developer Response 2021/12/03
+	// Thanks for the review..
+	ratingReviewResponseClass = ".we-customer-review__response"
 )
 
+// ratingReviewIDRe extracts the store's review ID from the id attribute of the title of the review
+// Example: 10643476458 is fetched from id="we-customer-review-10643476458"
+var ratingReviewIDRe = regexp.MustCompile(`review-(\d+)$`)
+
 // Surf reviews for a given app
 // and returns a Reviews struct
-func (s *SurfAppStore) Surf(urlStr string) (Reviews, error) {
-	reviews := Reviews{}
+// The reviews are read from the Backend, see @AppleBackendHTML and @AppleBackendFeed
+func (s *SurfAppStore) Surf(ctx context.Context, urlStr string) (Reviews, error) {
+	if s.Backend == AppleBackendFeed {
+		reviews, err := s.surfFeed(ctx, urlStr)
+		if err == nil {
+			return reviews, nil
+		}
+		log.Println("[warn] unable to read reviews feed, falling back to HTML:", err)
+	}
+	return s.surfHTML(ctx, urlStr)
+}
+
+// openPage opens the reviews page in the headless browser
+// The headless browser doesn't accept a context, so it is bound to the transport instead
+func (s *SurfAppStore) openPage(ctx context.Context, urlStr string) (*browser.Browser, error) {
 	bow := s.getBrowser()
+	bow.SetTransport(&contextTransport{ctx: ctx, next: s.Transport})
 
-	var err error
+	err := bow.Open(urlStr)
+	if err != nil {
+		return bow, fmt.Errorf("[error] unable to open the URL")
+	}
+	if bow.StatusCode() != http.StatusOK {
+		return bow, fmt.Errorf("[error] unable to open the URL, status %d", bow.StatusCode())
+	}
+	return bow, nil
+}
 
-	err = bow.Open(urlStr)
+// surfHTML scrapes the overall ratings and the written reviews from the HTML page
+func (s *SurfAppStore) surfHTML(ctx context.Context, urlStr string) (Reviews, error) {
+	reviews := Reviews{Store: s.Store()}
+	bow, err := s.openPage(ctx, urlStr)
 	if err != nil {
-		return reviews, fmt.Errorf("[error] unable to open the URL")
+		return reviews, err
 	}
 
 	// Setting the mutable state of the struct pointer
@@ -135,29 +247,12 @@ func (s *SurfAppStore) Surf(urlStr string) (Reviews, error) {
 	if err != nil {
 		return reviews, err
 	}
-	err = s.setRatings(&reviews, bow)
-	if err != nil {
-		return reviews, err
-	}
-	err = s.setReviewDate(&reviews, bow)
-	if err != nil {
-		return reviews, err
-	}
-	err = s.setReviewUser(&reviews, bow)
-	if err != nil {
-		return reviews, err
-	}
-	err = s.setReviewTitle(&reviews, bow)
-	if err != nil {
-		return reviews, err
-	}
-	err = s.setReviewBody(&reviews, bow)
+	err = s.setReviews(&reviews, bow)
 	if err != nil {
 		return reviews, err
 	}
 
-	// Finally verify the fetched reviews count is equal to the total reviews count
-	// This is to verify that all classes were found and fetched in order
+	// Finally verify the overall ratings were fetched along with the reviews
 	err = VerifyReviews(&reviews)
 	if err != nil {
 		return reviews, err
@@ -179,11 +274,14 @@ func (s *SurfAppStore) setRatingTotal(reviews *Reviews, bow *browser.Browser) er
 		count := re.FindAllString(s.Text(), -1)
 		if len(count) == 0 {
 			hasError = true
+			return
 		}
 
-		total, err := strconv.ParseFloat(count[0], 64)
+		// thousands separator, e.g. 2,345 Ratings
+		total, err := strconv.ParseFloat(strings.ReplaceAll(count[0], ",", ""), 64)
 		if err != nil {
 			hasError = true
+			return
 		}
 
 		//Check if in string, dirty code to interpret M as million
@@ -202,92 +300,85 @@ func (s *SurfAppStore) setRatingTotal(reviews *Reviews, bow *browser.Browser) er
 	return nil
 }
 
-// setReviewDate sets the date of the review
-// and returns an error if it fails
-// or if the date is not found
-// or if the date is not a valid date
-// This is the date from the datetime attribute of the css class where date of review for a review is shown
-func (s *SurfAppStore) setReviewDate(reviews *Reviews, bow *browser.Browser) error {
-	hasError := false
-	bow.Dom().Find(ratingReviewDateClass).Each(func(_ int, s *goquery.Selection) {
-		datetimeStr, has := s.Attr("datetime")
-		if !has {
-			hasError = true
-		}
-		if has {
-			datetime, err := dateparse.ParseAny(datetimeStr)
-			if err != nil {
-				hasError = true
-			} else {
-				reviews.Datetimes = append(reviews.Datetimes, datetime)
-			}
+// setReviews sets the written reviews, one per review card
+// Each card is parsed on its own, so a broken card is dropped
+// without affecting the reviews of the other cards
+func (s *SurfAppStore) setReviews(reviews *Reviews, bow *browser.Browser) error {
+	bow.Dom().Find(ratingReviewCardClass).Each(func(idx int, card *goquery.Selection) {
+		review, err := s.parseReviewCard(card)
+		if err != nil {
+			log.Printf("[warn] dropping review card %d: %s", idx, err)
+			return
 		}
+		reviews.Items = append(reviews.Items, review)
 	})
-	if hasError {
-		return fmt.Errorf("[error] unable to parse datetime")
-	}
 	return nil
 }
 
-// setReviewUser sets the username of the review
-// and returns an error if it fails
-// or if the username is not found
-// This is the username from the css class where username of review for a review is shown
-func (s *SurfAppStore) setReviewUser(reviews *Reviews, bow *browser.Browser) error {
-	bow.Dom().Find(ratingReviewUserClass).Each(func(_ int, s *goquery.Selection) {
-		reviews.Usernames = append(reviews.Usernames, strings.TrimSpace(s.Text()))
-	})
-	return nil
-}
+// parseReviewCard parses a single review card
+// and returns an error if any of rating, date, username or title is not found
+//
+// rating is from the css class where rating of review is shown
+// date is from the datetime attribute of the css class where date of review is shown
+// username, title and body are from the css classes where they are shown, and are trimmed
+// the store's review ID is from the id attribute of the title, and is optional
+// the developer's reply is optional, and is removed from the card before the review is parsed
+// as it has the same css classes for the date and body
+func (s *SurfAppStore) parseReviewCard(card *goquery.Selection) (Review, error) {
+	review := Review{}
 
-// setReviewTitle sets the title of the review
-// and returns an error if it fails
-// or if the title is not found
-// This is the title from the css class where title of review for a review is shown
-func (s *SurfAppStore) setReviewTitle(reviews *Reviews, bow *browser.Browser) error {
-	bow.Dom().Find(ratingReviewTitleClass).Each(func(_ int, s *goquery.Selection) {
-		reviews.Titles = append(reviews.Titles, strings.TrimSpace(s.Text()))
-	})
-	return nil
-}
+	response := card.Find(ratingReviewResponseClass).First()
+	if response.Length() > 0 {
+		review.Response = strings.TrimSpace(response.Find(ratingReviewBodyClass).First().Text())
+		if datetimeStr, has := response.Find(ratingReviewDateClass).First().Attr("datetime"); has {
+			if datetime, err := dateparse.ParseAny(datetimeStr); err == nil {
+				review.RespondedAt = datetime
+			}
+		}
+		response.Remove()
+	}
 
-// setReviewBody sets the body of the review
-// and returns an error if it fails
-// or if the body is not found
-// This is the body from the css class where body of review for a review is shown
-func (s *SurfAppStore) setReviewBody(reviews *Reviews, bow *browser.Browser) error {
-	bow.Dom().Find(ratingReviewBodyClass).Each(func(_ int, s *goquery.Selection) {
-		reviews.Bodies = append(reviews.Bodies, strings.TrimSpace(s.Text()))
-	})
-	return nil
-}
+	stars := card.Find(ratingStarCssClass).First()
+	if stars.HasClass(rating1StarCssClassName) {
+		review.Rating = 5
+	}
+	if stars.HasClass(rating2StarCssClassName) {
+		review.Rating = 4
+	}
+	if stars.HasClass(rating3StarCssClassName) {
+		review.Rating = 3
+	}
+	if stars.HasClass(rating4StarCssClassName) {
+		review.Rating = 2
+	}
+	if stars.HasClass(rating5StarCssClassName) {
+		review.Rating = 1
+	}
 
-// setRatings sets the rating of the review
-// and returns an error if it fails
-// or if the rating is not found
-// This is the rating from the css class where rating of review for a review is shown
-// There are many elements for this css class, so we loop through them in order
-func (s *SurfAppStore) setRatings(reviews *Reviews, bow *browser.Browser) error {
-	bow.Dom().Find(ratingStarCssClass).Each(func(_ int, s *goquery.Selection) {
-		rating := 0
-		if s.HasClass(rating1StarCssClassName) {
-			rating = 5
-		}
-		if s.HasClass(rating2StarCssClassName) {
-			rating = 4
-		}
-		if s.HasClass(rating3StarCssClassName) {
-			rating = 3
-		}
-		if s.HasClass(rating4StarCssClassName) {
-			rating = 2
-		}
-		if s.HasClass(rating5StarCssClassName) {
-			rating = 1
-		}
-		reviews.Ratings = append(reviews.Ratings, rating)
-	})
-	return nil
+	datetimeStr, has := card.Find(ratingReviewDateClass).First().Attr("datetime")
+	if !has {
+		return review, fmt.Errorf("[error] unable to find datetime")
+	}
+	datetime, err := dateparse.ParseAny(datetimeStr)
+	if err != nil {
+		return review, fmt.Errorf("[error] unable to parse datetime")
+	}
+	review.RatedAt = datetime
+
+	title := card.Find(ratingReviewTitleClass).First()
+	if title.Length() == 0 {
+		return review, fmt.Errorf("[error] unable to find title")
+	}
+	review.Title = strings.TrimSpace(title.Text())
+	id, _ := title.Attr("id")
+	if m := ratingReviewIDRe.FindStringSubmatch(id); m != nil {
+		review.ExternalID = m[1]
+	}
+
+	review.Username = strings.TrimSpace(card.Find(ratingReviewUserClass).First().Text())
+	review.Body = strings.TrimSpace(card.Find(ratingReviewBodyClass).First().Text())
+
+	return review, review.Verify()
 }
 
 // setRatingsPercentage sets the rating percentage of the review
@@ -300,6 +391,7 @@ func (s *SurfAppStore) setRatingsPercentage(reviews *Reviews, bow *browser.Brows
 		style, has := s.Attr("style")
 		if !has {
 			hasError = true
+			return
 		}
 		// extract width: 17% from the style attribute
 		re := regexp.MustCompile(`width: \d+\%`)
@@ -307,16 +399,15 @@ func (s *SurfAppStore) setRatingsPercentage(reviews *Reviews, bow *browser.Brows
 		reP := regexp.MustCompile(`\d+`)
 		if len(width) == 0 {
 			hasError = true
+			return
 		}
 		// extract just the number 17 from the matched string "width: 17%"
 		percentage := reP.FindAllString(width[0], -1)
-		if len(percentage) == 0 {
-			hasError = true
-		}
 		//convert to int
 		percentageInt, err := strconv.Atoi(percentage[0])
 		if err != nil {
 			hasError = true
+			return
 		}
 		switch idx {
 		// is first bar element 5 stars
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/araddon/dateparse"
+	"github.com/headzoo/surf/agent"
+)
+
+const (
+	// AppleFeedHost is the hostname for the customer reviews feed
+	AppleFeedHost = "itunes.apple.com"
+
+	// appleFeedURL is the customer reviews feed per country, page and app id
+	// Example: https://itunes.apple.com/us/rss/customerreviews/page=1/id=553834731/sortby=mostrecent/json
+	appleFeedURL = "https://" + AppleFeedHost + "/%s/rss/customerreviews/page=%d/id=%s/sortby=mostrecent/json"
+
+	// appleFeedMaxPages is the limit of the pages the feed serves, 50 reviews per page
+	appleFeedMaxPages = 10
+)
+
+// appleFeedLastPageRe extracts the page number from the feed link rel="last"
+var appleFeedLastPageRe = regexp.MustCompile(`/page=(\d+)/`)
+
+// appleFeedLabel is how every value is wrapped in the feed
+// Example: "im:rating": {"label": "5"}
+type appleFeedLabel struct {
+	Label string `json:"label"`
+}
+
+// appleFeedEntry is a single review in the feed
+type appleFeedEntry struct {
+	ID      appleFeedLabel `json:"id"`
+	Updated appleFeedLabel `json:"updated"`
+	Title   appleFeedLabel `json:"title"`
+	Content appleFeedLabel `json:"content"`
+	Author  struct {
+		Name appleFeedLabel `json:"name"`
+	} `json:"author"`
+	Rating    appleFeedLabel `json:"im:rating"`
+	Version   appleFeedLabel `json:"im:version"`
+	VoteSum   appleFeedLabel `json:"im:voteSum"`
+	VoteCount appleFeedLabel `json:"im:voteCount"`
+}
+
+// appleFeed is the customer reviews feed response
+// entry is an array of reviews, or a single review object when there is only one
+type appleFeed struct {
+	Feed struct {
+		Entry json.RawMessage `json:"entry"`
+		Link  []struct {
+			Attributes struct {
+				Rel  string `json:"rel"`
+				Href string `json:"href"`
+			} `json:"attributes"`
+		} `json:"link"`
+	} `json:"feed"`
+}
+
+// surfFeed reads the written reviews from the customer reviews feed
+// walking all the pages up to the feed limit, sorted by most recent
+// The overall ratings are not in the feed, so they are scraped from the HTML page
+// and are left unset when the HTML page fails, see @setFeedRatingsSummary
+func (s *SurfAppStore) surfFeed(ctx context.Context, urlStr string) (Reviews, error) {
+	reviews := Reviews{Store: s.Store()}
+	uu := NewUtils()
+	id, country, err := uu.GetAppInfoApple(urlStr)
+	if err != nil {
+		return reviews, err
+	}
+
+	feedReviews := []Review{}
+	lastPage := appleFeedMaxPages
+	for page := 1; page <= lastPage; page++ {
+		pageReviews, last, err := s.fetchFeedPage(ctx, country, id, page)
+		if err != nil {
+			// only the first page is fatal, rest of the pages are best effort
+			if page == 1 {
+				return reviews, err
+			}
+			break
+		}
+		feedReviews = append(feedReviews, pageReviews...)
+		if len(pageReviews) == 0 {
+			break
+		}
+		if last > 0 && last < lastPage {
+			lastPage = last
+		}
+	}
+	if len(feedReviews) == 0 {
+		return reviews, fmt.Errorf("[error] no reviews found in the feed")
+	}
+
+	sort.SliceStable(feedReviews, func(i, j int) bool {
+		return feedReviews[i].RatedAt.After(feedReviews[j].RatedAt)
+	})
+	reviews.Items = feedReviews
+
+	if err := s.setFeedRatingsSummary(ctx, &reviews, urlStr); err != nil {
+		return reviews, err
+	}
+	// without the overall ratings only the reviews are saved, which were verified by parseFeedEntry
+	if reviews.Total == 0 {
+		return reviews, nil
+	}
+	if err := VerifyReviews(&reviews); err != nil {
+		return reviews, err
+	}
+	return reviews, nil
+}
+
+// fetchFeedPage fetches a single page of the feed
+// and returns the reviews on the page along with the last page number of the feed, 0 when unknown
+func (s *SurfAppStore) fetchFeedPage(ctx context.Context, country, id string, page int) ([]Review, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(appleFeedURL, country, page, id), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("User-Agent", agent.Chrome())
+
+	client := &http.Client{Transport: s.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("[error] reviews feed responded with %s", resp.Status)
+	}
+
+	var feed appleFeed
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, 0, err
+	}
+
+	last := 0
+	for _, link := range feed.Feed.Link {
+		if link.Attributes.Rel != "last" {
+			continue
+		}
+		if m := appleFeedLastPageRe.FindStringSubmatch(link.Attributes.Href); m != nil {
+			last, _ = strconv.Atoi(m[1])
+		}
+	}
+
+	entries := []appleFeedEntry{}
+	raw := strings.TrimSpace(string(feed.Feed.Entry))
+	if strings.HasPrefix(raw, "[") {
+		if err := json.Unmarshal(feed.Feed.Entry, &entries); err != nil {
+			return nil, 0, err
+		}
+	} else if strings.HasPrefix(raw, "{") {
+		entry := appleFeedEntry{}
+		if err := json.Unmarshal(feed.Feed.Entry, &entry); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, entry)
+	}
+
+	pageReviews := []Review{}
+	for idx, entry := range entries {
+		// the first entry of the older feed format is the app itself, it has no rating
+		if entry.Rating.Label == "" {
+			continue
+		}
+		review, err := s.parseFeedEntry(entry)
+		if err != nil {
+			log.Printf("[warn] dropping feed entry %d on page %d: %s", idx, page, err)
+			continue
+		}
+		pageReviews = append(pageReviews, review)
+	}
+	return pageReviews, last, nil
+}
+
+// parseFeedEntry parses a single review of the feed
+// and returns an error if any of rating, date or username is not valid
+// The developer responses are not in the feed, so they are only scraped with the HTML backend
+func (s *SurfAppStore) parseFeedEntry(entry appleFeedEntry) (Review, error) {
+	review := Review{
+		ExternalID: entry.ID.Label,
+		Username:   strings.TrimSpace(entry.Author.Name.Label),
+		Title:      strings.TrimSpace(entry.Title.Label),
+		Body:       strings.TrimSpace(entry.Content.Label),
+		AppVersion: entry.Version.Label,
+	}
+	rating, err := strconv.Atoi(entry.Rating.Label)
+	if err != nil {
+		return review, fmt.Errorf("[error] unable to parse rating %s", entry.Rating.Label)
+	}
+	review.Rating = rating
+	ratedAt, err := dateparse.ParseAny(entry.Updated.Label)
+	if err != nil {
+		return review, fmt.Errorf("[error] unable to parse datetime %s", entry.Updated.Label)
+	}
+	review.RatedAt = ratedAt
+	review.VoteSum, _ = strconv.Atoi(entry.VoteSum.Label)
+	review.VoteCount, _ = strconv.Atoi(entry.VoteCount.Label)
+	return review, review.Verify()
+}
+
+// setFeedRatingsSummary sets the total and the rating percentages from the HTML page
+// When the HTML page fails, those are left unset, as the feed has only the latest reviews of the millions
+// and a total of them would be saved as the rating history, so the review count isn't saved on the run
+func (s *SurfAppStore) setFeedRatingsSummary(ctx context.Context, reviews *Reviews, urlStr string) error {
+	bow, err := s.openPage(ctx, urlStr)
+	if err == nil {
+		summary := Reviews{}
+		if s.setRatingTotal(&summary, bow) == nil && s.setRatingsPercentage(&summary, bow) == nil && summary.Total > 0 {
+			reviews.ReviewsSummary = summary.ReviewsSummary
+			return nil
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	log.Println("[warn] unable to scrape overall ratings, only the reviews of the feed are saved")
+	return nil
+}
@@ -1,13 +1,55 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
 	reviewsService "github.com/n0madic/google-play-scraper/pkg/reviews"
+	"github.com/n0madic/google-play-scraper/pkg/store"
 )
 
+const (
+	// StoreAndroid is the store name for Android
+	StoreAndroid = "android"
+	// PlayStoreHost is the hostname for the Play Store
+	PlayStoreHost = "play.google.com"
+
+	// batchExecuteURL is the internal endpoint used by the Play Store web UI to load the reviews
+	batchExecuteURL = "https://" + PlayStoreHost + "/_/PlayStoreUi/data/batchexecute"
+	// reviewsPageSize is the maximum number of reviews the Play Store returns per request
+	reviewsPageSize = 40
+
+	// reviewsInitialRequest and reviewsPaginatedRequest are the form payloads for batchexecute
+	// Copied from initialRequest and paginatedRequest of github.com/n0madic/google-play-scraper/pkg/reviews/reviews.go
+	// at v0.0.0-20231014122808-52dbf3ade79b, which are unexported, so that the library can parse the results
+	// TestSurfGoogleStoreMatchesLibrary fails when they, or the query of @batchExecute, drift from the library
+	reviewsInitialRequest   = `f.req=%5B%5B%5B%22UsvDTd%22%2C%22%5Bnull%2Cnull%2C%5B2%2C{{sort}}%2C%5B{{numberOfReviewsPerRequest}}%2Cnull%2Cnull%5D%2Cnull%2C%5B%5D%5D%2C%5B%5C%22{{appId}}%5C%22%2C7%5D%5D%22%2Cnull%2C%22generic%22%5D%5D%5D`
+	reviewsPaginatedRequest = `f.req=%5B%5B%5B%22UsvDTd%22%2C%22%5Bnull%2Cnull%2C%5B2%2C{{sort}}%2C%5B{{numberOfReviewsPerRequest}}%2Cnull%2C%5C%22{{withToken}}%5C%22%5D%2Cnull%2C%5B%5D%5D%2C%5B%5C%22{{appId}}%5C%22%2C7%5D%5D%22%2Cnull%2C%22generic%22%5D%5D%5D`
+)
+
+// GoogleReviewsNumber is the number of reviews the registered Play Store scraper surfs, which is everything
+const GoogleReviewsNumber = 100000
+
+func init() {
+	RegisterScraper(NewSurfGoogleStore(GoogleReviewsNumber))
+}
+
 // SurfGoogleStore is a SurfGoogleStore
 type SurfGoogleStore struct {
 	// Number is the number of reviews to scrape
 	Number int
+	// Transport is the http transport used to call the Play Store
+	// When nil, http.DefaultTransport is used
+	Transport http.RoundTripper
 }
 
 // NewSurfGoogleStore creates a new SurfGoogleStore
@@ -17,21 +59,53 @@ func NewSurfGoogleStore(number int) *SurfGoogleStore {
 	}
 }
 
+// Configure returns a new SurfGoogleStore of all the reviews, and the url of each language of the entry
+func (s *SurfGoogleStore) Configure(entry app.StoreEntry, transport http.RoundTripper) (Scraper, []string, error) {
+	if len(entry.Countries) > 0 {
+		return nil, nil, fmt.Errorf("[error] the store %s has languages, not countries", StoreAndroid)
+	}
+	if entry.Backend != "" {
+		return nil, nil, fmt.Errorf("[error] the store %s has no backend, it is for %s only", StoreAndroid, StoreIOS)
+	}
+	urls := []string{entry.URL}
+	if len(entry.Languages) > 0 {
+		urls = []string{}
+		uu := NewUtils()
+		for _, language := range entry.Languages {
+			urlStr, err := uu.SetGoogleLanguage(entry.URL, language)
+			if err != nil {
+				return nil, nil, err
+			}
+			urls = append(urls, urlStr)
+		}
+	}
+	gs := NewSurfGoogleStore(GoogleReviewsNumber)
+	gs.Transport = transport
+	return gs, urls, nil
+}
+
+// Store returns the store name for Android
+func (s *SurfGoogleStore) Store() string {
+	return StoreAndroid
+}
+
+// Match returns true for the Play Store URLs
+func (s *SurfGoogleStore) Match(u *url.URL) bool {
+	return strings.HasPrefix(u.Host, PlayStoreHost)
+}
+
 // Surf Google Store
-// Uses a library to scrape reviews from Google Play
-func (s *SurfGoogleStore) Surf(urlStr string) (Reviews, error) {
-	reviews := Reviews{}
+// Loads the reviews page by page from the Play Store
+// and uses a library to parse each of the reviews
+func (s *SurfGoogleStore) Surf(ctx context.Context, urlStr string) (Reviews, error) {
+	reviews := Reviews{Store: s.Store()}
 	uu := NewUtils()
 	id, language, err := uu.GetAppInfoGoogle(urlStr)
 	if err != nil {
 		return reviews, err
 	}
 
-	r := reviewsService.New(id, reviewsService.Options{
-		Number:   s.Number,
-		Language: language,
-	})
-	err = r.Run()
+	results, err := s.fetchReviews(ctx, id, language)
 	if err != nil {
 		return reviews, err
 	}
@@ -41,13 +115,26 @@ func (s *SurfGoogleStore) Surf(urlStr string) (Reviews, error) {
 	ratings3Count := 0
 	ratings4Count := 0
 	ratings5Count := 0
-	for _, review := range r.Results {
-		// fmt.Println(review.Reviewer, review.Timestamp, review.Score, review.Text)
-		reviews.Titles = append(reviews.Titles, "Google Play store") // there is no title in Google, so settings it as default
-		reviews.Usernames = append(reviews.Usernames, review.Reviewer)
-		reviews.Datetimes = append(reviews.Datetimes, review.Timestamp)
-		reviews.Bodies = append(reviews.Bodies, review.Text)
-		reviews.Ratings = append(reviews.Ratings, review.Score)
+	for _, review := range results {
+		item := Review{
+			ExternalID: review.ID,
+			Username:   review.Reviewer,
+			Title:      "Google Play store", // there is no title in Google, so settings it as default
+			Body:       review.Text,
+			Rating:     review.Score,
+			RatedAt:    review.Timestamp,
+			AppVersion: review.Version,
+			VoteSum:    review.Useful,
+		}
+		if review.Reply != "" {
+			item.Response = review.Reply
+			item.RespondedAt = review.ReplyTimestamp
+		}
+		if err := item.Verify(); err != nil {
+			log.Printf("[warn] dropping review %s: %s", review.ID, err)
+			continue
+		}
+		reviews.Items = append(reviews.Items, item)
 
 		reviews.Total++
 		switch review.Score {
@@ -76,3 +163,129 @@ func (s *SurfGoogleStore) Surf(urlStr string) (Reviews, error) {
 
 	return reviews, nil
 }
+
+// fetchReviews loads the pages of reviews until Number of reviews are fetched
+// or there are no more pages left
+// Duplicate reviews across the pages are skipped by their ID
+func (s *SurfGoogleStore) fetchReviews(ctx context.Context, id, language string) ([]reviewsService.Review, error) {
+	results := []reviewsService.Review{}
+	seen := map[string]bool{}
+	token := ""
+	for len(results) < s.Number {
+		pageSize := reviewsPageSize
+		if pageSize > s.Number {
+			pageSize = s.Number
+		}
+		page, nextToken, err := s.batchExecute(ctx, s.reviewsPayload(id, token, pageSize), language)
+		if err != nil {
+			// only the first page is fatal, same as the scraper library
+			if token == "" {
+				return results, err
+			}
+			break
+		}
+		for _, review := range page {
+			if seen[review.ID] || len(results) >= s.Number {
+				continue
+			}
+			seen[review.ID] = true
+			results = append(results, review)
+		}
+		if len(page) == 0 || nextToken == "" {
+			break
+		}
+		token = nextToken
+	}
+	return results, nil
+}
+
+// reviewsPayload returns the form payload for the first page when token is empty
+// and for the next page of the given token otherwise
+func (s *SurfGoogleStore) reviewsPayload(id, token string, pageSize int) string {
+	payload := reviewsInitialRequest
+	if token != "" {
+		payload = reviewsPaginatedRequest
+	}
+	r := strings.NewReplacer(
+		"{{sort}}", strconv.Itoa(int(store.SortHelpfulness)),
+		"{{numberOfReviewsPerRequest}}", strconv.Itoa(pageSize),
+		"{{withToken}}", token,
+		"{{appId}}", id,
+	)
+	return r.Replace(payload)
+}
+
+// batchExecute posts the payload to the Play Store and returns the parsed reviews
+// along with the token for the next page, which is empty on the last page
+//
+// The response is prefixed with )]}' and is in the format of
+// [["wrb.fr","UsvDTd","[[review, review, ...],[null,\"token\"]]", ...]]
+func (s *SurfGoogleStore) batchExecute(ctx context.Context, payload, language string) ([]reviewsService.Review, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, batchExecuteURL, strings.NewReader(payload))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
+	q := req.URL.Query()
+	q.Add("authuser", "0")
+	q.Add("bl", "boq_playuiserver_20190424.04_p0")
+	q.Add("gl", "")
+	q.Add("hl", language)
+	q.Add("soc-app", "121")
+	q.Add("soc-platform", "1")
+	q.Add("soc-device", "1")
+	q.Add("rpcids", "qnKhOb")
+	req.URL.RawQuery = q.Encode()
+
+	client := &http.Client{Transport: s.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("[error] Play Store responded with %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var envelope [][]interface{}
+	if err := json.Unmarshal(bytes.TrimLeft(body, ")]}'\n"), &envelope); err != nil {
+		return nil, "", err
+	}
+	if len(envelope) < 1 || len(envelope[0]) < 3 {
+		return nil, "", fmt.Errorf("[error] invalid size of the resulting array")
+	}
+	data, ok := envelope[0][2].(string)
+	if !ok {
+		// no reviews at all
+		return nil, "", nil
+	}
+
+	var page []json.RawMessage
+	if err := json.Unmarshal([]byte(data), &page); err != nil {
+		return nil, "", err
+	}
+	results := []reviewsService.Review{}
+	if len(page) > 0 {
+		var items []json.RawMessage
+		if err := json.Unmarshal(page[0], &items); err != nil {
+			return nil, "", err
+		}
+		for _, item := range items {
+			if review := reviewsService.Parse(string(item)); review != nil {
+				results = append(results, *review)
+			}
+		}
+	}
+	token := ""
+	if len(page) > 1 {
+		var next []interface{}
+		if err := json.Unmarshal(page[1], &next); err == nil && len(next) > 1 {
+			token, _ = next[1].(string)
+		}
+	}
+	return results, token, nil
+}
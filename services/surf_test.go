@@ -1,8 +1,12 @@
 package services
 
 import (
+	"context"
+	"net/http"
 	"testing"
+	"time"
 
+	reviewsService "github.com/n0madic/google-play-scraper/pkg/reviews"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,22 +25,247 @@ func TestGetBrowser(t *testing.T) {
 	assert.NotNil(t, browser)
 }
 
+// TestRecordFixtures records the responses of the live stores under testdata/recorded, see @recordedDir
+// Only runs with -update flag, and doesn't change the fixtures the other tests assert
+func TestRecordFixtures(t *testing.T) {
+	if !*updateFixtures {
+		t.Skip("run with -update to record the fixtures from the live stores")
+	}
+	sa := NewSurfAppStore()
+	sa.Transport = newFakeStore(t)
+	_, err := sa.Surf(context.Background(), iosReviewsCandyCrushURL)
+	assert.Nil(t, err)
+	_, err = sa.surfFeed(context.Background(), iosReviewsCandyCrushURL)
+	assert.Nil(t, err)
+
+	sg := NewSurfGoogleStore(80) // two pages
+	sg.Transport = newFakeStore(t)
+	_, err = sg.Surf(context.Background(), googleReviewsCandyCrushURL)
+	assert.Nil(t, err)
+}
+
 func TestSurfAppleStore(t *testing.T) {
 	s := NewSurfAppStore()
-	// will do actual test
-	reviews, err := s.Surf(iosReviewsCandyCrushURL)
+	s.Transport = newFakeStore(t)
+	reviews, err := s.Surf(context.Background(), iosReviewsCandyCrushURL)
+	assert.Nil(t, err)
+	assert.Equal(t, StoreIOS, reviews.Store)
+	assert.Equal(t, 2900000, reviews.Total)
+	assert.Equal(t, 81, reviews.Rating5Percentage)
+	assert.Equal(t, 9, reviews.Rating4Percentage)
+	assert.Equal(t, 4, reviews.Rating3Percentage)
+	assert.Equal(t, 2, reviews.Rating2Percentage)
+	assert.Equal(t, 4, reviews.Rating1Percentage)
+
+	assert.Equal(t, 3, len(reviews.Items))
+	assert.Equal(t, Review{
+		ExternalID: "10643476458",
+		Username:   "Thisiswhyidon't",
+		Title:      "Problematic Ads",
+		Body:       "I love this game and have a lot of fun playing it, but the ads override silent mode.",
+		Rating:     5,
+		RatedAt:    reviews.Items[0].RatedAt,
+	}, reviews.Items[0])
+	assert.Equal(t, time.Date(2022, 2, 13, 0, 0, 0, 0, time.UTC), reviews.Items[0].RatedAt.UTC())
+	assert.Equal(t, "sugar rush", reviews.Items[1].Username)
+	assert.Equal(t, "New levels every week, keeps me coming back.", reviews.Items[1].Body)
+	assert.Equal(t, 4, reviews.Items[1].Rating)
+	assert.Equal(t, "10598765432", reviews.Items[2].ExternalID)
+	assert.Equal(t, "Pay to win", reviews.Items[2].Title)
+	assert.Equal(t, 1, reviews.Items[2].Rating)
+
+	// developer response is not mixed with the review
+	assert.Equal(t, "Impossible to pass level 3000 without buying boosters.", reviews.Items[2].Body)
+	assert.Equal(t, time.Date(2022, 2, 10, 0, 0, 0, 0, time.UTC), reviews.Items[2].RatedAt.UTC())
+	assert.Equal(t, "Hi! All levels can be passed without boosters, keep trying!", reviews.Items[2].Response)
+	assert.Equal(t, time.Date(2022, 2, 11, 0, 0, 0, 0, time.UTC), reviews.Items[2].RespondedAt.UTC())
+	assert.Equal(t, "", reviews.Items[0].Response)
+	assert.True(t, reviews.Items[0].RespondedAt.IsZero())
+}
+
+func TestSurfAppleStoreErrors(t *testing.T) {
+	s := NewSurfAppStore()
+	s.Transport = newFakeStore(t)
+	tests := []string{
+		"https://apps.apple.com/us/app/broken-total/id1?see-all=reviews",
+		"https://apps.apple.com/us/app/broken-bar/id1?see-all=reviews",
+		"https://apps.apple.com/us/app/not-found/id1?see-all=reviews",
+	}
+	for _, urlStr := range tests {
+		t.Run(urlStr, func(t *testing.T) {
+			_, err := s.Surf(context.Background(), urlStr)
+			assert.NotNil(t, err)
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.Surf(ctx, iosReviewsCandyCrushURL)
+	assert.NotNil(t, err)
+}
+
+func TestSurfAppleStoreBrokenCards(t *testing.T) {
+	s := NewSurfAppStore()
+	s.Transport = newFakeStore(t)
+
+	// first card has a bad date, only that card is dropped
+	reviews, err := s.Surf(context.Background(), "https://apps.apple.com/us/app/broken-date/id1?see-all=reviews")
 	assert.Nil(t, err)
-	assert.NotNil(t, reviews)
-	assert.LessOrEqual(t, 10000, reviews.Total)         // at least more than this many reviews are there
-	assert.LessOrEqual(t, 1, reviews.Rating1Percentage) // at least more than this many reviews are there
+	assert.Equal(t, 2, len(reviews.Items))
+	assert.Equal(t, "sugar rush", reviews.Items[0].Username)
+	assert.Equal(t, "Great levels", reviews.Items[0].Title)
+	assert.Equal(t, "CandyHater99", reviews.Items[1].Username)
+	assert.Equal(t, "Pay to win", reviews.Items[1].Title)
+
+	// second card has no title, the cards after it are not misaligned
+	reviews, err = s.Surf(context.Background(), "https://apps.apple.com/us/app/broken-card/id1?see-all=reviews")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(reviews.Items))
+	assert.Equal(t, "Thisiswhyidon't", reviews.Items[0].Username)
+	assert.Equal(t, "CandyHater99", reviews.Items[1].Username)
+	assert.Equal(t, "Pay to win", reviews.Items[1].Title)
+	assert.Equal(t, "Impossible to pass level 3000 without buying boosters.", reviews.Items[1].Body)
+}
+
+func TestSurfAppleStoreFeed(t *testing.T) {
+	s := NewSurfAppStore()
+	s.Backend = AppleBackendFeed
+	s.Transport = newFakeStore(t)
+	reviews, err := s.Surf(context.Background(), iosReviewsCandyCrushURL)
+	assert.Nil(t, err)
+	assert.Equal(t, StoreIOS, reviews.Store)
+	// summary is from the HTML page
+	assert.Equal(t, 2900000, reviews.Total)
+	assert.Equal(t, 81, reviews.Rating5Percentage)
+
+	// both pages sorted by most recent
+	externalIDs := []string{}
+	for _, review := range reviews.Items {
+		externalIDs = append(externalIDs, review.ExternalID)
+	}
+	assert.Equal(t, []string{"10700000003", "10700000002", "10700000001", "10699999999", "10699999998"}, externalIDs)
+	assert.Equal(t, Review{
+		ExternalID: "10700000002",
+		Username:   "Anonymous",
+		Title:      "Ads everywhere",
+		Body:       "An ad after every single level.",
+		Rating:     2,
+		RatedAt:    reviews.Items[1].RatedAt,
+		AppVersion: "1.263.0",
+		VoteSum:    10,
+		VoteCount:  12,
+	}, reviews.Items[1])
+	assert.Equal(t, "ゆうこ", reviews.Items[3].Username)
+	assert.Equal(t, "まあまあです。", reviews.Items[3].Body)
+	assert.Equal(t, time.Date(2023, 12, 3, 15, 12, 40, 0, time.UTC), reviews.Items[0].RatedAt.UTC())
+
+	// single review in the feed and no summary on the HTML page, so it is left unset
+	reviews, err = s.Surf(context.Background(), "https://apps.apple.com/us/app/broken-total/id1?see-all=reviews")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(reviews.Items))
+	assert.Equal(t, "10700000003", reviews.Items[0].ExternalID)
+	assert.Equal(t, ReviewsSummary{}, reviews.ReviewsSummary)
+
+	// no feed, falls back to HTML
+	reviews, err = s.Surf(context.Background(), "https://apps.apple.com/us/app/candy-crush-saga/id999?see-all=reviews")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(reviews.Items))
+	assert.Equal(t, "", reviews.Items[0].AppVersion)
+
+	// no feed and a broken HTML page
+	_, err = s.Surf(context.Background(), "https://apps.apple.com/us/app/broken-bar/id999?see-all=reviews")
+	assert.NotNil(t, err)
 }
 
 func TestSurfGoogleStore(t *testing.T) {
-	s := NewSurfGoogleStore(15) // extract a few for faster tests
-	// will do actual test
-	reviews, err := s.Surf(googleReviewsCandyCrushURL)
+	s := NewSurfGoogleStore(15)
+	s.Transport = newFakeStore(t)
+	reviews, err := s.Surf(context.Background(), googleReviewsCandyCrushURL)
+	assert.Nil(t, err)
+	assert.Equal(t, StoreAndroid, reviews.Store)
+	// second page repeats one review of the first page
+	assert.Equal(t, 4, reviews.Total)
+	assert.Equal(t, 4, len(reviews.Items))
+	assert.Equal(t, Review{
+		ExternalID: "gp:AOqpTOE1",
+		Username:   "Jane Roe",
+		Title:      "Google Play store",
+		Body:       "Sweet game, I play it every day on the train.",
+		Rating:     5,
+		RatedAt:    time.Unix(1701388800, 0),
+		AppVersion: "1.262.0.3",
+		VoteSum:    12,
+	}, reviews.Items[0])
+	assert.Equal(t, "Taro Yamada", reviews.Items[1].Username)
+	assert.Equal(t, 1, reviews.Items[1].Rating)
+	assert.Equal(t, "Sorry to hear that! Please contact our support.", reviews.Items[1].Response)
+	assert.Equal(t, time.Unix(1701475200, 0), reviews.Items[1].RespondedAt)
+	assert.Equal(t, "gp:AOqpTOE3", reviews.Items[2].ExternalID)
+	assert.Equal(t, "Maria Garcia", reviews.Items[3].Username)
+	assert.Equal(t, "Crashes on level 1205 every single time.", reviews.Items[3].Body)
+	assert.Equal(t, 25, reviews.Rating1Percentage)
+	assert.Equal(t, 25, reviews.Rating2Percentage)
+	assert.Equal(t, 0, reviews.Rating3Percentage)
+	assert.Equal(t, 25, reviews.Rating4Percentage)
+	assert.Equal(t, 25, reviews.Rating5Percentage)
+
+	// limited to the first page
+	s = NewSurfGoogleStore(2)
+	s.Transport = newFakeStore(t)
+	reviews, err = s.Surf(context.Background(), googleReviewsCandyCrushURL)
 	assert.Nil(t, err)
-	assert.NotNil(t, reviews)
-	assert.LessOrEqual(t, 15, reviews.Total)            // at least more than this many reviews are there
-	assert.LessOrEqual(t, 1, reviews.Rating1Percentage) // at least more than this many reviews are there
+	assert.Equal(t, 2, reviews.Total)
+	assert.Equal(t, "Jane Roe", reviews.Items[0].Username)
+	assert.Equal(t, "Taro Yamada", reviews.Items[1].Username)
+}
+
+// TestSurfGoogleStoreMatchesLibrary fails when the batchexecute requests of SurfGoogleStore drift from the pinned scraper library
+// The library only calls through http.DefaultClient, so its transport is swapped for the test
+func TestSurfGoogleStoreMatchesLibrary(t *testing.T) {
+	if *updateFixtures {
+		t.Skip("doesn't call the live stores")
+	}
+	ours := &capturingTransport{next: newFakeStore(t)}
+	s := NewSurfGoogleStore(80) // two pages
+	s.Transport = ours
+	_, err := s.Surf(context.Background(), googleReviewsCandyCrushURL)
+	assert.Nil(t, err)
+
+	library := &capturingTransport{next: newFakeStore(t)}
+	transport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = library
+	t.Cleanup(func() { http.DefaultClient.Transport = transport })
+	err = reviewsService.New("com.king.candycrushsaga", reviewsService.Options{Language: "en", Number: 80}).Run()
+	assert.Nil(t, err)
+
+	// the first page and the next page
+	assert.Equal(t, 2, len(library.requests))
+	assert.Equal(t, library.requests, ours.requests)
+}
+
+func TestSurfGoogleStoreErrors(t *testing.T) {
+	s := NewSurfGoogleStore(15)
+	s.Transport = newFakeStore(t)
+
+	reviews, err := s.Surf(context.Background(), "https://play.google.com/store/apps/details?id=com.example.noreviews&hl=en")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, reviews.Total)
+
+	tests := []string{
+		"https://play.google.com/store/apps/details?id=com.example.malformed&hl=en",
+		"https://play.google.com/store/apps/details?id=com.example.notfound&hl=en",
+		"https://play.google.com/store/apps/details?id=com.king.candycrushsaga",
+		"https://example.com/store/apps/details?id=com.king.candycrushsaga&hl=en",
+	}
+	for _, urlStr := range tests {
+		t.Run(urlStr, func(t *testing.T) {
+			_, err := s.Surf(context.Background(), urlStr)
+			assert.NotNil(t, err)
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.Surf(ctx, googleReviewsCandyCrushURL)
+	assert.NotNil(t, err)
 }
@@ -0,0 +1,459 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Events of the templates, a template is named after its event, eg. new_review.html
+const (
+	TemplateNewReview     = "new_review"
+	TemplateUpdatedReview = "updated_review"
+	TemplateRating        = "rating"
+	TemplateError         = "error"
+	TemplateDigest        = "digest"
+)
+
+// Formats of the templates, their file extension, see @TemplateFormat
+const (
+	TemplateFormatHTML = "html"
+	TemplateFormatText = "txt"
+)
+
+// defaultTemplatesFS are the default html templates, the layout of the html message of each event
+//
+//go:embed templates/*.html
+var defaultTemplatesFS embed.FS
+
+// defaultTemplates are the templates of the channels that have none set, see @TemplateNotifier
+var defaultTemplates = func() *Templates {
+	t, err := LoadTemplates("", "")
+	if err != nil {
+		panic(err)
+	}
+	return t
+}()
+
+// TemplateEvents returns the events that have a template
+func TemplateEvents() []string {
+	return []string{TemplateNewReview, TemplateUpdatedReview, TemplateRating, TemplateError, TemplateDigest}
+}
+
+// TemplateFormat returns the format of the templates of the channel
+// html for the channels of the html message, eg. email, none for the webhook whose payload is JSON, and text for the others
+func TemplateFormat(channel string) string {
+	switch channel {
+	case ChannelConsole, ChannelMSTeams, ChannelEmail:
+		return TemplateFormatHTML
+	case ChannelWebhook:
+		return ""
+	}
+	return TemplateFormatText
+}
+
+// TemplateNotifier is a Notifier whose messages are rendered with the templates, see @Templates
+type TemplateNotifier interface {
+	SetTemplates(templates *Templates)
+}
+
+// TemplateData is what a template is executed with, the fields of its event are set
+type TemplateData struct {
+	Event   string
+	AppName string
+	Store   string
+	// URL is where the review is viewed in the store, empty when the channel doesn't know it
+	URL string
+	// Review is of new_review and updated_review, and Revision is the review before the edit
+	Review   ReviewModel
+	Revision ReviewRevisionModel
+	// Current and Previous are the rating summaries of rating, Previous is empty on the first one
+	Current  ReviewCountsModel
+	Previous ReviewCountsModel
+	// Error is of error
+	Error string
+	// Digest is of digest
+	Digest Digest
+}
+
+func newReviewData(review ReviewModel, runURL string) TemplateData {
+	return TemplateData{AppName: review.AppName, Store: review.Store, URL: reviewStoreURL(runURL, review), Review: review}
+}
+
+func updatedReviewData(edit ReviewEdit, runURL string) TemplateData {
+	data := newReviewData(edit.Review, runURL)
+	data.Revision = edit.Revision
+	return data
+}
+
+func ratingData(current, last ReviewCountsModel) TemplateData {
+	return TemplateData{AppName: current.AppName, Store: current.Store, Current: current, Previous: last}
+}
+
+func errorData(appName, store string, err error) TemplateData {
+	return TemplateData{AppName: appName, Store: store, Error: err.Error()}
+}
+
+func digestData(digest Digest) TemplateData {
+	return TemplateData{AppName: digest.AppName, Store: digest.Store, Digest: digest}
+}
+
+// NewTemplateData returns the data of the event about the stored review, as it is notified, eg. for a preview
+// updated_review is of the last edit of the review, rating of the last rating summary of its app on its store
+// error is of a sample error, and digest is of the daily digest of its app on its store
+func NewTemplateData(event string, review ReviewModel) (TemplateData, error) {
+	repo := NewReviewsRepository()
+	switch event {
+	case TemplateNewReview:
+		return newReviewData(review, ""), nil
+	case TemplateUpdatedReview:
+		revisions, err := repo.FindReviewRevisions(review.ID)
+		if err != nil {
+			return TemplateData{}, err
+		}
+		if len(revisions) == 0 {
+			return TemplateData{}, fmt.Errorf("[error] review %d was never edited", review.ID)
+		}
+		return updatedReviewData(ReviewEdit{Review: review, Revision: revisions[len(revisions)-1]}, ""), nil
+	case TemplateRating:
+		current, err := repo.FindReviewCountAt(review.AppName, review.Store, time.Now())
+		if err != nil {
+			return TemplateData{}, err
+		}
+		if current.ID == 0 {
+			return TemplateData{}, fmt.Errorf("[error] %s on %s has no rating", review.AppName, review.Store)
+		}
+		last := ReviewCountsModel{}
+		if current.CreatedAt != nil {
+			last, err = repo.FindReviewCountAt(review.AppName, review.Store, current.CreatedAt.Add(-time.Second))
+			if err != nil {
+				return TemplateData{}, err
+			}
+		}
+		return ratingData(current, last), nil
+	case TemplateError:
+		return errorData(review.AppName, review.Store, fmt.Errorf("[error] unable to scrape %s on %s: sample error", review.AppName, review.Store)), nil
+	case TemplateDigest:
+		digest, err := NewDigest(review.AppName, review.Store, DigestDaily, time.Now())
+		if err != nil {
+			return TemplateData{}, err
+		}
+		return digestData(digest), nil
+	}
+	return TemplateData{}, fmt.Errorf("[error] unknown template event %s, use one of %s", event, strings.Join(TemplateEvents(), ", "))
+}
+
+// Rendered is a notification rendered by a template, see @Templates.Render
+type Rendered struct {
+	Title    string
+	Subtitle string
+	Subject  string
+	Body     string
+}
+
+// Templates are the templates of the notifications, html/template for the html channels, and text/template for the others
+// A template is the body of the notification, and it can define the title, subtitle and subject
+// eg. {{define "title"}}New {{stars .Review.Rating}} review{{end}}
+// Loaded from a dir, <channel>/<event>.<format> is used on the channel, and <event>.<format> on all the channels of the format
+// eg. slack/new_review.txt and new_review.html
+// Without a template of the event, the html channels use the default, the current layout, and the text channels their own layout
+type Templates struct {
+	// Dir is where the templates are loaded from, empty for the defaults only
+	Dir string
+	// Location is the time zone of the dates, nil keeps the time zone of each date
+	Location *time.Location
+
+	// templates are by their path in Dir, eg. slack/new_review.txt
+	templates map[string]parsedTemplate
+}
+
+// parsedTemplate is a parsed html or text template, with the names of the templates it defines
+type parsedTemplate struct {
+	html bool
+	// custom is loaded from Dir, not a default
+	custom  bool
+	defined map[string]bool
+	execute func(w io.Writer, name string, data interface{}) error
+}
+
+// LoadTemplates loads the templates of the dir over the defaults, with the dates in the time zone, eg. Asia/Tokyo
+// An empty dir is the defaults only, and an empty time zone keeps the time zone of each date
+func LoadTemplates(dir, timezone string) (*Templates, error) {
+	t := &Templates{Dir: dir, templates: map[string]parsedTemplate{}}
+	if timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("[error] unknown time zone %s, eg. Asia/Tokyo: %w", timezone, err)
+		}
+		t.Location = location
+	}
+	for _, event := range TemplateEvents() {
+		b, err := defaultTemplatesFS.ReadFile("templates/" + event + ".html")
+		if err != nil {
+			return nil, err
+		}
+		if err := t.parse(event+"."+TemplateFormatHTML, string(b), false); err != nil {
+			return nil, err
+		}
+	}
+	if dir == "" {
+		return t, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("[error] unable to read the templates: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			if err := t.load(entry.Name(), ""); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		channel := entry.Name()
+		if !slices.Contains(Channels(), channel) || TemplateFormat(channel) == "" {
+			return nil, fmt.Errorf("[error] templates of unknown channel %s, use one of %s", channel, strings.Join(templateChannels(), ", "))
+		}
+		files, err := os.ReadDir(filepath.Join(dir, channel))
+		if err != nil {
+			return nil, fmt.Errorf("[error] unable to read the templates: %w", err)
+		}
+		for _, file := range files {
+			if !file.IsDir() {
+				if err := t.load(file.Name(), channel); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+// load parses the template file of the channel in Dir, empty channel for all the channels
+// Files that aren't .html nor .txt are skipped, eg. a README
+func (t *Templates) load(name, channel string) error {
+	format := strings.TrimPrefix(filepath.Ext(name), ".")
+	if format != TemplateFormatHTML && format != TemplateFormatText {
+		return nil
+	}
+	event := strings.TrimSuffix(name, "."+format)
+	path := name
+	if channel != "" {
+		path = channel + "/" + name
+		if format != TemplateFormat(channel) {
+			return fmt.Errorf("[error] templates of %s are .%s, not %s", channel, TemplateFormat(channel), path)
+		}
+	}
+	if !slices.Contains(TemplateEvents(), event) {
+		return fmt.Errorf("[error] template %s is of unknown event %s, use one of %s", path, event, strings.Join(TemplateEvents(), ", "))
+	}
+	b, err := os.ReadFile(filepath.Join(t.Dir, path))
+	if err != nil {
+		return fmt.Errorf("[error] unable to read template %s: %w", path, err)
+	}
+	return t.parse(path, string(b), true)
+}
+
+// parse parses the template of the path, html/template for .html and text/template for .txt
+func (t *Templates) parse(path, src string, custom bool) error {
+	parsed := parsedTemplate{custom: custom, defined: map[string]bool{}}
+	if strings.HasSuffix(path, "."+TemplateFormatHTML) {
+		tmpl, err := htmltemplate.New(path).Funcs(htmltemplate.FuncMap(t.funcs())).Parse(src)
+		if err != nil {
+			return fmt.Errorf("[error] unable to parse template %s: %w", path, err)
+		}
+		for _, defined := range tmpl.Templates() {
+			parsed.defined[defined.Name()] = true
+		}
+		parsed.html = true
+		parsed.execute = tmpl.ExecuteTemplate
+	} else {
+		tmpl, err := texttemplate.New(path).Funcs(texttemplate.FuncMap(t.funcs())).Parse(src)
+		if err != nil {
+			return fmt.Errorf("[error] unable to parse template %s: %w", path, err)
+		}
+		for _, defined := range tmpl.Templates() {
+			parsed.defined[defined.Name()] = true
+		}
+		parsed.execute = tmpl.ExecuteTemplate
+	}
+	t.templates[path] = parsed
+	return nil
+}
+
+// custom returns whether the channel has a template of the event loaded from Dir
+func (t *Templates) custom(channel, event string) bool {
+	if t == nil {
+		return false
+	}
+	format := TemplateFormat(channel)
+	return t.templates[channel+"/"+event+"."+format].custom || t.templates[event+"."+format].custom
+}
+
+// Render renders the event for the channel, with the template of the channel, or of all the channels of its format
+// ok is false when there is no template, and the channel uses its own layout, eg. a text channel without templates
+// The title, subtitle and subject that the template doesn't define are the defaults, eg. You have a new review!
+func (t *Templates) Render(channel, event string, data TemplateData) (Rendered, bool, error) {
+	if t == nil {
+		t = defaultTemplates
+	}
+	data.Event = event
+	rendered := Rendered{
+		Title:    templateTitle(data),
+		Subtitle: "Store (" + data.Store + ")",
+		Subject:  "App (" + data.AppName + ")",
+	}
+	if !slices.Contains(TemplateEvents(), event) {
+		return rendered, false, fmt.Errorf("[error] unknown template event %s, use one of %s", event, strings.Join(TemplateEvents(), ", "))
+	}
+	format := TemplateFormat(channel)
+	if format == "" {
+		return rendered, false, nil
+	}
+	path := channel + "/" + event + "." + format
+	tmpl, ok := t.templates[path]
+	if !ok {
+		path = event + "." + format
+		tmpl, ok = t.templates[path]
+	}
+	if !ok {
+		return rendered, false, nil
+	}
+
+	for name, field := range map[string]*string{"title": &rendered.Title, "subtitle": &rendered.Subtitle, "subject": &rendered.Subject} {
+		if !tmpl.defined[name] {
+			continue
+		}
+		b := &bytes.Buffer{}
+		if err := tmpl.execute(b, name, data); err != nil {
+			return rendered, false, fmt.Errorf("[error] template %s failed: %w", path, err)
+		}
+		*field = strings.TrimSpace(b.String())
+		if tmpl.html {
+			// the title is text, eg. the subject of the email
+			*field = html.UnescapeString(*field)
+		}
+	}
+	b := &bytes.Buffer{}
+	if err := tmpl.execute(b, path, data); err != nil {
+		return rendered, false, fmt.Errorf("[error] template %s failed: %w", path, err)
+	}
+	rendered.Body = strings.TrimSpace(b.String())
+	return rendered, true, nil
+}
+
+// funcs are the helpers of the templates
+// eg. {{stars .Review.Rating}}, {{.Review.Body | truncate 200}} and {{date "2006-01-02 15:04" .Review.RatedAt}}
+func (t *Templates) funcs() map[string]interface{} {
+	uu := NewUtils()
+	return map[string]interface{}{
+		"stars": stars,
+		"truncate": func(limit int, text string) string {
+			return truncate(text, max(limit, 1))
+		},
+		"date":     t.date,
+		"diff":     uu.DiffWords,
+		"average":  uu.AverageRating,
+		"markdown": escapeMarkdown,
+		"lines": func(text string) []string {
+			return strings.Split(text, "\n")
+		},
+	}
+}
+
+// date formats the time.Time or *time.Time in the layout, in the Location when it is set
+func (t *Templates) date(layout string, value interface{}) (string, error) {
+	var at time.Time
+	switch v := value.(type) {
+	case time.Time:
+		at = v
+	case *time.Time:
+		if v == nil {
+			return "", nil
+		}
+		at = *v
+	default:
+		return "", fmt.Errorf("[error] date of %T, it isn't a time", value)
+	}
+	if t.Location != nil {
+		at = at.In(t.Location)
+	}
+	return at.Format(layout), nil
+}
+
+// templateTitle is the default title of the event
+func templateTitle(data TemplateData) string {
+	switch data.Event {
+	case TemplateNewReview:
+		return "You have a new review!"
+	case TemplateUpdatedReview:
+		return "A review was updated!"
+	case TemplateRating:
+		return "You have a new rating!"
+	case TemplateError:
+		return "Scraping reviews failed!"
+	case TemplateDigest:
+		return data.Digest.Title()
+	}
+	return ""
+}
+
+// templateChannels are the registered channels that have templates
+func templateChannels() []string {
+	names := []string{}
+	for _, channel := range Channels() {
+		if TemplateFormat(channel) != "" {
+			names = append(names, channel)
+		}
+	}
+	return names
+}
+
+// templated keeps the templates of a channel, see @TemplateNotifier
+type templated struct {
+	templates *Templates
+}
+
+// SetTemplates see @TemplateNotifier
+func (t *templated) SetTemplates(templates *Templates) {
+	t.templates = templates
+}
+
+// message renders the event as the html message of the channel, see @Templates.Render
+func (t *templated) message(channel, event string, data TemplateData) (notifyMessage, error) {
+	rendered, _, err := t.templates.Render(channel, event, data)
+	return notifyMessage{
+		Title:    rendered.Title,
+		Subtitle: rendered.Subtitle,
+		Subject:  rendered.Subject,
+		HTML:     rendered.Body,
+	}, err
+}
+
+// chat replaces the content with the template of the event, when the channel has one
+// Its title and text are of the template, and the rating and the url are kept, eg. for the color of Discord
+func (t *templated) chat(channel, event string, data TemplateData, content chatContent) (chatContent, error) {
+	rendered, ok, err := t.templates.Render(channel, event, data)
+	if err != nil || !ok {
+		return content, err
+	}
+	return chatContent{
+		Title:   rendered.Title,
+		AppName: content.AppName,
+		Store:   content.Store,
+		Rating:  content.Rating,
+		IsError: content.IsError,
+		URL:     content.URL,
+		Text:    rendered.Body,
+	}, nil
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTemplates writes the templates by their path in a new dir, eg. slack/new_review.txt
+func writeTemplates(t *testing.T, templates map[string]string) string {
+	dir := t.TempDir()
+	for path, content := range templates {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0o755))
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, path), []byte(content), 0o644))
+	}
+	return dir
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	review := testChatReview()
+	rendered, ok, err := defaultTemplates.Render(ChannelMSTeams, TemplateNewReview, newReviewData(review, ""))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "You have a new review!", rendered.Title)
+	assert.Equal(t, "Store (android)", rendered.Subtitle)
+	assert.Equal(t, "App (candy-crush)", rendered.Subject)
+	assert.Contains(t, rendered.Body, "<h2>Love *it*</h2>")
+	assert.Contains(t, rendered.Body, "<h4>01-May-2024</h4>")
+	assert.Contains(t, rendered.Body, "<h5>Rating ★★☆☆☆</h5>")
+	assert.Contains(t, rendered.Body, "<p>So &lt;sweet&gt;</p>")
+
+	revision := ReviewRevisionModel{Title: "Hate it", Body: "So sour", Rating: 1, RatedAt: review.RatedAt}
+	rendered, _, err = defaultTemplates.Render(ChannelEmail, TemplateUpdatedReview, updatedReviewData(ReviewEdit{Review: review, Revision: revision}, ""))
+	assert.Nil(t, err)
+	assert.Equal(t, "A review was updated!", rendered.Title)
+	assert.Contains(t, rendered.Body, "Rating ★☆☆☆☆ → ★★☆☆☆")
+	assert.Contains(t, rendered.Body, "<p>Title: [-Hate it-] {&#43;Love *it*&#43;}</p>")
+	assert.Contains(t, rendered.Body, "<p>So [-sour-] {&#43;&lt;sweet&gt;&#43;}</p>")
+
+	current := ReviewCountsModel{AppName: "candy-crush", Store: StoreAndroid, Total: 10, Rating5Percentage: 100, CreatedAt: review.RatedAt}
+	rendered, _, err = defaultTemplates.Render(ChannelConsole, TemplateRating, ratingData(current, ReviewCountsModel{}))
+	assert.Nil(t, err)
+	assert.Equal(t, "You have a new rating!", rendered.Title)
+	assert.Contains(t, rendered.Body, "<b>Now </b>01-May-2024<br>")
+	assert.Contains(t, rendered.Body, "Average rating: 5.00<br>")
+	assert.Contains(t, rendered.Body, "★★★★★: 100%<br>")
+	assert.NotContains(t, rendered.Body, "Before")
+	rendered, _, err = defaultTemplates.Render(ChannelConsole, TemplateRating, ratingData(current, current))
+	assert.Nil(t, err)
+	assert.Contains(t, rendered.Body, "<b>Before </b>01-May-2024<br>")
+
+	rendered, _, err = defaultTemplates.Render(ChannelConsole, TemplateError, errorData("candy-crush", StoreAndroid, errors.New("[error] <timeout>\nretrying")))
+	assert.Nil(t, err)
+	assert.Equal(t, "Scraping reviews failed!", rendered.Title)
+	assert.Equal(t, "<p>[error] &lt;timeout&gt;</p><br>\n<p>retrying</p><br>", rendered.Body)
+
+	// the text channels have their own layout, and the webhook sends JSON
+	_, ok, err = defaultTemplates.Render(ChannelSlack, TemplateNewReview, newReviewData(review, ""))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, ok, err = defaultTemplates.Render(ChannelWebhook, TemplateNewReview, newReviewData(review, ""))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, _, err = defaultTemplates.Render(ChannelConsole, "new_rating", newReviewData(review, ""))
+	assert.NotNil(t, err)
+
+	// a nil Templates is the defaults
+	var templates *Templates
+	_, ok, err = templates.Render(ChannelEmail, TemplateNewReview, newReviewData(review, ""))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestLoadTemplates(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"new_review.html":         `{{define "title"}}New {{stars .Review.Rating}} review & more{{end}}<p>{{.Review.Body | truncate 4}}</p>`,
+		"msteams/new_review.html": `<p>{{date "2006-01-02 15:04" .Review.RatedAt}}</p>`,
+		"new_review.txt":          `{{markdown .Review.Title}} by @{{.Review.Username}} {{.URL}}`,
+		"slack/error.txt":         `{{define "subject"}}{{.AppName}}{{end}}{{range lines .Error}}> {{.}}{{end}}`,
+		"README.md":               "the templates of the notifications",
+	})
+	templates, err := LoadTemplates(dir, "Asia/Tokyo")
+	assert.Nil(t, err)
+	review := testChatReview()
+
+	rendered, ok, err := templates.Render(ChannelEmail, TemplateNewReview, newReviewData(review, ""))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "New ★★☆☆☆ review & more", rendered.Title)
+	assert.Equal(t, "App (candy-crush)", rendered.Subject)
+	assert.Equal(t, "<p>So …</p>", rendered.Body)
+	assert.True(t, templates.custom(ChannelEmail, TemplateNewReview))
+	assert.False(t, templates.custom(ChannelEmail, TemplateDigest))
+
+	// the template of the channel, with the date in the time zone
+	rendered, _, err = templates.Render(ChannelMSTeams, TemplateNewReview, newReviewData(review, ""))
+	assert.Nil(t, err)
+	assert.Equal(t, "You have a new review!", rendered.Title)
+	assert.Equal(t, "<p>2024-05-01 09:00</p>", rendered.Body)
+
+	// the defaults of the other events
+	rendered, _, err = templates.Render(ChannelMSTeams, TemplateError, errorData("candy-crush", StoreAndroid, errors.New("timeout")))
+	assert.Nil(t, err)
+	assert.Equal(t, "<p>timeout</p><br>", rendered.Body)
+
+	// the text templates of the text channels aren't escaped
+	rendered, ok, err = templates.Render(ChannelDiscord, TemplateNewReview, newReviewData(review, "https://play.google.com/store/apps/details?id=com.king.candycrushsaga"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, `Love \*it\* by @sugar https://play.google.com/store/apps/details?id=com.king.candycrushsaga&reviewId=gp%3Aabc`, rendered.Body)
+	rendered, ok, err = templates.Render(ChannelSlack, TemplateError, errorData("candy-crush", StoreAndroid, errors.New("<timeout>")))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "candy-crush", rendered.Subject)
+	assert.Equal(t, "> <timeout>", rendered.Body)
+	_, ok, err = templates.Render(ChannelDiscord, TemplateError, errorData("candy-crush", StoreAndroid, errors.New("timeout")))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestLoadTemplatesError(t *testing.T) {
+	for name, tc := range map[string]struct {
+		templates map[string]string
+		timezone  string
+		err       string
+	}{
+		"unknown event":    {templates: map[string]string{"new_reviews.html": "x"}, err: "unknown event new_reviews"},
+		"unknown channel":  {templates: map[string]string{"teams/new_review.html": "x"}, err: "unknown channel teams"},
+		"webhook":          {templates: map[string]string{"webhook/new_review.txt": "x"}, err: "unknown channel webhook"},
+		"format":           {templates: map[string]string{"slack/new_review.html": "x"}, err: "templates of slack are .txt"},
+		"parse":            {templates: map[string]string{"new_review.txt": "{{.Review.Title"}, err: "unable to parse template new_review.txt"},
+		"unknown timezone": {timezone: "Mars/Olympus", err: "unknown time zone Mars/Olympus"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadTemplates(writeTemplates(t, tc.templates), tc.timezone)
+			assert.NotNil(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+
+	_, err := LoadTemplates(filepath.Join(t.TempDir(), "missing"), "")
+	assert.NotNil(t, err)
+
+	// a template that fails is an error of the notification
+	templates, err := LoadTemplates(writeTemplates(t, map[string]string{"new_review.txt": "{{date \"2006\" .Review.Title}}"}), "")
+	assert.Nil(t, err)
+	_, _, err = templates.Render(ChannelDiscord, TemplateNewReview, newReviewData(testChatReview(), ""))
+	assert.NotNil(t, err)
+}
+
+func TestTemplatesOfNotifiers(t *testing.T) {
+	server := newChatServer(t, http.StatusNoContent, "")
+	templates, err := LoadTemplates(writeTemplates(t, map[string]string{
+		"new_review.txt": `{{define "title"}}{{stars .Review.Rating}} {{.Review.Title}}{{end}}{{.Review.Body}}`,
+	}), "")
+	assert.Nil(t, err)
+
+	d := NewDiscordNotifier(server.URL)
+	d.SetTemplates(templates)
+	assert.Nil(t, d.NotifyNewReview(testChatReview()))
+	embed := server.last(t)["embeds"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "★★☆☆☆ Love *it*", embed["title"])
+	assert.Equal(t, "So <sweet>", embed["description"])
+	assert.Equal(t, float64(discordColorBad), embed["color"])
+
+	// the events without a template have the layout of the channel
+	now := time.Now()
+	assert.Nil(t, d.NotifyReviewCount(ReviewCountsModel{AppName: "candy-crush", Store: StoreAndroid, Total: 1, CreatedAt: &now}, ReviewCountsModel{}))
+	embed = server.last(t)["embeds"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "You have a new rating!", embed["title"])
+	assert.NotEmpty(t, embed["fields"])
+}
+
+func TestNewTemplateData(t *testing.T) {
+	repo := NewReviewsRepository()
+	now := time.Now()
+	reviews := Reviews{
+		AppName:        "app-templates",
+		Store:          StoreAndroid,
+		Items:          []Review{{ExternalID: "1", Username: "a", Title: "Fun", Body: "Fun levels", Rating: 5, RatedAt: now.Add(-time.Hour)}},
+		ReviewsSummary: ReviewsSummary{Total: 10, Rating5Percentage: 100},
+	}
+	found, _, err := repo.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(found))
+	review := found[0]
+
+	data, err := NewTemplateData(TemplateNewReview, review)
+	assert.Nil(t, err)
+	assert.Equal(t, "app-templates", data.AppName)
+	assert.Equal(t, "Fun", data.Review.Title)
+
+	// never edited, and no rating yet
+	_, err = NewTemplateData(TemplateUpdatedReview, review)
+	assert.NotNil(t, err)
+	_, err = NewTemplateData(TemplateRating, review)
+	assert.NotNil(t, err)
+
+	reviews.Items[0].Body = "Fun levels, too many ads"
+	reviews.Items[0].Rating = 3
+	_, edits, err := repo.FindOrNewReviews(reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(edits))
+	data, err = NewTemplateData(TemplateUpdatedReview, edits[0].Review)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, data.Revision.Rating)
+	assert.Equal(t, 3, data.Review.Rating)
+
+	_, err = repo.InsertReviewCount(reviews)
+	assert.Nil(t, err)
+	data, err = NewTemplateData(TemplateRating, review)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, data.Current.Total)
+	assert.Equal(t, 0, data.Previous.Total)
+
+	data, err = NewTemplateData(TemplateError, review)
+	assert.Nil(t, err)
+	assert.Contains(t, data.Error, "sample error")
+	data, err = NewTemplateData(TemplateDigest, review)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, data.Digest.Total)
+
+	_, err = NewTemplateData("new_rating", review)
+	assert.NotNil(t, err)
+}
@@ -1,12 +1,18 @@
 package services
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"math"
 	"net/url"
 	"strings"
+	"time"
 )
 
+// hashExternalIDPrefix is the prefix of external_id for the reviews scraped without the store's review ID
+const hashExternalIDPrefix = "hash-"
+
 type Utils struct {
 }
 
@@ -14,40 +20,20 @@ func NewUtils() *Utils {
 	return &Utils{}
 }
 
-const (
-	// StoreIOS is the store name for iOS
-	StoreIOS = "ios"
-	// AppStoreHost is the hostname for the App Store
-	AppStoreHost = "apps.apple.com"
-
-	// StoreAndroid is the store name for Android
-	StoreAndroid = "android"
-	// PlayStoreHost is the hostname for the Play Store
-	PlayStoreHost = "play.google.com"
-)
-
 // GetStoreFromURL returns the store name from the given URL
-// The store name is one of the following:
+// The store name is one of the registered scrapers, see @RegisterScraper
 // - ios
 // - android
 // - ""
 // - error
 // The error is returned when the URL is not valid
-// The error is returned when the URL is not a valid App Store URL
-// The error is returned when the URL is not a valid Play Store URL
+// The error is returned when the URL doesn't match any registered store
 func (ut *Utils) GetStoreFromURL(urlStr string) (string, error) {
-	u, err := url.Parse(urlStr)
+	scraper, err := FindScraper(urlStr)
 	if err != nil {
 		return "", err
 	}
-
-	if strings.HasPrefix(u.Host, AppStoreHost) {
-		return StoreIOS, nil
-	}
-	if strings.HasPrefix(u.Host, PlayStoreHost) {
-		return StoreAndroid, nil
-	}
-	return "", fmt.Errorf("[error] Unable to fetch store from the given Review URL %s", urlStr)
+	return scraper.Store(), nil
 }
 
 // GetAppInfoGoogle returns the app info from the given Google Play URL
@@ -86,6 +72,109 @@ func (ut *Utils) GetAppInfoGoogle(urlStr string) (string, string, error) {
 	return id, language, nil
 }
 
+// GetAppInfoApple returns the app info from the given App Store URL
+// The app info is one of the following:
+// - id, country, nil
+// - "", "", error
+//
+// urlStr = https://apps.apple.com/us/app/candy-crush-saga/id553834731?see-all=reviews
+// id returned as 553834731
+// country returned as us, which defaults to us when the URL has no country
+//
+// The error is returned when the URL is not valid
+// The error is returned when the URL is not a valid App Store URL
+func (ut *Utils) GetAppInfoApple(urlStr string) (string, string, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "", "", err
+	}
+	if !strings.HasPrefix(u.Host, AppStoreHost) {
+		return "", "", fmt.Errorf("[error] Unable to fetch store from the given Review URL %s", urlStr)
+	}
+
+	country := "us"
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) > 0 && len(parts[0]) == 2 {
+		country = parts[0]
+	}
+	last := parts[len(parts)-1]
+	if !strings.HasPrefix(last, "id") || len(last) == 2 {
+		return "", "", fmt.Errorf("[error] Unable to fetch app ID from the given Review URL %s", urlStr)
+	}
+	return strings.TrimPrefix(last, "id"), country, nil
+}
+
+// SetAppleCountry returns the App Store URL for the given country
+// urlStr = https://apps.apple.com/us/app/candy-crush-saga/id553834731?see-all=reviews
+// country = jp
+// returned as https://apps.apple.com/jp/app/candy-crush-saga/id553834731?see-all=reviews
+// The country is added to the URL without a country
+func (ut *Utils) SetAppleCountry(urlStr, country string) (string, error) {
+	if _, _, err := ut.GetAppInfoApple(urlStr); err != nil {
+		return "", err
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts[0]) == 2 {
+		parts = parts[1:]
+	}
+	u.Path = "/" + strings.ToLower(country) + "/" + strings.Join(parts, "/")
+	return u.String(), nil
+}
+
+// SetGoogleLanguage returns the Play Store URL for the given language
+// urlStr = https://play.google.com/store/apps/details?id=com.king.candycrushsaga&hl=en&gl=US
+// language = ja
+// returned as https://play.google.com/store/apps/details?gl=US&hl=ja&id=com.king.candycrushsaga
+func (ut *Utils) SetGoogleLanguage(urlStr, language string) (string, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(u.Host, PlayStoreHost) {
+		return "", fmt.Errorf("[error] Unable to fetch store from the given Review URL %s", urlStr)
+	}
+	queries := u.Query()
+	queries.Set("hl", language)
+	u.RawQuery = queries.Encode()
+	return u.String(), nil
+}
+
+// GetLocale returns the country and the language of the reviews page
+// urlStr = https://apps.apple.com/jp/app/candy-crush-saga/id553834731?see-all=reviews
+// returned as jp, ""
+// urlStr = https://play.google.com/store/apps/details?id=com.king.candycrushsaga&hl=en&gl=US
+// returned as us, en
+// Both are empty when the URL isn't of a store
+func (ut *Utils) GetLocale(urlStr string) (string, string) {
+	if _, country, err := ut.GetAppInfoApple(urlStr); err == nil {
+		return country, ""
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil || !strings.HasPrefix(u.Host, PlayStoreHost) {
+		return "", ""
+	}
+	queries := u.Query()
+	return strings.ToLower(queries.Get("gl")), queries.Get("hl")
+}
+
+// Stars returns the rating as stars, as in the notifications
+// E.g 3 is ★★★☆☆
+func (ut *Utils) Stars(rating int) string {
+	return stars(rating)
+}
+
+// ReviewExternalID returns the ID for a review scraped without the store's review ID
+// It is a hash of username and the rating date, so the same review gets the same ID on every scrape
+// E.g hash-3f2a9c0b1d4e5f6a7b8c
+func (ut *Utils) ReviewExternalID(username string, ratedAt time.Time) string {
+	sum := sha1.Sum([]byte(username + "|" + ratedAt.UTC().Format(time.RFC3339)))
+	return hashExternalIDPrefix + hex.EncodeToString(sum[:])[:20]
+}
+
 // CalculateRoundedPercentage returns the rounded percentage
 // E.g 127/999 x 100 = 12.71%, rounded to int is 13
 // E.g 123/999 x 100 = 12.31%, rounded to int is 12
@@ -118,3 +207,58 @@ func (ut *Utils) AverageRating(reviewCounts ReviewCountsModel) float64 {
 			float64(reviewCounts.Rating5Percentage))
 	return avg
 }
+
+// DiffWords returns a word by word diff of the two texts, in the format of git diff --word-diff
+// Removed words are in [-...-] and added words are in {+...+}, the whitespace is normalised
+// E.g DiffWords("great game", "great game, too many ads") is "great [-game-] {+game, too many ads+}"
+func (ut *Utils) DiffWords(oldText, newText string) string {
+	oldWords := strings.Fields(oldText)
+	newWords := strings.Fields(newText)
+
+	// lcs[i][j] is the length of the longest common subsequence of oldWords[i:] and newWords[j:]
+	lcs := make([][]int, len(oldWords)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newWords)+1)
+	}
+	for i := len(oldWords) - 1; i >= 0; i-- {
+		for j := len(newWords) - 1; j >= 0; j-- {
+			if oldWords[i] == newWords[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	parts := []string{}
+	removed := []string{}
+	added := []string{}
+	flush := func() {
+		if len(removed) > 0 {
+			parts = append(parts, "[-"+strings.Join(removed, " ")+"-]")
+			removed = removed[:0]
+		}
+		if len(added) > 0 {
+			parts = append(parts, "{+"+strings.Join(added, " ")+"+}")
+			added = added[:0]
+		}
+	}
+	i, j := 0, 0
+	for i < len(oldWords) || j < len(newWords) {
+		switch {
+		case i < len(oldWords) && j < len(newWords) && oldWords[i] == newWords[j]:
+			flush()
+			parts = append(parts, oldWords[i])
+			i++
+			j++
+		case j >= len(newWords) || (i < len(oldWords) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, oldWords[i])
+			i++
+		default:
+			added = append(added, newWords[j])
+			j++
+		}
+	}
+	flush()
+	return strings.Join(parts, " ")
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -125,6 +126,177 @@ func TestGetAppInfoGoogle(t *testing.T) {
 	}
 }
 
+func TestGetAppInfoApple(t *testing.T) {
+	uu := NewUtils()
+	tests := []struct {
+		urlStr      string
+		idWant      string
+		countryWant string
+		errWant     error
+	}{
+		{
+			urlStr:      "https://apps.apple.com/us/app/candy-crush-saga/id553834731?see-all=reviews",
+			idWant:      "553834731",
+			countryWant: "us",
+			errWant:     nil,
+		},
+		{
+			urlStr:      "https://apps.apple.com/jp/app/candy-crush-saga/id553834731",
+			idWant:      "553834731",
+			countryWant: "jp",
+			errWant:     nil,
+		},
+		{
+			urlStr:      "https://apps.apple.com/app/candy-crush-saga/id553834731",
+			idWant:      "553834731",
+			countryWant: "us",
+			errWant:     nil,
+		},
+		// no app id, bad urls following
+		{
+			urlStr:  "https://apps.apple.com/us/app/candy-crush-saga",
+			errWant: fmt.Errorf("error"),
+		},
+		{
+			urlStr:  "https://play.google.com/store/apps/details?id=com.king.candycrushsaga&hl=en&gl=US",
+			errWant: fmt.Errorf("error"),
+		},
+		{
+			urlStr:  "apps.apple.com/us/app/candy-crush-saga/id553834731",
+			errWant: fmt.Errorf("error"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.urlStr, func(t *testing.T) {
+			id, country, err := uu.GetAppInfoApple(test.urlStr)
+			assert.Equal(t, test.idWant, id)
+			assert.Equal(t, test.countryWant, country)
+			if test.errWant != nil {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestSetAppleCountry(t *testing.T) {
+	uu := NewUtils()
+	tests := []struct {
+		urlStr  string
+		country string
+		urlWant string
+	}{
+		{
+			urlStr:  "https://apps.apple.com/us/app/candy-crush-saga/id553834731?see-all=reviews",
+			country: "jp",
+			urlWant: "https://apps.apple.com/jp/app/candy-crush-saga/id553834731?see-all=reviews",
+		},
+		{
+			urlStr:  "https://apps.apple.com/app/candy-crush-saga/id553834731",
+			country: "GB",
+			urlWant: "https://apps.apple.com/gb/app/candy-crush-saga/id553834731",
+		},
+		// bad urls following
+		{
+			urlStr:  "https://play.google.com/store/apps/details?id=com.king.candycrushsaga&hl=en&gl=US",
+			country: "jp",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.urlStr, func(t *testing.T) {
+			urlStr, err := uu.SetAppleCountry(test.urlStr, test.country)
+			assert.Equal(t, test.urlWant, urlStr)
+			assert.Equal(t, test.urlWant == "", err != nil)
+		})
+	}
+}
+
+func TestSetGoogleLanguage(t *testing.T) {
+	uu := NewUtils()
+	tests := []struct {
+		urlStr   string
+		language string
+		urlWant  string
+	}{
+		{
+			urlStr:   "https://play.google.com/store/apps/details?id=com.king.candycrushsaga&hl=en&gl=US",
+			language: "ja",
+			urlWant:  "https://play.google.com/store/apps/details?gl=US&hl=ja&id=com.king.candycrushsaga",
+		},
+		{
+			urlStr:   "https://play.google.com/store/apps/details?id=com.king.candycrushsaga",
+			language: "en",
+			urlWant:  "https://play.google.com/store/apps/details?hl=en&id=com.king.candycrushsaga",
+		},
+		// bad urls following
+		{
+			urlStr:   "https://apps.apple.com/us/app/candy-crush-saga/id553834731?see-all=reviews",
+			language: "ja",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.urlStr, func(t *testing.T) {
+			urlStr, err := uu.SetGoogleLanguage(test.urlStr, test.language)
+			assert.Equal(t, test.urlWant, urlStr)
+			assert.Equal(t, test.urlWant == "", err != nil)
+		})
+	}
+}
+
+func TestGetLocale(t *testing.T) {
+	uu := NewUtils()
+	tests := []struct {
+		urlStr       string
+		countryWant  string
+		languageWant string
+	}{
+		{
+			urlStr:      "https://apps.apple.com/jp/app/candy-crush-saga/id553834731?see-all=reviews",
+			countryWant: "jp",
+		},
+		{
+			urlStr:      "https://apps.apple.com/app/candy-crush-saga/id553834731",
+			countryWant: "us",
+		},
+		{
+			urlStr:       "https://play.google.com/store/apps/details?id=com.king.candycrushsaga&hl=en&gl=US",
+			countryWant:  "us",
+			languageWant: "en",
+		},
+		{
+			urlStr:       "https://play.google.com/store/apps/details?id=com.king.candycrushsaga&hl=ja",
+			languageWant: "ja",
+		},
+		// not a store
+		{
+			urlStr: "https://example.com/us/app/id553834731",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.urlStr, func(t *testing.T) {
+			country, language := uu.GetLocale(test.urlStr)
+			assert.Equal(t, test.countryWant, country)
+			assert.Equal(t, test.languageWant, language)
+		})
+	}
+}
+
+func TestStars(t *testing.T) {
+	uu := NewUtils()
+	assert.Equal(t, "★★★☆☆", uu.Stars(3))
+	assert.Equal(t, "☆☆☆☆☆", uu.Stars(0))
+	assert.Equal(t, "★★★★★", uu.Stars(6))
+}
+
+func TestReviewExternalID(t *testing.T) {
+	uu := NewUtils()
+	now := time.Now()
+	id := uu.ReviewExternalID("username", now)
+	assert.Equal(t, 25, len(id))
+	assert.Equal(t, id, uu.ReviewExternalID("username", now.In(time.FixedZone("JST", 9*60*60))))
+	assert.NotEqual(t, id, uu.ReviewExternalID("username2", now))
+	assert.NotEqual(t, id, uu.ReviewExternalID("username", now.Add(time.Second)))
+}
+
 func TestCalculateRoundedPercentage(t *testing.T) {
 	uu := NewUtils()
 	tests := []struct {
@@ -231,3 +403,43 @@ func TestAverageRating(t *testing.T) {
 		})
 	}
 }
+
+func TestDiffWords(t *testing.T) {
+	uu := NewUtils()
+	tests := []struct {
+		oldText  string
+		newText  string
+		wantDiff string
+	}{
+		{
+			oldText:  "great game",
+			newText:  "great game",
+			wantDiff: "great game",
+		},
+		{
+			oldText:  "great game",
+			newText:  "great game, too many ads",
+			wantDiff: "great [-game-] {+game, too many ads+}",
+		},
+		{
+			oldText:  "I love this game",
+			newText:  "I hate this game",
+			wantDiff: "I [-love-] {+hate+} this game",
+		},
+		{
+			oldText:  "",
+			newText:  "new review",
+			wantDiff: "{+new review+}",
+		},
+		{
+			oldText:  "old  review\n",
+			newText:  "",
+			wantDiff: "[-old review-]",
+		},
+	}
+	for _, test := range tests {
+		t.Run("diff test", func(t *testing.T) {
+			assert.Equal(t, test.wantDiff, uu.DiffWords(test.oldText, test.newText))
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kevincobain2000/go-app-reviews-scraper/app"
+	"gorm.io/gorm"
+)
+
+// WebhookDeliveriesRepository is the repository of the webhook deliveries, see @WebhookNotifier
+type WebhookDeliveriesRepository struct {
+	db *gorm.DB
+}
+
+// NewWebhookDeliveriesRepository the constructor for WebhookDeliveriesRepository
+func NewWebhookDeliveriesRepository() *WebhookDeliveriesRepository {
+	return &WebhookDeliveriesRepository{
+		db: app.NewDB(),
+	}
+}
+
+// InsertDeliveries inserts the deliveries of a notification at once, before their first attempt
+func (r *WebhookDeliveriesRepository) InsertDeliveries(deliveries []WebhookDeliveryModel) error {
+	return r.db.Create(&deliveries).Error
+}
+
+// SaveDelivery saves the delivery after an attempt
+func (r *WebhookDeliveriesRepository) SaveDelivery(delivery *WebhookDeliveryModel) error {
+	return r.db.Save(delivery).Error
+}
+
+// FindDelivery finds the delivery by its id
+func (r *WebhookDeliveriesRepository) FindDelivery(id int) (WebhookDeliveryModel, bool, error) {
+	var delivery = WebhookDeliveryModel{}
+	query := `id = ?
+		AND deleted_at IS NULL`
+	result := r.db.Where(query, id).First(&delivery)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return delivery, false, nil
+	}
+	return delivery, result.Error == nil, result.Error
+}
+
+// WebhookPendingTimeout is how long a delivery can be pending before it is replayed
+// which is well after its attempts, so it was left pending by a crash or a stop, see @WebhookNotifier.deliver
+const WebhookPendingTimeout = time.Hour
+
+// FindFailedDeliveries finds the deliveries that failed all their attempts
+// and the ones left pending for WebhookPendingTimeout, oldest first
+func (r *WebhookDeliveriesRepository) FindFailedDeliveries() ([]WebhookDeliveryModel, error) {
+	deliveries := []WebhookDeliveryModel{}
+	query := `(status = ? OR (status = ? AND updated_at < ?))
+		AND deleted_at IS NULL`
+	result := r.db.Where(
+		query,
+		WebhookDeliveryFailed,
+		WebhookDeliveryPending,
+		time.Now().Add(-WebhookPendingTimeout),
+	).Order("id ASC").Find(&deliveries)
+	return deliveries, result.Error
+}